@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type cacheCleanCommand struct{}
+
+func (c *cacheCleanCommand) run(ctx context.Context, opts *options, args []string) error {
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		return err
+	} else if err := CleanCache(dir); err != nil {
+		return fmt.Errorf("Could not remove the cache: %s", err)
+	}
+
+	LogInfo("Removed the cache in %s", dir)
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the names of the configuration files that are
+// searched for, in order of preference.
+var configFileNames = []string{".lddx.yaml", ".lddx.yml", "lddx.json"}
+
+// configSection contains settings keyed by the long name of the option
+// (e.g. ignore-prefix), as they would be given on the command line.
+type configSection map[string]interface{}
+
+// configFile is a project configuration file. Besides the top-level
+// settings, it may contain per-target sections, which are selected with
+// --target and override the top-level settings. A target section may also
+// list the files to process if none are given on the command line.
+type configFile struct {
+	Path     string                   // The path to the configuration file
+	Settings configSection            // The top-level settings
+	Targets  map[string]configSection // The per-target settings
+}
+
+// findConfigFile searches for a configuration file in the folder and its parents.
+func findConfigFile(dir string) (string, bool) {
+	for {
+		for _, name := range configFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, true
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// toConfigSection converts a mapping decoded from the configuration file to a section.
+func toConfigSection(value interface{}) (configSection, bool) {
+	switch section := value.(type) {
+	case configSection:
+		return section, true
+	case map[string]interface{}:
+		return section, true
+	}
+	return nil, false
+}
+
+// readConfigFile reads a configuration file, in JSON format if it
+// has a .json extension and in YAML format otherwise.
+func readConfigFile(path string) (*configFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings configSection
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &settings)
+	} else {
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: Invalid configuration file: %s", path, err)
+	}
+
+	ret := &configFile{Path: path, Settings: settings, Targets: make(map[string]configSection)}
+	if targets, ok := settings["targets"]; ok {
+		delete(settings, "targets")
+		targetMap, ok := toConfigSection(targets)
+		if !ok {
+			return nil, fmt.Errorf("%s: targets must be a mapping of target names to settings", path)
+		}
+		for name, target := range targetMap {
+			section, ok := toConfigSection(target)
+			if !ok {
+				return nil, fmt.Errorf("%s: Target %s must be a mapping of settings", path, name)
+			}
+			ret.Targets[name] = section
+		}
+	}
+	return ret, nil
+}
+
+// loadConfig reads the configuration file given by --config, or the first one
+// found from the working directory upwards. Returns nil if there is no file.
+func loadConfig(opts *options) (*configFile, error) {
+	path := opts.Config
+	if path == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if path, ok = findConfigFile(wd); !ok {
+			if opts.Target != "" {
+				return nil, fmt.Errorf("No configuration file found for target %s", opts.Target)
+			}
+			return nil, nil
+		}
+	}
+
+	return readConfigFile(path)
+}
+
+// resolveConfigPath makes a relative path in the configuration file
+// relative to the folder that contains it.
+func (c *configFile) resolveConfigPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(c.Path), path)
+}
+
+// settings merges the top-level settings with those of the target, if any.
+func (c *configFile) settings(target string) (configSection, error) {
+	ret := make(configSection)
+	for key, value := range c.Settings {
+		ret[key] = value
+	}
+
+	if target != "" {
+		section, ok := c.Targets[target]
+		if !ok {
+			var names []string
+			for name := range c.Targets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("%s: Unknown target %s (available targets: %s)", c.Path, target, strings.Join(names, ", "))
+		}
+		for key, value := range section {
+			ret[key] = value
+		}
+	}
+	return ret, nil
+}
+
+// findAnyOption finds an option of the command or any of its subcommands by its long name.
+func findAnyOption(cmd *flags.Command, name string) *flags.Option {
+	if option := cmd.FindOptionByLongName(name); option != nil {
+		return option
+	}
+	for _, subcommand := range cmd.Commands() {
+		if option := findAnyOption(subcommand, name); option != nil {
+			return option
+		}
+	}
+	return nil
+}
+
+// splitBoolArgs replaces the boolean options given as --name=true on the command
+// line with --name, and removes those given as --name=false, returning their names.
+// This allows a setting from the configuration file to be turned off.
+func splitBoolArgs(parser *flags.Parser, argv []string) ([]string, map[string]bool) {
+	var ret []string
+	disabled := make(map[string]bool)
+	for i, arg := range argv {
+		if arg == "--" {
+			ret = append(ret, argv[i:]...)
+			break
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !ok || !strings.HasPrefix(arg, "--") {
+			ret = append(ret, arg)
+			continue
+		}
+		option := findAnyOption(parser.Command, name)
+		if option == nil || option.Field().Type.Kind() != reflect.Bool {
+			ret = append(ret, arg)
+		} else if enabled, err := strconv.ParseBool(value); err != nil {
+			ret = append(ret, arg)
+		} else if enabled {
+			ret = append(ret, "--"+name)
+		} else {
+			disabled[name] = true
+		}
+	}
+	return ret, disabled
+}
+
+// insertConfigArgs adds the arguments from the configuration file to the command
+// line, after the subcommand (if any) so that its options are recognised, and
+// before any --, after which every argument is positional.
+func insertConfigArgs(argv, configArgs []string) []string {
+	for i, arg := range argv {
+		if arg == "--" {
+			return append(append(append([]string(nil), argv[:i]...), configArgs...), argv[i:]...)
+		}
+	}
+	return append(append([]string(nil), argv...), configArgs...)
+}
+
+// args converts the settings of the configuration file to command line
+// arguments for the command being run. Options that were set on the command
+// line (including those turned off with --name=false) are skipped, so that the
+// command line takes precedence. Settings for the options of other subcommands
+// are ignored. Also returns the files listed by the target, if any.
+func (c *configFile) args(parser *flags.Parser, cmd *flags.Command, target string, disabled map[string]bool) ([]string, []string, error) {
+	settings, err := c.settings(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args, files []string
+	for _, key := range keys {
+		var values []interface{}
+		if list, ok := settings[key].([]interface{}); ok {
+			values = list
+		} else {
+			values = []interface{}{settings[key]}
+		}
+
+		if key == "files" {
+			for _, value := range values {
+				files = append(files, c.resolveConfigPath(fmt.Sprint(value)))
+			}
+			continue
+		}
+
+		option := cmd.FindOptionByLongName(key)
+		if key == "config" || key == "target" || (option == nil && findAnyOption(parser.Command, key) == nil) {
+			return nil, nil, fmt.Errorf("%s: Unknown setting %s", c.Path, key)
+		} else if option == nil || disabled[key] || (option.IsSet() && !option.IsSetDefault()) {
+			continue
+		}
+
+		for _, value := range values {
+			if option.Field().Type.Kind() == reflect.Bool {
+				if enabled, ok := value.(bool); !ok {
+					return nil, nil, fmt.Errorf("%s: Setting %s must be true or false", c.Path, key)
+				} else if enabled {
+					args = append(args, "--"+key)
+				}
+				continue
+			}
+
+			arg := fmt.Sprint(value)
+			if option.Field().Tag.Get("config") == "path" {
+				arg = c.resolveConfigPath(arg)
+			}
+			args = append(args, "--"+key+"="+arg)
+		}
+	}
+	return args, files, nil
+}
+
+type configPrintCommand struct {
+	parser *flags.Parser
+}
+
+func (c *configPrintCommand) run(ctx context.Context, opts *options, args []string) error {
+	if opts.configPath != "" {
+		fmt.Printf("# Configuration file: %s\n", opts.configPath)
+	} else {
+		fmt.Println("# No configuration file found")
+	}
+	if opts.Target != "" {
+		fmt.Printf("# Target: %s\n", opts.Target)
+	}
+
+	// Print the settings in the order in which they are declared
+	settings := &yaml.Node{Kind: yaml.MappingNode}
+	addSetting := func(key string, value interface{}) error {
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(value); err != nil {
+			return err
+		}
+		settings.Content = append(settings.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+		return nil
+	}
+
+	for _, group := range c.parser.Groups() {
+		for _, option := range group.Options() {
+			switch option.LongName {
+			case "config", "target", "version", "help":
+				continue
+			}
+			if err := addSetting(option.LongName, option.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	if len(opts.configFiles) > 0 {
+		if err := addSetting("files", opts.configFiles); err != nil {
+			return err
+		}
+	}
+
+	out, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
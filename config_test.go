@@ -0,0 +1,235 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, filepath.Join(dir, "lddx.json"), "{}")
+	writeTestConfig(t, filepath.Join(dir, "project", ".lddx.yaml"), "")
+	if err := os.MkdirAll(filepath.Join(dir, "project", "build", "out"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{dir: dir, expected: filepath.Join(dir, "lddx.json")},
+		{dir: filepath.Join(dir, "project"), expected: filepath.Join(dir, "project", ".lddx.yaml")},
+		{dir: filepath.Join(dir, "project", "build", "out"), expected: filepath.Join(dir, "project", ".lddx.yaml")},
+	}
+
+	for _, test := range tests {
+		if path, ok := findConfigFile(test.dir); !ok || path != test.expected {
+			t.Errorf("%s: Expected %s but got %s", test.dir, test.expected, path)
+		}
+	}
+}
+
+func TestParseCommandLine(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, filepath.Join(dir, ".lddx.yaml"), `
+recursive: true
+ignore-prefix: [/opt/local/lib]
+collect: out
+max-paths: 5
+targets:
+  app:
+    files: [build/main]
+    recursive: false
+    ignore-prefix: [/usr/local/lib]
+  html:
+    html: report.html
+`)
+	writeTestConfig(t, filepath.Join(dir, "other.json"), `{"ignore-prefix": ["/other"]}`)
+	writeTestConfig(t, filepath.Join(dir, "unknown.yaml"), "no-such-option: true\n")
+	subdir := filepath.Join(dir, "src", "lib")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		argv     []string
+		check    func(opts *options, args []string) interface{}
+		expected interface{}
+		err      string
+	}{
+		{
+			name:     "discovered from a subfolder",
+			argv:     []string{"main"},
+			check:    func(opts *options, args []string) interface{} { return opts.configPath },
+			expected: filepath.Join(dir, ".lddx.yaml"),
+		},
+		{
+			name: "file settings",
+			argv: []string{"main"},
+			check: func(opts *options, args []string) interface{} {
+				return []interface{}{opts.Recursive, opts.IgnoredPrefixes}
+			},
+			expected: []interface{}{true, []string{"/opt/local/lib"}},
+		},
+		{
+			name:     "paths relative to the file",
+			argv:     []string{"main"},
+			check:    func(opts *options, args []string) interface{} { return opts.Collect },
+			expected: filepath.Join(dir, "out"),
+		},
+		{
+			name: "command line takes precedence",
+			argv: []string{"-i", "/cli", "--collect=cli", "main"},
+			check: func(opts *options, args []string) interface{} {
+				return []interface{}{opts.Collect, opts.IgnoredPrefixes}
+			},
+			expected: []interface{}{"cli", []string{"/cli"}},
+		},
+		{
+			name:     "boolean turned off on the command line",
+			argv:     []string{"--recursive=false", "main"},
+			check:    func(opts *options, args []string) interface{} { return []interface{}{opts.Recursive, args} },
+			expected: []interface{}{false, []string{"main"}},
+		},
+		{
+			name:     "boolean turned on on the command line",
+			argv:     []string{"--no-color=true", "main"},
+			check:    func(opts *options, args []string) interface{} { return opts.NoColor },
+			expected: true,
+		},
+		{
+			name: "explicit configuration file",
+			argv: []string{"--config", filepath.Join(dir, "other.json"), "main"},
+			check: func(opts *options, args []string) interface{} {
+				return []interface{}{opts.Recursive, opts.IgnoredPrefixes}
+			},
+			expected: []interface{}{false, []string{"/other"}},
+		},
+		{
+			name: "target overrides the top-level settings",
+			argv: []string{"--target", "app"},
+			check: func(opts *options, args []string) interface{} {
+				return []interface{}{opts.Recursive, opts.IgnoredPrefixes, args}
+			},
+			expected: []interface{}{false, []string{"/usr/local/lib"}, []string{filepath.Join(dir, "build", "main")}},
+		},
+		{
+			name:     "target files replaced by the command line",
+			argv:     []string{"--target", "app", "main"},
+			check:    func(opts *options, args []string) interface{} { return args },
+			expected: []string{"main"},
+		},
+		{
+			name: "unknown target",
+			argv: []string{"--target", "missing", "main"},
+			err:  "Unknown target missing (available targets: app, html)",
+		},
+		{
+			name: "unknown setting",
+			argv: []string{"--config", filepath.Join(dir, "unknown.yaml"), "main"},
+			err:  "Unknown setting no-such-option",
+		},
+		{
+			name:     "root options with a subcommand",
+			argv:     []string{"why", "libz", "main"},
+			check:    func(opts *options, args []string) interface{} { return []interface{}{opts.Recursive, opts.Collect} },
+			expected: []interface{}{true, filepath.Join(dir, "out")},
+		},
+		{
+			name:     "required subcommand option from the file",
+			argv:     []string{"--target", "html", "report", "main"},
+			check:    func(opts *options, args []string) interface{} { return opts.configPath },
+			expected: filepath.Join(dir, ".lddx.yaml"),
+		},
+		{
+			name: "required subcommand option missing",
+			argv: []string{"report", "main"},
+			err:  "the required flag `--html' was not specified",
+		},
+		{
+			name:     "positional arguments after --",
+			argv:     []string{"--", "--recursive=false"},
+			check:    func(opts *options, args []string) interface{} { return []interface{}{opts.Recursive, args} },
+			expected: []interface{}{true, []string{"--recursive=false"}},
+		},
+	}
+
+	chdir(t, subdir)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, _, _, args, err := parseCommandLine(test.argv)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Expected error %q but got %v", test.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := test.check(opts, args); !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("Expected %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseCommandLineSubcommandOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, filepath.Join(dir, ".lddx.yaml"), "max-paths: 5\nmatch: name\nsystem-libraries: system.txt\n")
+	chdir(t, dir)
+
+	tests := []struct {
+		argv     []string
+		expected interface{}
+	}{
+		{argv: []string{"why", "libz", "main"}, expected: []interface{}{5, "name"}},
+		{argv: []string{"why", "--max-paths=2", "libz", "main"}, expected: []interface{}{2, "name"}},
+		{argv: []string{"why", "--match", "real-path", "libz", "main"}, expected: []interface{}{5, "real-path"}},
+		{argv: []string{"verify", "My.app"}, expected: filepath.Join(dir, "system.txt")},
+		{argv: []string{"verify", "--system-libraries", "cli.txt", "My.app"}, expected: "cli.txt"},
+	}
+
+	for _, test := range tests {
+		_, _, commands, _, err := parseCommandLine(test.argv)
+		if err != nil {
+			t.Errorf("%v: %s", test.argv, err)
+			continue
+		}
+
+		var actual interface{}
+		switch cmd := commands[test.argv[0]].(type) {
+		case *whyCommand:
+			actual = []interface{}{cmd.MaxPaths, cmd.Match}
+		case *verifyCommand:
+			actual = cmd.SystemLibraries
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%v: Expected %v but got %v", test.argv, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type diffCommand struct {
+	Args struct {
+		Old string `positional-arg-name:"old" description:"The saved JSON graph, file or folder of the old build"`
+		New string `positional-arg-name:"new" description:"The saved JSON graph, file or folder of the new build"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *diffCommand) run(ctx context.Context, opts *options, args []string) error {
+	oldGraph, err := loadGraph(ctx, opts, c.Args.Old)
+	if err != nil {
+		return fmt.Errorf("Could not load %s: %s", c.Args.Old, err)
+	}
+	newGraph, err := loadGraph(ctx, opts, c.Args.New)
+	if err != nil {
+		return fmt.Errorf("Could not load %s: %s", c.Args.New, err)
+	}
+
+	diff := DepsDiff(oldGraph, newGraph)
+	if opts.JSON {
+		out, err := json.MarshalIndent(diff, "", "\t")
+		if err != nil {
+			return fmt.Errorf("Could not serialise as JSON: %s", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		DiffPrettyPrint(diff)
+	}
+	return nil
+}
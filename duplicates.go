@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+// duplicateJSON is the JSON representation of a duplicate library.
+// The dependencies themselves are reduced to their real paths,
+// as their subtrees may be shared or circular.
+type duplicateJSON struct {
+	Kind      DuplicateKind `json:"kind"`
+	Key       string        `json:"key"`
+	RealPaths []string      `json:"realPaths"`
+	Versions  []string      `json:"versions"`
+}
+
+// getDuplicatesJSON returns the JSON representation of the duplicate libraries.
+func getDuplicatesJSON(dups []*DuplicateLibrary) []duplicateJSON {
+	ret := make([]duplicateJSON, 0, len(dups))
+	for _, dup := range dups {
+		ent := duplicateJSON{Kind: dup.Kind, Key: dup.Key, RealPaths: []string{}, Versions: dup.Versions}
+		for _, dep := range dup.Libraries {
+			ent.RealPaths = append(ent.RealPaths, dep.RealPath)
+		}
+		ret = append(ret, ent)
+	}
+	return ret
+}
+
+type duplicatesCommand struct {
+	Args struct {
+		Files []string `positional-arg-name:"files" description:"The saved JSON graph, or the files or folders to process"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *duplicatesCommand) run(ctx context.Context, opts *options, args []string) error {
+	graph, err := loadGraphFiles(ctx, opts, append(c.Args.Files, args...))
+	if err != nil {
+		return fmt.Errorf("Could not process dependencies: %s", err)
+	}
+
+	dups := DepsDuplicates(graph)
+	if opts.JSON {
+		out, err := json.MarshalIndent(getDuplicatesJSON(dups), "", "\t")
+		if err != nil {
+			return fmt.Errorf("Could not serialise as JSON: %s", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		DuplicatesPrettyPrint(dups)
+	}
+
+	if len(dups) > 0 {
+		return fmt.Errorf("Found %d duplicate libraries", len(dups))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+func TestDuplicatesJSON(t *testing.T) {
+	dups := []*DuplicateLibrary{{
+		Kind:      DuplicateByID,
+		Key:       "@rpath/libz.dylib",
+		Libraries: []*Dependency{{RealPath: "/a/libz.dylib"}, {RealPath: "/b/libz.dylib"}},
+		Versions:  []string{"compatibility version 1.0.0, current version 1.2.13"},
+	}}
+
+	tests := []struct {
+		dups     []*DuplicateLibrary
+		expected string
+	}{
+		{dups: nil, expected: `[]`},
+		{
+			dups:     dups,
+			expected: `[{"kind":"id","key":"@rpath/libz.dylib","realPaths":["/a/libz.dylib","/b/libz.dylib"],"versions":["compatibility version 1.0.0, current version 1.2.13"]}]`,
+		},
+	}
+
+	for _, test := range tests {
+		out, err := json.Marshal(getDuplicatesJSON(test.dups))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(out) != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, out)
+		}
+	}
+}
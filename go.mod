@@ -1,14 +1,16 @@
 module github.com/jtanx/lddx
 
-go 1.17
+go 1.21
 
 require (
 	github.com/fatih/color v1.13.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/jessevdk/go-flags v1.5.0
 	github.com/mattn/go-colorable v0.1.12
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
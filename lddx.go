@@ -1,53 +1,228 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	. "github.com/jtanx/lddx/lddx"
 )
 
+const version = "0.1.0"
+
 type options struct {
 	NoColor         bool     `short:"n" long:"no-color" description:"Colourised output"`
 	Quiet           bool     `short:"q" long:"quiet" description:"Less verbose output"`
 	Version         bool     `short:"v" long:"version" description:"Prints the version of lddx"`
 	Recursive       bool     `short:"r" long:"recursive" description:"Recursively find dependencies"`
 	Jobs            int      `short:"j" long:"jobs" default:"10" description:"Number of files to process concurrently."`
-	JSON            bool     `short:"s" long:"json" description:"Dump dependencies in JSON format"`
+	JSON            bool     `short:"s" long:"json" description:"Dump dependencies in JSON format, as described by lddx schema"`
+	NDJSON          bool     `long:"ndjson" description:"Stream dependencies as newline delimited JSON, with one record per library, load command and diagnostic"`
+	Format          string   `long:"format" choice:"text" choice:"tree" choice:"dot" choice:"cyclonedx" choice:"spdx" choice:"otool" choice:"otool-l" default:"text" description:"The format in which to print the dependencies (the SBOM formats cyclonedx and spdx have package URLs for Homebrew, Nix and Conda libraries, but not for MacPorts ones)"`
+	MaxDepth        int      `long:"max-depth" default:"0" description:"The maximum depth of the dependencies to print, for formats that support it (0 for unlimited)"`
+	CollapseIgnored bool     `long:"collapse-ignored" description:"Groups the ignored libraries into a single cluster, for the dot format"`
+	ASCII           bool     `long:"ascii" description:"Draws the tree with ASCII instead of Unicode box-drawing characters, for the tree format"`
+	HidePruned      bool     `long:"hide-pruned" description:"Hides the ignored libraries (e.g. the system libraries), for the tree format"`
+	Arch            string   `long:"arch" description:"The architecture of fat files to print, or all, for the otool formats (default: the host architecture if present, else all)"`
+	GroupByPackage  bool     `long:"group-by-package" description:"Groups the libraries by the package manager and package that installed them (e.g. Homebrew, MacPorts, Nix, Conda or the system), for the text format"`
 	IgnoredPrefixes []string `short:"i" long:"ignore-prefix" description:"Specifies a library prefix to ignore when resolving dependencies"`
 	IgnoredFiles    []string `short:"x" long:"ignore-file" description:"Specifies a file (e.g. libz.dylib) to ignore when resolving dependencies (case sensitive)"`
+	IgnoreRules     []string `short:"g" long:"ignore-rule" description:"Specifies a rule of the form [target:]kind:pattern to ignore matching dependencies, where target is any, name, install-name or real-path and kind is glob or regex (e.g. glob:**/Python.framework/**)"`
 	NoDefaultIgnore bool     `short:"d" long:"no-default-ignore" description:"By default, libraries under /System and /usr/lib are ignored from dependency resolution. Specify this flag to not ignore these"`
-	ExecutablePath  string   `short:"e" long:"executable-path" description:"Executable path to use when resolving @executable_path dependencies"`
+	ExecutablePath  string   `short:"e" long:"executable-path" config:"path" description:"Executable path to use when resolving @executable_path dependencies"`
 	SkipWeakLibs    bool     `long:"skip-weak" description:"Skip handling weakly loaded libs"`
+	NoCache         bool     `long:"no-cache" description:"Do not use or update the cache of parsed Mach-O files"`
 
-	Collect            string   `short:"c" long:"collect" description:"Collects dependencies into the specified folder"`
+	Collect            string   `short:"c" long:"collect" config:"path" description:"Collects dependencies into the specified folder"`
 	CollectOrder       []string `short:"l" long:"collect-order" description:"Specifies a prefix to prefer when resolving conflicts in library collection"`
 	Overwrite          bool     `short:"w" long:"overwrite" description:"Ignore and overwrite existing libraries in the collection folder"`
 	ModifySpecialPaths bool     `short:"m" long:"modify-special-paths" description:"Collect and modify special paths (e.g. @executable_path/@loader_path) when collecting dependencies"`
 	CollectFrameworks  bool     `short:"f" long:"collect-frameworks" descrption:"Include Framework libraries in the collection"`
 
-	CpuProfile string `long:"cpu-profile" description:"Run CPU profiling (e.g. --cpu-profile=cpuprofile.pprof)"`
-	MemProfile string `long:"mem-profile" description:"Run memory profiling (e.g. --mem-profile=memprofile.pprof)"`
+	CpuProfile string `long:"cpu-profile" config:"path" description:"Run CPU profiling (e.g. --cpu-profile=cpuprofile.pprof)"`
+	MemProfile string `long:"mem-profile" config:"path" description:"Run memory profiling (e.g. --mem-profile=memprofile.pprof)"`
+
+	Config string `long:"config" description:"Configuration file to use, instead of searching for .lddx.yaml or lddx.json from the working directory upwards"`
+	Target string `short:"t" long:"target" description:"Applies the settings of the named target section in the configuration file"`
+
+	configPath  string   // The configuration file that was loaded, if any
+	configFiles []string // The files listed by the configuration target, if any
+	cache       *Cache   // The cache of parsed Mach-O files, once opened
 }
 
 func setIgnoredPrefixes(opts *options, depOpts *DependencyOptions) {
-	ignoredPrefixes := make(map[string]bool)
+	var prefixes []string
 	if !opts.NoDefaultIgnore {
-		ignoredPrefixes["/System"] = true
-		ignoredPrefixes["/usr/lib"] = true
+		prefixes = append(prefixes, "/System", "/usr/lib")
 	}
+	prefixes = append(prefixes, opts.IgnoredPrefixes...)
 
-	for _, prefix := range opts.IgnoredPrefixes {
-		ignoredPrefixes[prefix] = true
+	// Remove duplicates, keeping the order in which they were specified
+	seenPrefixes := make(map[string]bool)
+	for _, prefix := range prefixes {
+		if !seenPrefixes[prefix] {
+			seenPrefixes[prefix] = true
+			depOpts.IgnoredPrefixes = append(depOpts.IgnoredPrefixes, prefix)
+		}
 	}
+}
 
-	for prefix := range ignoredPrefixes {
-		depOpts.IgnoredPrefixes = append(depOpts.IgnoredPrefixes, prefix)
+// getCache opens the cache of parsed Mach-O files, unless it is disabled.
+// The analysis continues without a cache if it cannot be opened.
+func getCache(opts *options) *Cache {
+	if opts.NoCache || opts.cache != nil {
+		return opts.cache
+	}
+
+	dir, err := DefaultCacheDir()
+	if err == nil {
+		opts.cache, err = OpenCache(dir)
+	}
+	if err != nil {
+		LogWarn("Not using the cache: %s", err)
+		opts.NoCache = true
 	}
+	return opts.cache
+}
+
+// getDependencyOptions returns the options used to calculate the dependency graph.
+func getDependencyOptions(opts *options) (DependencyOptions, error) {
+	depOpts := DependencyOptions{
+		Recursive:      opts.Recursive,
+		Jobs:           opts.Jobs,
+		IgnoredFiles:   opts.IgnoredFiles,
+		SkipWeakLibs:   opts.SkipWeakLibs,
+		ExecutablePath: opts.ExecutablePath,
+		// Ignored prefixes set below.
+	}
+	setIgnoredPrefixes(opts, &depOpts)
+	depOpts.Cache = getCache(opts)
+
+	for _, rule := range opts.IgnoreRules {
+		ignoreRule, err := ParseIgnoreRule(rule)
+		if err != nil {
+			return depOpts, err
+		}
+		depOpts.IgnoreRules = append(depOpts.IgnoreRules, ignoreRule)
+	}
+	return depOpts, nil
+}
+
+// command is implemented by each of the lddx subcommands.
+type command interface {
+	run(ctx context.Context, opts *options, args []string) error
+}
+
+// addCommands registers the subcommands with the parser.
+func addCommands(parser *flags.Parser) map[string]command {
+	commands := map[string]command{
+		"why":          &whyCommand{},
+		"diff":         &diffCommand{},
+		"duplicates":   &duplicatesCommand{},
+		"config print": &configPrintCommand{parser: parser},
+		"cache clean":  &cacheCleanCommand{},
+		"watch":        &watchCommand{},
+		"report":       &reportCommand{},
+		"schema":       &schemaCommand{},
+		"verify":       &verifyCommand{},
+	}
+
+	parser.SubcommandsOptional = true
+	parser.AddCommand("why", "Show why a library is a dependency",
+		"Prints every path from the top-level files to the libraries matching the query, "+
+			"along with the libraries that directly depend on them. "+
+			"The query may be a name, install name or real path, or a glob pattern.", commands["why"])
+	parser.AddCommand("diff", "Compare the dependencies of two builds",
+		"Compares two dependency graphs, each of which may either be a saved JSON file "+
+			"(from --json) or a file or folder to process. Prints the libraries that were added "+
+			"or removed, and those whose resolved path or version changed or that are newly unresolved.", commands["diff"])
+	parser.AddCommand("duplicates", "Find libraries loaded from multiple locations",
+		"Groups the libraries by their install name (LC_ID_DYLIB) and Mach-O UUID, and prints "+
+			"those that are loaded from more than one location, as dyld would load each copy. "+
+			"Exits with a non-zero status if any duplicates are found.", commands["duplicates"])
+	parser.AddCommand("report", "Write an HTML report of the dependencies",
+		"Writes a self-contained HTML file, which can be viewed offline, with a summary, a collapsible "+
+			"dependency tree, a searchable table of the libraries and the diagnostics. "+
+			"The graph may either be a saved JSON file (from --json) or be calculated from files or folders.", commands["report"])
+	parser.AddCommand("schema", "Print the JSON Schema of the JSON output",
+		"Prints the JSON Schema (draft 2020-12) describing the dependency graph written by --json. "+
+			"The schemaVersion of each document identifies the version of the schema that it follows.", commands["schema"])
+	parser.AddCommand("verify", "Verify that a collected bundle is self-contained",
+		"Simulates how dyld resolves the libraries loaded by each Mach-O file in the bundle, and prints "+
+			"every load command that refers to an absolute path outside the system libraries, that resolves "+
+			"(e.g. through @rpath) to a library outside the bundle, or that cannot be resolved. "+
+			"Exits with a non-zero status if any are found, for use as a release gate.", commands["verify"])
+
+	parser.AddCommand("watch", "Watch for changes to the dependencies",
+		"Prints the dependencies, and then watches the files and their dependencies for changes. "+
+			"After each change, prints the libraries that were added or removed, and those whose "+
+			"resolved path or version changed or that are newly unresolved. "+
+			"If --collect is specified, the dependencies are also collected again.", commands["watch"])
+
+	config, _ := parser.AddCommand("config", "Inspect the configuration",
+		"Commands to inspect the settings loaded from the configuration file.", &struct{}{})
+	config.AddCommand("print", "Print the effective settings",
+		"Prints the settings after merging the configuration file, the target section and the command line.",
+		commands["config print"])
+
+	cache, _ := parser.AddCommand("cache", "Manage the cache",
+		"Commands to manage the cache of parsed Mach-O files. Entries are invalidated "+
+			"when the size, modification time or inode of a file changes.", &struct{}{})
+	cache.AddCommand("clean", "Remove the cache",
+		"Removes the cache of parsed Mach-O files.", commands["cache clean"])
+	return commands
+}
+
+// loadGraph reads the dependency graph from a saved JSON file, or calculates
+// it recursively if the path is a Mach-O file or a folder.
+func loadGraph(ctx context.Context, opts *options, path string) (*DependencyGraph, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		if isfm, err := IsFatMachO(path); err != nil {
+			return nil, err
+		} else if !isfm {
+			fd, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer fd.Close()
+			graph, err := DepsLoadJSON(fd)
+			if err != nil {
+				return nil, fmt.Errorf("%s: Not a Mach-O/Universal binary or JSON graph: %s", path, err)
+			}
+			return graph, nil
+		}
+	}
+
+	depOpts, err := getDependencyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	depOpts.Recursive = true
+	return DepsReadContext(ctx, depOpts, expandFileList([]string{path})...)
+}
+
+// loadGraphFiles loads the graph from a single saved JSON graph, or
+// calculates the dependency graph for the files or folders.
+func loadGraphFiles(ctx context.Context, opts *options, files []string) (*DependencyGraph, error) {
+	if len(files) == 1 {
+		return loadGraph(ctx, opts, files[0])
+	}
+
+	depOpts, err := getDependencyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	depOpts.Recursive = true
+	return DepsReadContext(ctx, depOpts, expandFileList(files)...)
 }
 
 func expandFileList(files []string) []string {
@@ -74,24 +249,161 @@ func expandFileList(files []string) []string {
 	return ret
 }
 
-func main() {
+// creationTime returns the time to record in generated documents, or the
+// zero time for the current time. As for reproducible builds,
+// SOURCE_DATE_EPOCH overrides the current time.
+func creationTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return time.Time{}
+}
+
+// sbomOptions returns the options used to write a bill of materials.
+func sbomOptions() SBOMOptions {
+	return SBOMOptions{ToolName: "lddx", ToolVersion: version, Timestamp: creationTime()}
+}
+
+// printGraph prints the dependency graph in the format given by the options.
+func printGraph(opts *options, graph *DependencyGraph) error {
+	switch opts.Format {
+	case "dot":
+		return DepsWriteDot(os.Stdout, graph, DotOptions{
+			CollapseIgnored: opts.CollapseIgnored,
+			MaxDepth:        opts.MaxDepth,
+		})
+	case "tree":
+		return DepsWriteTree(os.Stdout, graph, TreeOptions{
+			ASCII:      opts.ASCII,
+			MaxDepth:   opts.MaxDepth,
+			HidePruned: opts.HidePruned,
+			NoColor:    opts.NoColor,
+		})
+	case "cyclonedx":
+		return DepsWriteCycloneDX(os.Stdout, graph, sbomOptions())
+	case "spdx":
+		return DepsWriteSPDX(os.Stdout, graph, sbomOptions())
+	case "otool", "otool-l":
+		return DepsWriteOtool(os.Stdout, graph, OtoolOptions{
+			LoadCommands: opts.Format == "otool-l",
+			Arch:         opts.Arch,
+		})
+	default:
+		for _, dep := range graph.TopDeps {
+			if len(graph.TopDeps) > 1 {
+				fmt.Printf("%s:\n", dep.Path)
+			}
+			if opts.GroupByPackage {
+				DepsPrettyPrintByPackage(dep)
+			} else {
+				DepsPrettyPrint(dep)
+			}
+		}
+	}
+	return nil
+}
+
+// collectGraph collects the dependencies into the collection folder and fixes
+// up the top-level files. The diagnostics are added to the graph.
+// Returns false if the collection failed.
+func collectGraph(ctx context.Context, opts *options, graph *DependencyGraph) bool {
+	collectorOpts := CollectorOptions{
+		Folder:             opts.Collect,
+		PreferredOrder:     opts.CollectOrder,
+		Overwrite:          opts.Overwrite,
+		Jobs:               opts.Jobs,
+		ModifySpecialPaths: opts.ModifySpecialPaths,
+		CollectFrameworks:  opts.CollectFrameworks,
+	}
+
+	result, err := CollectDepsContext(ctx, graph, &collectorOpts)
+	graph.Diagnostics = append(graph.Diagnostics, result.Diagnostics...)
+	if err != nil {
+		LogError("Could not collect dependencies: %s", err)
+		return false
+	}
+
+	result, err = FixupToplevelsContext(ctx, graph, &collectorOpts)
+	graph.Diagnostics = append(graph.Diagnostics, result.Diagnostics...)
+	if err != nil {
+		LogError("Could not fixup toplevels: %s", err)
+		return false
+	}
+	return true
+}
+
+// parseArgs parses the command line arguments, without applying the configuration file.
+// Boolean options that were turned off with --name=false are also returned.
+func parseArgs(argv []string) (*options, *flags.Parser, map[string]command, []string, map[string]bool, error) {
 	var opts options
 	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
-	args, err := parser.Parse()
+	commands := addCommands(parser)
+	argv, disabled := splitBoolArgs(parser, argv)
+	args, err := parser.ParseArgs(argv)
+	return &opts, parser, commands, args, disabled, err
+}
+
+// parseCommandLine parses the command line arguments and applies the settings
+// from the configuration file to those options that were not set on the command line.
+func parseCommandLine(argv []string) (*options, *flags.Parser, map[string]command, []string, error) {
+	opts, parser, commands, args, disabled, err := parseArgs(argv)
+	if flagsErr, ok := err.(*flags.Error); err != nil && (!ok || flagsErr.Type != flags.ErrRequired) {
+		// Required options may still be set by the configuration file
+		return nil, nil, nil, nil, err
+	} else if opts.Version {
+		return opts, parser, commands, args, nil
+	}
+
+	config, configErr := loadConfig(opts)
+	if configErr != nil {
+		return nil, nil, nil, nil, configErr
+	} else if config == nil {
+		return opts, parser, commands, args, err
+	}
+
+	// The settings are added to the options of the command being run
+	cmd := parser.Command
+	for cmd.Active != nil {
+		cmd = cmd.Active
+	}
+	configArgs, configFiles, err := config.args(parser, cmd, opts.Target, disabled)
 	if err != nil {
-		switch er := err.(type) {
-		case *flags.Error:
-			if er.Type == flags.ErrHelp {
-				fmt.Println(err)
-				os.Exit(0)
-			}
-		}
+		return nil, nil, nil, nil, err
+	}
+
+	opts, parser, commands, args, _, err = parseArgs(insertConfigArgs(argv, configArgs))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	opts.configPath = config.Path
+	opts.configFiles = configFiles
+	if len(args) == 0 && parser.Active == nil {
+		args = configFiles
+	}
+	return opts, parser, commands, args, nil
+}
+
+// activeCommand returns the name of the subcommand being run (e.g. config print), if any.
+func activeCommand(parser *flags.Parser) string {
+	var names []string
+	for active := parser.Active; active != nil; active = active.Active {
+		names = append(names, active.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func main() {
+	opts, parser, commands, args, err := parseCommandLine(os.Args[1:])
+	if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+		fmt.Println(err)
+		os.Exit(0)
+	} else if err != nil {
 		LogError("%s", err)
 		os.Exit(1)
 	}
 
 	if opts.Version {
-		fmt.Println("lddx version 0.1.0")
+		fmt.Printf("lddx version %s\n", version)
 		os.Exit(0)
 	}
 
@@ -107,56 +419,67 @@ func main() {
 
 	LogInit(opts.NoColor, opts.Quiet)
 
-	depOpts := DependencyOptions{
-		Recursive:      opts.Recursive,
-		Jobs:           opts.Jobs,
-		IgnoredFiles:   opts.IgnoredFiles,
-		SkipWeakLibs:   opts.SkipWeakLibs,
-		ExecutablePath: opts.ExecutablePath,
-		// Ignored prefixes set below.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if parser.Active != nil {
+		if err := commands[activeCommand(parser)].run(ctx, opts, args); err != nil {
+			LogError("%s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	depOpts, err := getDependencyOptions(opts)
+	if err != nil {
+		LogError("%s", err)
+		os.Exit(1)
+	} else if opts.JSON && opts.NDJSON {
+		LogError("Only one of --json and --ndjson may be specified")
+		os.Exit(1)
+	}
+
+	// The records are written as soon as each file has been read
+	var ndjson *NDJSONWriter
+	if opts.NDJSON {
+		ndjson = NewNDJSONWriter(os.Stdout)
+		depOpts.OnRead = ndjson.Dependency
 	}
-	setIgnoredPrefixes(&opts, &depOpts)
 
-	graph, err := DepsRead(depOpts, expandFileList(args)...)
+	graph, err := DepsReadContext(ctx, depOpts, expandFileList(args)...)
 	if err != nil {
 		LogError("Could not process dependencies: %s", err)
 		os.Exit(1)
 	}
 
-	if opts.JSON {
-		if out, err := json.MarshalIndent(DepsGetJSONSerialisableVersion(graph), "", "\t"); err != nil {
-			LogError("Could not serialise as JSON: %s", err)
-		} else {
-			fmt.Println(string(out))
-		}
-	} else if opts.Collect == "" || !opts.Quiet {
-		for _, dep := range graph.TopDeps {
-			if len(graph.TopDeps) > 1 {
-				fmt.Printf("%s:\n", dep.Path)
-			}
-			DepsPrettyPrint(dep)
+	if !opts.JSON && !opts.NDJSON && (opts.Collect == "" || !opts.Quiet) {
+		if err := printGraph(opts, graph); err != nil {
+			LogError("Could not print dependencies: %s", err)
+			os.Exit(1)
 		}
 	}
 
+	collectFailed := false
 	if opts.Collect != "" {
-		collectorOpts := CollectorOptions{
-			Folder:             opts.Collect,
-			PreferredOrder:     opts.CollectOrder,
-			Overwrite:          opts.Overwrite,
-			Jobs:               opts.Jobs,
-			ModifySpecialPaths: opts.ModifySpecialPaths,
-			CollectFrameworks:  opts.CollectFrameworks,
-		}
+		collectFailed = !collectGraph(ctx, opts, graph)
+	}
 
-		if err := CollectDeps(graph, &collectorOpts); err != nil {
-			LogError("Could not collect dependencies: %s", err)
-			os.Exit(1)
-		} else if err := FixupToplevels(graph, &collectorOpts); err != nil {
-			LogError("Could not fixup toplevels: %s", err)
-			os.Exit(1)
+	// The JSON output and NDJSON diagnostics are emitted last so that they include the collection diagnostics
+	if opts.NDJSON {
+		ndjson.Diagnostics(graph.Diagnostics)
+		if err := ndjson.Err(); err != nil {
+			LogError("Could not write NDJSON: %s", err)
+		}
+	} else if opts.JSON {
+		if err := DepsWriteJSON(os.Stdout, graph, jsonOptions()); err != nil {
+			LogError("Could not serialise as JSON: %s", err)
 		}
 	}
 
+	if collectFailed {
+		os.Exit(1)
+	}
+
 	if opts.MemProfile != "" {
 		if fp, err := os.Create(opts.MemProfile); err != nil {
 			LogError("Could not create memory profile: %s", err)
@@ -0,0 +1,196 @@
+package lddx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheVersion is incremented whenever the format of the cache or the
+// information read from the load commands changes, invalidating old caches.
+const cacheVersion = 3
+
+// cacheFileName is the name of the index file in the cache folder.
+const cacheFileName = "loadinfo.json"
+
+// cacheEntry is the cached load information of a file. The entry is only
+// valid while the size, modification time and inode of the file are unchanged.
+type cacheEntry struct {
+	Size    int64     // The size of the file
+	ModTime int64     // The modification time of the file, in nanoseconds
+	Inode   uint64    // The inode of the file, or 0 if unsupported
+	Info    *LoadInfo // The information read from the load commands
+}
+
+// cacheIndex is the format of the cache on disk.
+type cacheIndex struct {
+	Version int                    // The version of the cache format
+	Entries map[string]*cacheEntry // The entries, keyed by the real path of the file
+}
+
+// Cache stores the load information of files on disk, so that files that
+// have not changed since the last run do not have to be parsed again.
+// It is safe for concurrent use.
+type Cache struct {
+	Dir     string // The folder that contains the cache, or empty if only kept in memory
+	entries map[string]*cacheEntry
+	dirty   bool
+	lock    sync.Mutex
+	read    func(file string) (*LoadInfo, error) // Reads the files that are not cached, if not ReadLoadInfo
+}
+
+// DefaultCacheDir returns the folder in which the cache is stored by default.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lddx"), nil
+}
+
+// OpenCache opens the cache in the given folder. If there is no cache,
+// or it is invalid or from an older version of lddx, an empty cache is returned.
+func OpenCache(dir string) (*Cache, error) {
+	ret := &Cache{Dir: dir, entries: make(map[string]*cacheEntry)}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, cacheFileName))
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var index cacheIndex
+	if err := json.Unmarshal(data, &index); err != nil || index.Version != cacheVersion || index.Entries == nil {
+		return ret, nil
+	}
+	ret.entries = index.Entries
+	return ret, nil
+}
+
+// NewMemoryCache creates a cache that is only kept in memory.
+func NewMemoryCache() *Cache {
+	return &Cache{entries: make(map[string]*cacheEntry)}
+}
+
+// CleanCache removes the cache in the given folder.
+func CleanCache(dir string) error {
+	return os.RemoveAll(dir)
+}
+
+// getCacheKey returns the absolute path of the file and the entry to validate it against.
+func getCacheKey(file string) (string, *cacheEntry, error) {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return absPath, &cacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   fileInode(info),
+	}, nil
+}
+
+// ReadLoadInfo returns the load information of the file from the cache if the
+// file is unchanged, and otherwise reads it from the file and updates the cache.
+func (c *Cache) ReadLoadInfo(file string) (*LoadInfo, error) {
+	key, entry, err := getCacheKey(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	cached, ok := c.entries[key]
+	c.lock.Unlock()
+	if ok && cached.Size == entry.Size && cached.ModTime == entry.ModTime && cached.Inode == entry.Inode {
+		return cached.Info, nil
+	}
+
+	if c.read != nil {
+		entry.Info, err = c.read(file)
+	} else {
+		entry.Info, err = ReadLoadInfo(file, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.entries[key] = entry
+	c.dirty = true
+	c.lock.Unlock()
+	return entry.Info, nil
+}
+
+// Invalidate removes the entry for the file, so that it is read again.
+// This is needed when a file may have been changed without changing its
+// size or modification time, e.g. when it was rewritten within the
+// resolution of the file system's timestamps.
+func (c *Cache) Invalidate(file string) {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.entries[absPath]; ok {
+		delete(c.entries, absPath)
+		c.dirty = true
+	}
+}
+
+// Save writes the cache to disk, if it has changed since it was opened
+// and is not only kept in memory. The entries of the files that no longer
+// exist are removed.
+// The index is written to a temporary file first, so that concurrent
+// runs of lddx never see a partially written cache.
+func (c *Cache) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.dirty || c.Dir == "" {
+		return nil
+	}
+
+	for file := range c.entries {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			delete(c.entries, file)
+		}
+	}
+
+	data, err := json.Marshal(cacheIndex{Version: cacheVersion, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	fp, err := ioutil.TempFile(c.Dir, cacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	_, err = fp.Write(data)
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), filepath.Join(c.Dir, cacheFileName))
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+		return fmt.Errorf("Could not save cache: %s", err)
+	}
+
+	c.dirty = false
+	return nil
+}
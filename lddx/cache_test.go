@@ -0,0 +1,141 @@
+package lddx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// openTestCache opens the cache, counting the files that are parsed.
+func openTestCache(t *testing.T, dir string, parsed *int) *Cache {
+	cache, err := OpenCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.read = func(file string) (*LoadInfo, error) {
+		*parsed++
+		return ReadLoadInfo(file, nil)
+	}
+	return cache
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	file := filepath.Join(dir, "libfoo.dylib")
+	writeTestMachO(t, file, testMachO{ID: "@rpath/libfoo.dylib", Dylibs: []string{"/usr/lib/libaaa.dylib"}})
+	modTime := time.Unix(1600000000, 0)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := 0
+	cache := openTestCache(t, cacheDir, &parsed)
+	info, err := cache.ReadLoadInfo(file)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := cache.ReadLoadInfo(file); err != nil {
+		t.Fatal(err)
+	} else if parsed != 1 {
+		t.Errorf("Expected the file to be parsed once, but it was parsed %d times", parsed)
+	} else if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reopened cache does not parse the unchanged file again
+	parsed = 0
+	cache = openTestCache(t, cacheDir, &parsed)
+	if cached, err := cache.ReadLoadInfo(file); err != nil {
+		t.Fatal(err)
+	} else if parsed != 0 {
+		t.Errorf("Expected the cached info to be used, but the file was parsed %d times", parsed)
+	} else if !reflect.DeepEqual(cached, info) {
+		t.Errorf("Expected cached info %+v but got %+v", info, cached)
+	}
+
+	// Changing the file invalidates its entry
+	writeTestMachO(t, file, testMachO{ID: "@rpath/libfoo.dylib", Dylibs: []string{"/usr/lib/libbbb.dylib"}})
+	modTime = modTime.Add(time.Second)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := cache.ReadLoadInfo(file); err != nil {
+		t.Fatal(err)
+	} else if parsed != 1 {
+		t.Errorf("Expected the changed file to be parsed once, but it was parsed %d times", parsed)
+	} else if len(updated.Dylibs) != 1 || updated.Dylibs[0].Path != "/usr/lib/libbbb.dylib" {
+		t.Errorf("Expected updated info with /usr/lib/libbbb.dylib but got %+v", updated.Dylibs)
+	}
+
+	// As does invalidating it explicitly
+	cache.Invalidate(file)
+	if _, err := cache.ReadLoadInfo(file); err != nil {
+		t.Fatal(err)
+	} else if parsed != 2 {
+		t.Errorf("Expected the invalidated file to be parsed again, but it was parsed %d times", parsed)
+	}
+
+	if err := CleanCache(cacheDir); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("Expected cache to be removed but got %v", err)
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	files := []string{filepath.Join(dir, "liba.dylib"), filepath.Join(dir, "libb.dylib"), filepath.Join(dir, "libc.dylib")}
+	for _, file := range files {
+		writeTestMachO(t, file, testMachO{ID: "@rpath/" + filepath.Base(file)})
+	}
+
+	parsed := 0
+	cache := openTestCache(t, cacheDir, &parsed)
+	for _, file := range files[:2] {
+		if _, err := cache.ReadLoadInfo(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries of deleted files are removed when the cache is next saved
+	if err := os.Remove(files[0]); err != nil {
+		t.Fatal(err)
+	}
+	cache = openTestCache(t, cacheDir, &parsed)
+	if _, err := cache.ReadLoadInfo(files[2]); err != nil {
+		t.Fatal(err)
+	} else if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache = openTestCache(t, cacheDir, &parsed)
+	var entries []string
+	for file := range cache.entries {
+		entries = append(entries, file)
+	}
+	sort.Strings(entries)
+	if !reflect.DeepEqual(entries, files[1:]) {
+		t.Errorf("Expected the entries %v, but got %v", files[1:], entries)
+	}
+}
+
+func TestCacheInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, cacheFileName), []byte("{\"Version\": 0}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := OpenCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(cache.entries) != 0 {
+		t.Errorf("Expected an empty cache but got %d entries", len(cache.entries))
+	}
+}
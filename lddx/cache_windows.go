@@ -0,0 +1,9 @@
+package lddx
+
+import "os"
+
+// fileInode returns 0, as inodes are not available on Windows.
+// The cache entries are validated by size and modification time only.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
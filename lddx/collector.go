@@ -1,7 +1,7 @@
 package lddx
 
 import (
-	"fmt"
+	"context"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -17,6 +17,7 @@ type CollectorOptions struct {
 	ModifySpecialPaths bool     // Whether or not to modify paths beginnig with @, e.g. @executable_path
 	CollectFrameworks  bool     // Whether or not to also collect frameworks
 	Jobs               int      // Number of concurrent jobs
+	Logger             Logger   // The logger to use, or the default logger if nil
 }
 
 // getNiceness determines how preferred a string is (less is better,
@@ -37,12 +38,6 @@ func getNiceness(ent1, ent2 string, order []string) (int, int) {
 	return nice1, nice2
 }
 
-// isFrameworkLib determines if the file is likely a framework dylib.
-// They have no extensions. I think.
-func isFrameworkLib(file string) bool {
-	return filepath.Ext(file) == ""
-}
-
 func getTopDep(dep *Dependency, graph *DependencyGraph) *Dependency {
 	for _, topDep := range graph.TopDeps {
 		if dep.Name == topDep.Name && dep.Info == topDep.Info {
@@ -64,56 +59,113 @@ func copyFile(from, to string) error {
 	return nil
 }
 
-func collectorWorker(jobs <-chan *Dependency, results chan<- []string, graph *DependencyGraph, opts *CollectorOptions) {
-	var errList []string
+// loaderPath returns a path relative to @loader_path that refers
+// to the target from a library located at the given destination.
+func loaderPath(destination, target string) (string, error) {
+	rel, err := filepath.Rel(filepath.Dir(destination), target)
+	if err != nil {
+		return "", err
+	}
+	return "@loader_path/" + filepath.ToSlash(rel), nil
+}
+
+// collectorJob is a library to be collected, along with
+// the index of its result in the list of results.
+type collectorJob struct {
+	index int
+	dep   *Dependency
+}
+
+func collectorWorker(ctx context.Context, jobs <-chan collectorJob, results []*CollectorResult, done chan<- int, graph *DependencyGraph, opts *CollectorOptions, logger Logger) {
+	for job := range jobs {
+		dep := job.dep
+		result := &CollectorResult{}
+		results[job.index] = result
+		if ctx.Err() != nil {
+			done <- job.index
+			continue
+		}
 
-	for dep := range jobs {
-		LogInfo("Collecting for %s", dep.Path)
-		destination := filepath.Join(opts.Folder, dep.Name)
-		if err := copyFile(dep.RealPath, destination); err != nil {
-			errList = append(errList, fmt.Sprintf("Could not copy file %s [%s]: %s", dep.Path, dep.RealPath, err))
+		logger.Info("Collecting for %s", dep.Path)
+		destination := filepath.Join(opts.Folder, collectedPath(dep))
+		var err error
+		if isFrameworkLib(dep) {
+			err = copyFrameworkBundle(dep, opts.Folder)
 		} else {
-			out, err := exec.Command("install_name_tool", "-id", "@loader_path/"+dep.Name, destination).CombinedOutput()
+			err = copyFile(dep.RealPath, destination)
+		}
+
+		if err != nil {
+			result.add(newDiagnostic(logger, SeverityError, DiagCopyFailed, dep.Path, "",
+				"Could not copy file %s [%s]: %s", dep.Path, dep.RealPath, err))
+		} else {
+			// Frameworks keep their bundle layout, so the identity includes the path within the bundle
+			id := "@loader_path/" + filepath.ToSlash(collectedPath(dep))
+			out, err := exec.CommandContext(ctx, "install_name_tool", "-id", id, destination).CombinedOutput()
 			if err != nil {
-				errList = append(errList, fmt.Sprintf("Could not update identity for %s [%s]: %s [%s]", dep.Path, dep.RealPath, err, out))
+				result.add(newDiagnostic(logger, SeverityError, DiagInstallNameFailed, dep.Path, "",
+					"Could not update identity for %s [%s]: %s [%s]", dep.Path, dep.RealPath, err, out))
 			} else {
 				for _, subDep := range *dep.Deps {
 					var err error
-					patchedPath := "@loader_path/" + subDep.Name
+					var patchedPath string
 
 					if subDep.NotResolved || (subDep.Pruned && !subDep.PrunedByFlatDeps) {
 						continue
 					} else if !opts.ModifySpecialPaths && IsSpecialPath(subDep.Path) {
 						continue
 					} else if pTopDep := getTopDep(subDep, graph); pTopDep != nil {
-						rel, err := filepath.Rel(filepath.Dir(destination), pTopDep.Path)
-						if err != nil {
-							errList = append(errList, fmt.Sprintf("Could not get relative path from %s to %s (%s)", dep.Name, subDep.Name, subDep.RealPath))
-						}
-						patchedPath = "@loader_path/" + rel
-					} else if !opts.CollectFrameworks && isFrameworkLib(subDep.Name) {
+						patchedPath, err = loaderPath(destination, pTopDep.Path)
+					} else if !opts.CollectFrameworks && isFrameworkLib(subDep) {
 						continue
+					} else {
+						patchedPath, err = loaderPath(destination, filepath.Join(opts.Folder, collectedPath(subDep)))
 					}
 
-					if err == nil {
-						out, err := exec.Command("install_name_tool", "-change", subDep.Path, patchedPath, destination).CombinedOutput()
+					if err != nil {
+						result.add(newDiagnostic(logger, SeverityError, DiagRelativePathFailed, dep.Path, subDep.Path,
+							"Could not get relative path from %s to %s (%s)", dep.Name, subDep.Name, subDep.RealPath))
+					} else {
+						out, err := exec.CommandContext(ctx, "install_name_tool", "-change", subDep.Path, patchedPath, destination).CombinedOutput()
 						if err != nil {
-							errList = append(errList, fmt.Sprintf("Could not rewrite dep path for %s [%s]: %s [%s]", dep.Path, dep.RealPath, err, out))
+							result.add(newDiagnostic(logger, SeverityError, DiagInstallNameFailed, dep.Path, subDep.Path,
+								"Could not rewrite dep path for %s [%s]: %s [%s]", dep.Path, dep.RealPath, err, out))
 						}
 					}
 				}
+				result.Processed = append(result.Processed, dep)
 			}
 		}
-		results <- errList
+		done <- job.index
 	}
 }
 
+// CollectDeps collects the dependencies in the graph into the folder
+// specified by the options, fixing up the paths of each collected library.
+// If any library could not be collected, the returned error summarises the
+// errors; use CollectDepsContext for the diagnostics themselves.
 func CollectDeps(graph *DependencyGraph, opts *CollectorOptions) error {
+	_, err := CollectDepsContext(context.Background(), graph, opts)
+	return err
+}
+
+// CollectDepsContext collects the dependencies in the graph into the folder
+// specified by the options, returning the libraries that were collected and
+// the diagnostics. If any library could not be collected, the returned error
+// summarises the error diagnostics. If the context is cancelled, no further
+// libraries are collected, any running install_name_tool processes are killed
+// and the context's error is returned.
+func CollectDepsContext(ctx context.Context, graph *DependencyGraph, opts *CollectorOptions) (*CollectorResult, error) {
+	result := &CollectorResult{}
+	logger := orDefaultLogger(opts.Logger)
+	localOpts := *opts // Normalise the options without modifying the caller's
+	opts = &localOpts
+
 	// Create the output directory if it doesn't exist
 	if folder, err := filepath.Abs(opts.Folder); err != nil {
-		return err
+		return result, err
 	} else if err := os.MkdirAll(folder, 0755); err != nil {
-		return err
+		return result, err
 	} else {
 		opts.Folder = folder
 	}
@@ -123,46 +175,59 @@ func CollectDeps(graph *DependencyGraph, opts *CollectorOptions) error {
 	// 3: Handling deps that are part of the toplevel tree
 
 	// Determine which libraries to collect/fix
+	// The libraries are processed in order of their real path, so that
+	// conflicts are always resolved in the same way.
 	toCollect := make(map[string]*Dependency)
-	for _, dep := range graph.FlatDeps {
+	var collectOrder []string
+	for _, dep := range graph.SortedFlatDeps() {
 		if !opts.Overwrite {
-			if _, err := os.Stat(filepath.Join(opts.Folder, dep.Name)); err != nil {
+			if _, err := os.Stat(filepath.Join(opts.Folder, collectedPath(dep))); err != nil {
 				if !os.IsNotExist(err) {
-					LogWarn("Could not stat file [skipping]: %s", err)
+					result.add(newDiagnostic(logger, SeverityWarning, DiagStatFailed, dep.Path, "",
+						"Could not stat file [skipping]: %s", err))
 					continue
 				}
 			} else {
-				LogNote("Skipping %s as it exists in %s", dep.Name, opts.Folder)
+				result.add(newDiagnostic(logger, SeverityNote, DiagSkippedExisting, dep.Path, "",
+					"Skipping %s as it exists in %s", dep.Name, opts.Folder))
 				continue
 			}
 		}
 
 		if dep.NotResolved {
-			LogWarn("Not collecting unresolved dependency %s (%s)", dep.Name, dep.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagSkippedUnresolved, dep.Path, "",
+				"Not collecting unresolved dependency %s (%s)", dep.Name, dep.Path))
 			continue
 		} else if !opts.ModifySpecialPaths && IsSpecialPath(dep.Path) {
-			LogWarn("Not collecting/modifying @dependency %s (%s)", dep.Name, dep.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagSkippedSpecialPath, dep.Path, "",
+				"Not collecting/modifying @dependency %s (%s)", dep.Name, dep.Path))
 			continue
 		} else if getTopDep(dep, graph) != nil {
-			LogNote("Not collecting dependency that is a top-level dependency (Will fix path): %s (%s)", dep.Name, dep.Path)
+			result.add(newDiagnostic(logger, SeverityNote, DiagSkippedTopLevel, dep.Path, "",
+				"Not collecting dependency that is a top-level dependency (Will fix path): %s (%s)", dep.Name, dep.Path))
 			continue
-		} else if !opts.CollectFrameworks && isFrameworkLib(dep.Name) {
-			LogWarn("Not collecting framework dependency %s (%s)", dep.Name, dep.Path)
+		} else if !opts.CollectFrameworks && isFrameworkLib(dep) {
+			result.add(newDiagnostic(logger, SeverityWarning, DiagSkippedFramework, dep.Path, "",
+				"Not collecting framework dependency %s (%s)", dep.Name, dep.Path))
 			continue
 		}
 
 		// Check for conflicts and resolve, if possible
-		existing, ok := toCollect[dep.Name]
+		name := collectedName(dep)
+		existing, ok := toCollect[name]
 		if ok {
-			LogWarn("Library conflict: %s -- %s, attempting resolve", existing.Path, dep.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagLibraryConflict, dep.Path, existing.Path,
+				"Library conflict: %s -- %s, attempting resolve", existing.Path, dep.Path))
 			n1, n2 := getNiceness(existing.Path, dep.Path, opts.PreferredOrder)
 			if n2 >= 0 && (n1 < 0 || n2 < n1) {
 				// We have a better entry, use this one instead
-				LogNote("Preferred %s over %s", dep.Path, existing.Path)
-				toCollect[dep.Name] = dep
+				result.add(newDiagnostic(logger, SeverityNote, DiagConflictResolved, dep.Path, existing.Path,
+					"Preferred %s over %s", dep.Path, existing.Path))
+				toCollect[name] = dep
 			}
 		} else {
-			toCollect[dep.Name] = dep
+			toCollect[name] = dep
+			collectOrder = append(collectOrder, name)
 		}
 	}
 
@@ -171,55 +236,98 @@ func CollectDeps(graph *DependencyGraph, opts *CollectorOptions) error {
 		opts.Jobs = 1
 	}
 
-	jobs := make(chan *Dependency, opts.Jobs)
-	results := make(chan []string, len(toCollect))
+	jobs := make(chan collectorJob, opts.Jobs)
+	results := make([]*CollectorResult, len(collectOrder))
+	done := make(chan int, len(collectOrder))
 	for i := 0; i < opts.Jobs; i++ {
-		go collectorWorker(jobs, results, graph, opts)
+		go collectorWorker(ctx, jobs, results, done, graph, opts, logger)
 	}
 
-	for _, dep := range toCollect {
-		jobs <- dep
+	numJobs := 0
+	for i, name := range collectOrder {
+		select {
+		case jobs <- collectorJob{index: i, dep: toCollect[name]}:
+			numJobs++
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
 	}
 	close(jobs)
 
-	var errors []string
-	for range toCollect {
-		errors = append(errors, <-results...)
+	// Merge the results in the order that the jobs were submitted
+	for i := 0; i < numJobs; i++ {
+		<-done
 	}
-
-	if errors != nil {
-		return fmt.Errorf(strings.Join(errors, "\n"))
+	for _, jobResult := range results[:numJobs] {
+		result.Processed = append(result.Processed, jobResult.Processed...)
+		result.Diagnostics = append(result.Diagnostics, jobResult.Diagnostics...)
 	}
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, result.err()
 }
 
+// FixupToplevels updates the top-level files in the graph so that they
+// refer to the collected dependencies. If any file could not be fixed, the
+// returned error summarises the errors; use FixupToplevelsContext for the
+// diagnostics themselves.
 func FixupToplevels(graph *DependencyGraph, opts *CollectorOptions) error {
+	_, err := FixupToplevelsContext(context.Background(), graph, opts)
+	return err
+}
+
+// FixupToplevelsContext updates the top-level files in the graph so that they
+// refer to the collected dependencies, returning the files that were fixed and
+// the diagnostics. If any file could not be fixed, the returned error
+// summarises the error diagnostics. If the context is cancelled, any running
+// install_name_tool processes are killed and the context's error is returned.
+func FixupToplevelsContext(ctx context.Context, graph *DependencyGraph, opts *CollectorOptions) (*CollectorResult, error) {
+	result := &CollectorResult{}
+	logger := orDefaultLogger(opts.Logger)
+	folder, err := filepath.Abs(opts.Folder)
+	if err != nil {
+		return result, err
+	}
+
 	for _, ent := range graph.TopDeps {
-		LogInfo("Fixing top-level %s", ent.Name)
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		logger.Info("Fixing top-level %s", ent.Name)
 		if ent.NotResolved {
-			LogWarn("Not fixing unresolved toplevel %s", ent.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagSkippedUnresolved, ent.Path, "",
+				"Not fixing unresolved toplevel %s", ent.Path))
 			continue
 		} else if info, err := os.Lstat(ent.Path); err != nil {
-			LogWarn("Cannot lstat %s, skipping", ent.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagStatFailed, ent.Path, "",
+				"Cannot lstat %s, skipping", ent.Path))
 			continue
 		} else if (info.Mode() & os.ModeSymlink) != 0 {
-			LogNote("Skipping over symlink %s", ent.Path)
+			result.add(newDiagnostic(logger, SeverityNote, DiagSkippedSymlink, ent.Path, "",
+				"Skipping over symlink %s", ent.Path))
 			continue
 		} else if info, err := os.Stat(ent.RealPath); err != nil {
-			LogWarn("Cannot stat %s, skipping", ent.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagStatFailed, ent.Path, "",
+				"Cannot stat %s, skipping", ent.Path))
 			continue
 		} else if err := os.Chmod(ent.RealPath, info.Mode()|0700); err != nil {
-			LogWarn("Cannot make %s writeable, skipping", ent.Path)
+			result.add(newDiagnostic(logger, SeverityWarning, DiagTopLevelNotWritable, ent.Path, "",
+				"Cannot make %s writeable, skipping", ent.Path))
 			continue
 		}
 
-		if out, err := exec.Command("install_name_tool", "-id", "@loader_path/"+ent.Name, ent.RealPath).CombinedOutput(); err != nil {
-			LogError("Could not update dep id: %s [%s]", err, out)
+		if out, err := exec.CommandContext(ctx, "install_name_tool", "-id", "@loader_path/"+ent.Name, ent.RealPath).CombinedOutput(); err != nil {
+			result.add(newDiagnostic(logger, SeverityError, DiagInstallNameFailed, ent.Path, "",
+				"Could not update dep id: %s [%s]", err, out))
 		}
 
 		for _, subDep := range *ent.Deps {
-			depPath := filepath.Join(opts.Folder, subDep.Name)
+			depPath := filepath.Join(folder, collectedPath(subDep))
 
 			if subDep.NotResolved || (subDep.Pruned && !subDep.PrunedByFlatDeps) {
 				continue
@@ -227,20 +335,27 @@ func FixupToplevels(graph *DependencyGraph, opts *CollectorOptions) error {
 				continue
 			} else if pTopDep := getTopDep(subDep, graph); pTopDep != nil {
 				depPath = pTopDep.RealPath
-			} else if !opts.CollectFrameworks && isFrameworkLib(subDep.Name) {
+			} else if !opts.CollectFrameworks && isFrameworkLib(subDep) {
 				continue
 			}
 
-			rel, err := filepath.Rel(filepath.Dir(ent.RealPath), depPath)
+			patchedPath, err := loaderPath(ent.RealPath, depPath)
 			if err != nil {
-				LogWarn("Could not determine relative path to dep %s: %s", ent.RealPath, err)
+				result.add(newDiagnostic(logger, SeverityWarning, DiagRelativePathFailed, ent.Path, subDep.Path,
+					"Could not determine relative path to dep %s: %s", ent.RealPath, err))
 				continue
 			}
-			out, err := exec.Command("install_name_tool", "-change", subDep.Path, "@loader_path/"+rel, ent.RealPath).CombinedOutput()
+			out, err := exec.CommandContext(ctx, "install_name_tool", "-change", subDep.Path, patchedPath, ent.RealPath).CombinedOutput()
 			if err != nil {
-				LogError("Could not rewrite dep path: %s [%s]", err, out)
+				result.add(newDiagnostic(logger, SeverityError, DiagInstallNameFailed, ent.Path, subDep.Path,
+					"Could not rewrite dep path: %s [%s]", err, out))
 			}
 		}
+		result.Processed = append(result.Processed, ent)
 	}
-	return nil
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, result.err()
 }
@@ -0,0 +1,157 @@
+package lddx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTestCollectorGraph reads a main executable with a single library to collect.
+func readTestCollectorGraph(t *testing.T) (string, *DependencyGraph) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{Dylibs: []string{"@loader_path/lib/liba.dylib"}})
+	writeTestMachO(t, filepath.Join(dir, "lib", "liba.dylib"), testMachO{ID: "@rpath/liba.dylib"})
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, graph
+}
+
+func hasDiagnostic(diags []Diagnostic, code DiagnosticCode) bool {
+	for _, diag := range diags {
+		if diag.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCollectorErrors(t *testing.T) {
+	dir, graph := readTestCollectorGraph(t)
+	fakeInstallNameTool(t, "exit 1")
+
+	opts := CollectorOptions{Folder: filepath.Join(dir, "out"), ModifySpecialPaths: true, Overwrite: true}
+	result, err := CollectDepsContext(context.Background(), graph, &opts)
+	if err == nil || !hasDiagnostic(result.Diagnostics, DiagInstallNameFailed) {
+		t.Errorf("Expected an error from collecting, but got %v and %v", err, result.Diagnostics)
+	}
+	result, err = FixupToplevelsContext(context.Background(), graph, &opts)
+	if err == nil || !hasDiagnostic(result.Diagnostics, DiagInstallNameFailed) {
+		t.Errorf("Expected an error from fixing the top-level files, but got %v and %v", err, result.Diagnostics)
+	}
+
+	if err := CollectDeps(graph, &opts); err == nil {
+		t.Errorf("Expected CollectDeps to return the error")
+	}
+	if err := FixupToplevels(graph, &opts); err == nil {
+		t.Errorf("Expected FixupToplevels to return the error")
+	}
+}
+
+func TestCollectorSuccess(t *testing.T) {
+	dir, graph := readTestCollectorGraph(t)
+	log := fakeInstallNameTool(t, "exit 0")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// The caller's options are left unchanged
+	opts := CollectorOptions{Folder: "out", ModifySpecialPaths: true, Overwrite: true}
+	if err := CollectDeps(graph, &opts); err != nil {
+		t.Error(err)
+	}
+	if err := FixupToplevels(graph, &opts); err != nil {
+		t.Error(err)
+	}
+	if opts.Folder != "out" || opts.Jobs != 0 {
+		t.Errorf("Expected the options to be unchanged, but got folder %s and %d jobs", opts.Folder, opts.Jobs)
+	}
+
+	out, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-change @loader_path/lib/liba.dylib @loader_path/out/liba.dylib " + filepath.Join(dir, "main")
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("Expected the top-level file to refer to the collected library, but got\n%s", out)
+	}
+}
+
+func TestCollectFrameworkID(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "Frameworks", "Foo.framework")
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{Dylibs: []string{"@loader_path/Frameworks/Foo.framework/Versions/A/Foo"}})
+	writeTestMachO(t, filepath.Join(bundle, "Versions", "A", "Foo"), testMachO{ID: "@rpath/Foo.framework/Versions/A/Foo"})
+	if err := os.Symlink("A", filepath.Join(bundle, "Versions", "Current")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Symlink("Versions/Current/Foo", filepath.Join(bundle, "Foo")); err != nil {
+		t.Fatal(err)
+	}
+	log := fakeInstallNameTool(t, "exit 0")
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	opts := CollectorOptions{Folder: out, ModifySpecialPaths: true, CollectFrameworks: true, Overwrite: true}
+	if err := CollectDeps(graph, &opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-id @loader_path/Foo.framework/Versions/A/Foo " + filepath.Join(out, "Foo.framework", "Versions", "A", "Foo")
+	if !strings.Contains(string(data), expected+"\n") {
+		t.Errorf("Expected install_name_tool %s, but got:\n%s", expected, data)
+	}
+}
+
+func TestCollectDepsContextCancelled(t *testing.T) {
+	dir, graph := readTestCollectorGraph(t)
+	// The process is replaced by sleep, so that it is sleep that is killed
+	log := fakeInstallNameTool(t, "exec sleep 30")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		// Cancel once install_name_tool is running
+		for {
+			if _, err := os.Stat(log); err == nil {
+				cancel()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	start := time.Now()
+	opts := CollectorOptions{Folder: filepath.Join(dir, "out"), ModifySpecialPaths: true, Overwrite: true}
+	if _, err := CollectDepsContext(ctx, graph, &opts); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected install_name_tool to be killed, but collecting took %s", elapsed)
+	}
+}
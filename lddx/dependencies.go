@@ -1,6 +1,7 @@
 package lddx
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,9 +16,17 @@ type DependencyOptions struct {
 	ExecutablePath  string
 	IgnoredPrefixes []string
 	IgnoredFiles    []string
+	IgnoreRules     []*IgnoreRule // Glob or regex rules for dependencies to ignore
 	Recursive       bool
 	SkipWeakLibs    bool
 	Jobs            int
+	Logger          Logger // The logger to use, or the default logger if nil
+	Cache           *Cache // The cache of load information to use, if not nil
+
+	// OnRead is called as soon as the dependencies of each file have been read,
+	// if not nil. It is never called concurrently, but the order of the calls
+	// depends on the order in which the files are read.
+	OnRead func(dep *Dependency, topLevel bool)
 }
 
 // Dependency contains information about a file and any
@@ -28,11 +37,21 @@ type Dependency struct {
 	RealPath         string         // The real path to the library, if available (or same as Path)
 	Info             string         // Compatibility and current version info
 	Pruned           bool           // Indicates if checking the dependencies of this library were skipped
+	PrunedBy         string         // The option or ignore rule that caused this library to be pruned, if any
 	PrunedByFlatDeps bool           // Indicates if the libs were removed because they were listed in another subtree (for JSON serialisation only)
 	NotResolved      bool           // Indicates if the dependencies could not be resolved (could not determine dependencies)
 	IsWeakDep        bool           // Indicates if this dependency is from a weak load command
+	Framework        string         // The name of the framework bundle, if this library is a framework binary
+	FrameworkVersion string         // The version of the framework bundle (e.g. A), if versioned
+	Origin           Origin         // The package manager (or system) that installed the library, if known
+	Package          string         // The name of the package that installed the library, if known
+	PackageVersion   string         // The version of the package that installed the library, if known
 	Deps             *[]*Dependency // List of dependencies that this dependency depends on. Ugh we need these pointers because multiple Dependencies can share this.
 	RPaths           []string       // The rpaths associated with this file
+	ID               string         // The install name of the library itself (from LC_ID_DYLIB), if available
+	IDInfo           string         // Compatibility and current version info of the library itself, if available
+	UUIDs            []string       // The Mach-O UUIDs of the file, one per architecture
+	Arches           []string       // The architectures of the file (e.g. x86_64 or arm64)
 }
 
 // ByPath sorts a Dependency slice by the Path field
@@ -56,15 +75,78 @@ func (v ByPath) Less(i, j int) bool {
 // DependencyGraph contains information about the dependencies
 // for a collection of files.
 type DependencyGraph struct {
-	TopDeps  []*Dependency          // Slice of top level dependencies
-	FlatDeps map[string]*Dependency // Contains all unique, non-pruned referenced dependencies
-	fdLock   sync.RWMutex           // Used to control concurrent access to FlatDeps
+	TopDeps     []*Dependency          // Slice of top level dependencies
+	FlatDeps    map[string]*Dependency // Contains all unique, non-pruned referenced dependencies
+	Diagnostics []Diagnostic           // Notable outcomes of calculating the dependencies
+	fdLock      sync.RWMutex           // Used to control concurrent access to FlatDeps
+	diagLock    sync.Mutex             // Used to control concurrent access to Diagnostics and reads
+	origins     *originClassifier      // Used to classify the origin of each resolved library
+	reads       map[string]*fileRead   // What was read from each real path, if recorded for DepsWatch
+}
+
+// fileRead records what was read from a file, so that DepsWatch can reuse it
+// while neither the file nor the paths that its libraries may be found at change.
+type fileRead struct {
+	dep         *Dependency  // The dependency that was read, with its dependencies
+	diagnostics []Diagnostic // The diagnostics from reading the file
+	paths       []string     // The paths at which its libraries were looked for
+}
+
+// fileRead returns the record of what was read from the real path, adding it
+// if needed. The caller must hold diagLock.
+func (graph *DependencyGraph) fileRead(realPath string) *fileRead {
+	read, ok := graph.reads[realPath]
+	if !ok {
+		read = &fileRead{}
+		graph.reads[realPath] = read
+	}
+	return read
+}
+
+// recordRead records that the dependency was read, if reads are recorded.
+func (graph *DependencyGraph) recordRead(dep *Dependency, paths []string) {
+	graph.diagLock.Lock()
+	defer graph.diagLock.Unlock()
+	if graph.reads != nil {
+		read := graph.fileRead(dep.RealPath)
+		read.dep = dep
+		read.paths = paths
+	}
 }
 
 func IsSpecialPath(path string) bool {
 	return strings.HasPrefix(path, "@")
 }
 
+// candidatePaths returns the paths that resolvePath may look for the library at.
+func candidatePaths(path string, dep *Dependency, opts *DependencyOptions) []string {
+	expand := func(path string) (string, bool) {
+		if strings.HasPrefix(path, "@executable_path/") {
+			return opts.ExecutablePath + path[len("@executable_path"):], opts.ExecutablePath != ""
+		} else if strings.HasPrefix(path, "@loader_path/") {
+			return filepath.Dir(dep.RealPath) + path[len("@loader_path"):], true
+		}
+		return path, !IsSpecialPath(path)
+	}
+
+	var ret []string
+	add := func(path string) {
+		if absPath, err := filepath.Abs(path); err == nil {
+			ret = append(ret, absPath)
+		}
+	}
+	if strings.HasPrefix(path, "@rpath/") {
+		for _, rpath := range dep.RPaths {
+			if candidate, ok := expand(rpath + path[len("@rpath"):]); ok {
+				add(candidate)
+			}
+		}
+	} else if candidate, ok := expand(path); ok {
+		add(candidate)
+	}
+	return ret
+}
+
 func resolvePath(path string, dep *Dependency, opts *DependencyOptions) (string, error) {
 	if IsSpecialPath(path) {
 		if strings.HasPrefix(path, "@executable_path/") {
@@ -78,12 +160,12 @@ func resolvePath(path string, dep *Dependency, opts *DependencyOptions) (string,
 			found := false
 			for _, rpath := range dep.RPaths {
 				if testPath, err := resolvePath(rpath+path[len("@rpath"):], dep, opts); err != nil {
-					LogWarn("Could not resolve %s with rpath of %s: %v", path, rpath, err)
+					opts.Logger.Warn("Could not resolve %s with rpath of %s: %v", path, rpath, err)
 				} else {
 					if _, err := os.Stat(testPath); os.IsNotExist(err) {
-						LogNote("%s not found with rpath %s at %s", path, rpath, testPath)
+						opts.Logger.Note("%s not found with rpath %s at %s", path, rpath, testPath)
 					} else {
-						LogNote("Resolved %s to %s using rpath %s", path, testPath, rpath)
+						opts.Logger.Note("Resolved %s to %s using rpath %s", path, testPath, rpath)
 						path = testPath
 						found = true
 						break
@@ -101,12 +183,40 @@ func resolvePath(path string, dep *Dependency, opts *DependencyOptions) (string,
 	return ResolveAbsPath(path)
 }
 
-func matchesIgnoredPrefixes(path string, opts *DependencyOptions) bool {
+// formatVersionInfo formats the compatibility and current version of a library.
+func formatVersionInfo(lib *Dylib) string {
+	return fmt.Sprintf("compatibility version %d.%d.%d, current version %d.%d.%d",
+		lib.CompatVersion>>16, (lib.CompatVersion>>8)&0xff, lib.CompatVersion&0xff,
+		lib.CurrentVersion>>16, (lib.CurrentVersion>>8)&0xff, lib.CurrentVersion&0xff)
+}
+
+// setFrameworkInfo fills in the framework fields of the dependency,
+// if it refers to the binary of a framework bundle.
+func setFrameworkInfo(dep *Dependency) {
+	if fw, ok := getFrameworkPath(dep); ok {
+		dep.Framework = fw.Name
+		dep.FrameworkVersion = fw.Version
+	}
+}
+
+// matchIgnoredPrefixes returns the ignored prefix that the path starts with, if any.
+func matchIgnoredPrefixes(path string, opts *DependencyOptions) (string, bool) {
 	for _, prefix := range opts.IgnoredPrefixes {
 		if strings.HasPrefix(path, prefix) {
-			return true
+			return prefix, true
 		}
 	}
+	return "", false
+}
+
+// pruneByRule prunes the dependency if the field matches one of the ignore rules.
+func pruneByRule(dep *Dependency, target IgnoreTarget, value string, opts *DependencyOptions) bool {
+	if rule := matchIgnoreRules(opts.IgnoreRules, target, value); rule != nil {
+		opts.Logger.Note("Pruned %s (%s) by ignore rule %s", dep.Path, value, rule)
+		dep.Pruned = true
+		dep.PrunedBy = "rule:" + rule.String()
+		return true
+	}
 	return false
 }
 
@@ -114,18 +224,17 @@ func matchesIgnoredPrefixes(path string, opts *DependencyOptions) bool {
 // dependency meets pruning criteria, and if so, prunes the given dependency.
 func pruneDep(lib *Dylib, parent *Dependency, graph *DependencyGraph, opts *DependencyOptions) (*Dependency, bool) {
 	ret := &Dependency{
-		Name:     filepath.Base(lib.Path),
-		Path:     lib.Path,
-		RealPath: lib.Path,
-		Info: fmt.Sprintf("compatibility version %d.%d.%d, current version %d.%d.%d",
-			lib.CompatVersion>>16, (lib.CompatVersion>>8)&0xff, lib.CompatVersion&0xff,
-			lib.CurrentVersion>>16, (lib.CurrentVersion>>8)&0xff, lib.CurrentVersion&0xff),
+		Name:      filepath.Base(lib.Path),
+		Path:      lib.Path,
+		RealPath:  lib.Path,
+		Info:      formatVersionInfo(lib),
 		IsWeakDep: lib.Weak,
 	}
 
 	// Check if we skip weak libs
 	if lib.Weak && opts.SkipWeakLibs {
 		ret.Pruned = true
+		ret.PrunedBy = "skip-weak"
 		return ret, true
 	}
 
@@ -133,10 +242,16 @@ func pruneDep(lib *Dylib, parent *Dependency, graph *DependencyGraph, opts *Depe
 	for _, name := range opts.IgnoredFiles {
 		if ret.Name == name {
 			ret.Pruned = true
+			ret.PrunedBy = "ignore-file:" + name
 			return ret, true
 		}
 	}
 
+	// Check if the name or install name matches an ignore rule.
+	if pruneByRule(ret, IgnoreTargetName, ret.Name, opts) || pruneByRule(ret, IgnoreTargetInstallName, ret.Path, opts) {
+		return ret, true
+	}
+
 	// The toplevel dependencies may not be in FlatDeps.
 	// Check for a circular dependency here.
 	for _, topDep := range graph.TopDeps {
@@ -154,21 +269,49 @@ func pruneDep(lib *Dylib, parent *Dependency, graph *DependencyGraph, opts *Depe
 	// We now need to get the real path to the file.
 	realPath, err := resolvePath(lib.Path, parent, opts)
 	if err != nil {
-		LogWarn("Could not resolve dependency %s for %s: %s (weak: %v)",
-			lib.Path, parent.Path, err, lib.Weak)
+		code := DiagUnresolvedDependency
+		if strings.HasPrefix(lib.Path, "@rpath/") {
+			code = DiagUnresolvedRPath
+		}
+		// The parent is identified by its real path, as it may be referenced by several paths
+		graph.addDiagnostic(parent.RealPath, newDiagnostic(opts.Logger, SeverityWarning, code, parent.RealPath, lib.Path,
+			"Could not resolve dependency %s for %s: %s (weak: %v)", lib.Path, parent.RealPath, err, lib.Weak))
 		ret.NotResolved = true
+		setFrameworkInfo(ret)
 		return ret, true
 	} else if realPath != lib.Path {
 		ret.RealPath = realPath
 	}
+	setFrameworkInfo(ret)
 
 	// Check if the path matches an ignored prefix.
-	if matchesIgnoredPrefixes(ret.Path, opts) || (ret.Path != ret.RealPath && matchesIgnoredPrefixes(ret.RealPath, opts)) {
+	if prefix, ok := matchIgnoredPrefixes(ret.Path, opts); ok {
 		ret.Pruned = true
+		ret.PrunedBy = "ignore-prefix:" + prefix
+		return ret, true
+	} else if prefix, ok := matchIgnoredPrefixes(ret.RealPath, opts); ok && ret.Path != ret.RealPath {
+		ret.Pruned = true
+		ret.PrunedBy = "ignore-prefix:" + prefix
+		return ret, true
+	}
+
+	// Check if the real path matches an ignore rule.
+	if pruneByRule(ret, IgnoreTargetRealPath, ret.RealPath, opts) {
 		return ret, true
 	}
 
-	// Now we need to check if the dep has already been processed or not.
+	// The origin is classified once per real path, and shared by normaliseGraph
+	ret, pruned := addFlatDep(ret, graph)
+	if !pruned {
+		setOriginInfo(ret, graph.origins)
+	}
+	return ret, pruned
+}
+
+// addFlatDep adds the dependency to FlatDeps if its real path has not been
+// processed yet, returning false as it needs to be read. Otherwise, it shares
+// the dependencies of the existing entry.
+func addFlatDep(ret *Dependency, graph *DependencyGraph) (*Dependency, bool) {
 	graph.fdLock.Lock()
 	defer graph.fdLock.Unlock()
 
@@ -185,20 +328,44 @@ func pruneDep(lib *Dylib, parent *Dependency, graph *DependencyGraph, opts *Depe
 	}
 }
 
-func depsRead(dep *Dependency, graph *DependencyGraph, opts *DependencyOptions, limiter chan int, wg *sync.WaitGroup) {
-	if wg != nil {
-		defer wg.Done()
+// readLoadInfo reads the load information of the file, using the cache if there is one.
+func readLoadInfo(file string, opts *DependencyOptions) (*LoadInfo, error) {
+	if opts.Cache != nil {
+		return opts.Cache.ReadLoadInfo(file)
+	}
+	return ReadLoadInfo(file, nil)
+}
+
+// depsRead reads the dependencies of the given dependency, returning
+// the subdependencies that have not been read yet. The load information
+// is read from the file, unless it has already been read.
+func depsRead(ctx context.Context, dep *Dependency, info *LoadInfo, graph *DependencyGraph, opts *DependencyOptions) []*Dependency {
+	if ctx.Err() != nil {
+		return nil
 	}
 
-	libs, rpaths, err := ReadDylibs(dep.RealPath, limiter)
+	var err error
+	if info == nil {
+		info, err = readLoadInfo(dep.RealPath, opts)
+	}
 	if err != nil {
-		LogError("Could not get libs for %s [%s]: %s", dep.Path, dep.RealPath, err)
+		graph.addDiagnostic(dep.RealPath, newDiagnostic(opts.Logger, SeverityError, DiagReadFailed, dep.RealPath, "",
+			"Could not get libs for %s: %s", dep.RealPath, err))
 		dep.NotResolved = true
-		return
+		graph.recordRead(dep, nil)
+		return nil
+	}
+	libs := info.Dylibs
+	dep.RPaths = info.RPaths
+	dep.UUIDs = info.UUIDs
+	dep.Arches = info.Arches
+	if len(info.IDs) > 0 {
+		dep.ID = info.IDs[0].Path
+		dep.IDInfo = formatVersionInfo(&info.IDs[0])
 	}
-	dep.RPaths = rpaths
 
 	var depsToProcess []*Dependency
+	var paths []string
 	observedDeps := make(map[string]bool)
 	for _, lib := range libs {
 		// Only process any dep once.
@@ -213,40 +380,193 @@ func depsRead(dep *Dependency, graph *DependencyGraph, opts *DependencyOptions,
 		if !pruned {
 			depsToProcess = append(depsToProcess, subDep)
 		}
+		if graph.reads != nil && !subDep.Pruned {
+			paths = append(paths, candidatePaths(lib.Path, dep, opts)...)
+		}
 	}
 
 	sort.Sort(ByPath(*dep.Deps))
+	graph.recordRead(dep, paths)
+	return depsToProcess
+}
 
-	if opts.Recursive {
-		for _, subDep := range depsToProcess {
-			if wg == nil {
-				depsRead(subDep, graph, opts, limiter, wg)
-			} else {
-				wg.Add(1)
-				go depsRead(subDep, graph, opts, limiter, wg)
-			}
+// reuseRead recreates the dependencies of the given dependency from what was
+// read from the file before, as depsRead would, without reading the file or
+// resolving its libraries again. Returns the subdependencies that have not
+// been read yet.
+func reuseRead(dep *Dependency, read *fileRead, graph *DependencyGraph) []*Dependency {
+	prev := read.dep
+	dep.NotResolved = dep.NotResolved || prev.NotResolved
+	dep.RPaths = prev.RPaths
+	dep.UUIDs = prev.UUIDs
+	dep.Arches = prev.Arches
+	dep.ID = prev.ID
+	dep.IDInfo = prev.IDInfo
+
+	var depsToProcess []*Dependency
+	for _, prevSubDep := range *prev.Deps {
+		subDep := &Dependency{
+			Name:             prevSubDep.Name,
+			Path:             prevSubDep.Path,
+			RealPath:         prevSubDep.RealPath,
+			Info:             prevSubDep.Info,
+			Pruned:           prevSubDep.Pruned,
+			PrunedBy:         prevSubDep.PrunedBy,
+			NotResolved:      prevSubDep.NotResolved && prevSubDep.Deps == nil,
+			IsWeakDep:        prevSubDep.IsWeakDep,
+			Framework:        prevSubDep.Framework,
+			FrameworkVersion: prevSubDep.FrameworkVersion,
+			Origin:           prevSubDep.Origin,
+			Package:          prevSubDep.Package,
+			PackageVersion:   prevSubDep.PackageVersion,
+		}
+
+		// Only the libraries that were added to FlatDeps have their dependencies listed
+		pruned := true
+		if prevSubDep.Deps != nil {
+			subDep, pruned = addFlatDep(subDep, graph)
+		}
+		*dep.Deps = append(*dep.Deps, subDep)
+		if !pruned {
+			depsToProcess = append(depsToProcess, subDep)
+		}
+	}
+
+	for _, diag := range read.diagnostics {
+		graph.addDiagnostic(dep.RealPath, diag)
+	}
+	graph.recordRead(dep, read.paths)
+	return depsToProcess
+}
+
+// depsReader reads the dependencies of a graph with a fixed pool of workers,
+// which take the dependencies to read from a shared queue. Each real path is
+// only read once, as pruneDep only returns a dependency to be read the first
+// time that its real path is added to FlatDeps.
+type depsReader struct {
+	ctx     context.Context
+	graph   *DependencyGraph
+	opts    *DependencyOptions
+	loaded  map[*Dependency]*LoadInfo // The load information already read for the top-level files
+	reuse   map[string]*fileRead      // What was read before from the files that have not changed, by real path
+	queue   []*Dependency             // The dependencies waiting to be read
+	pending int                       // The number of dependencies waiting to be or being read
+	lock    sync.Mutex
+	cond    *sync.Cond
+	onRead  sync.Mutex // Used to serialise calls to OnRead
+}
+
+// next waits for a dependency to read. Returns false once every dependency
+// has been read, or the context has been cancelled.
+func (r *depsReader) next() (*Dependency, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for len(r.queue) == 0 && r.pending > 0 && r.ctx.Err() == nil {
+		r.cond.Wait()
+	}
+	if len(r.queue) == 0 || r.ctx.Err() != nil {
+		return nil, false
+	}
+
+	dep := r.queue[0]
+	r.queue[0] = nil
+	r.queue = r.queue[1:]
+	return dep, true
+}
+
+// done marks a dependency as read, queueing its subdependencies if recursive.
+func (r *depsReader) done(subDeps []*Dependency) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.pending--
+	if r.opts.Recursive && r.ctx.Err() == nil {
+		r.queue = append(r.queue, subDeps...)
+		r.pending += len(subDeps)
+	}
+	r.cond.Broadcast()
+}
+
+func (r *depsReader) worker() {
+	for {
+		dep, ok := r.next()
+		if !ok {
+			return
 		}
+		if read, ok := r.reuse[dep.RealPath]; ok && r.ctx.Err() == nil {
+			r.done(reuseRead(dep, read, r.graph))
+			continue
+		}
+
+		info, topLevel := r.loaded[dep]
+		subDeps := depsRead(r.ctx, dep, info, r.graph, r.opts)
+		if r.opts.OnRead != nil && r.ctx.Err() == nil {
+			r.onRead.Lock()
+			r.opts.OnRead(dep, topLevel)
+			r.onRead.Unlock()
+		}
+		r.done(subDeps)
+	}
+}
+
+// run reads the dependencies of the top-level files with the given number of workers.
+func (r *depsReader) run(jobs int) {
+	r.cond = sync.NewCond(&r.lock)
+	r.queue = append(r.queue, r.graph.TopDeps...)
+	r.pending = len(r.queue)
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.worker()
+		}()
 	}
+	wg.Wait()
 }
 
 // DepsRead calculates the dependency graph for the list of files provided.
 func DepsRead(opts DependencyOptions, files ...string) (*DependencyGraph, error) {
+	return DepsReadContext(context.Background(), opts, files...)
+}
+
+// DepsReadContext calculates the dependency graph for the list of files provided.
+// If the context is cancelled, no further files are processed and the
+// context's error is returned.
+func DepsReadContext(ctx context.Context, opts DependencyOptions, files ...string) (*DependencyGraph, error) {
+	return depsReadReusing(ctx, opts, nil, files...)
+}
+
+// depsReadReusing calculates the dependency graph for the list of files
+// provided, reusing what was read before from the real paths in reuse instead
+// of reading them again. If reuse is not nil, what is read from each file is
+// recorded in the graph, to be reused in turn.
+func depsReadReusing(ctx context.Context, opts DependencyOptions, reuse map[string]*fileRead, files ...string) (*DependencyGraph, error) {
+	opts.Logger = orDefaultLogger(opts.Logger)
 	var deps []*Dependency
 	seenFiles := make(map[string]bool)
+	loaded := make(map[*Dependency]*LoadInfo)
+	origins := newOriginClassifier()
 
 	// Reduce the file list to make it unique by the absolute path
 	for _, file := range files {
-		var info []Dylib
+		var info *LoadInfo
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		absPath, err := ResolveAbsPath(file)
 
 		if err != nil {
 			return nil, err
-		} else if isfm, err := IsFatMachO(file); err != nil {
-			return nil, err
-		} else if !isfm {
-			return nil, fmt.Errorf("%s: Not a Mach-O/Universal binary", file)
-		} else if info, err = GetDylibInfo(absPath); err != nil {
-			return nil, err
+		} else if info, err = readLoadInfo(absPath, &opts); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
 		}
 
 		if !seenFiles[file] {
@@ -259,13 +579,14 @@ func DepsRead(opts DependencyOptions, files ...string) (*DependencyGraph, error)
 			if absPath != file {
 				dep.RealPath = absPath
 			}
-			if info != nil {
+			setFrameworkInfo(dep)
+			setOriginInfo(dep, origins)
+			if len(info.IDs) > 0 {
 				// FIXME: We only choose the first value...
-				dep.Info = fmt.Sprintf("compatibility version %d.%d.%d, current version %d.%d.%d",
-					info[0].CompatVersion>>16, (info[0].CompatVersion>>8)&0xff, info[0].CompatVersion&0xff,
-					info[0].CurrentVersion>>16, (info[0].CurrentVersion>>8)&0xff, info[0].CurrentVersion&0xff)
+				dep.Info = formatVersionInfo(&info.IDs[0])
 			}
 			deps = append(deps, dep)
+			loaded[dep] = info
 			seenFiles[file] = true
 		}
 	}
@@ -277,27 +598,99 @@ func DepsRead(opts DependencyOptions, files ...string) (*DependencyGraph, error)
 	graph := &DependencyGraph{
 		TopDeps:  deps,
 		FlatDeps: make(map[string]*Dependency),
+		origins:  origins,
+	}
+	if reuse != nil {
+		graph.reads = make(map[string]*fileRead)
 	}
 
-	if !opts.Recursive || opts.Jobs <= 1 {
-		for _, dep := range graph.TopDeps {
-			depsRead(dep, graph, &opts, nil, nil)
+	reader := &depsReader{ctx: ctx, graph: graph, opts: &opts, loaded: loaded, reuse: reuse}
+	reader.run(opts.Jobs)
+
+	if opts.Cache != nil {
+		if err := opts.Cache.Save(); err != nil {
+			opts.Logger.Warn("%s", err)
 		}
-	} else {
-		var wg sync.WaitGroup
-		limiter := make(chan int, opts.Jobs)
-		for i := 0; i < opts.Jobs; i++ {
-			limiter <- 1
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	normaliseGraph(graph)
+	return graph, nil
+}
+
+// SortedFlatDeps returns the unique, non-pruned dependencies sorted by their real path.
+func (graph *DependencyGraph) SortedFlatDeps() []*Dependency {
+	ret := make([]*Dependency, 0, len(graph.FlatDeps))
+	for _, dep := range graph.FlatDeps {
+		ret = append(ret, dep)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].RealPath < ret[j].RealPath
+	})
+	return ret
+}
+
+// normaliseGraph makes the graph independent of the order in which the
+// dependencies were processed. When a library is referenced by several paths,
+// the first reference in depth-first order becomes the entry in FlatDeps,
+// and every reference shares the information that was read from the file,
+// as well as its origin. The origin of the other references (e.g. pruned or
+// unresolved libraries) is classified once per real path, if the graph was
+// read rather than loaded. The diagnostics are also sorted by file and dependency.
+func normaliseGraph(graph *DependencyGraph) {
+	readDeps := graph.FlatDeps
+	flatDeps := make(map[string]*Dependency, len(readDeps))
+	classified := make(map[string]*Dependency)
+
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		if dep.Deps == nil {
+			return
+		}
+
+		for _, subDep := range *dep.Deps {
+			readDep, ok := readDeps[subDep.RealPath]
+			if !ok || subDep.Deps != readDep.Deps {
+				if graph.origins != nil {
+					if classifiedDep, ok := classified[subDep.RealPath]; ok {
+						copyOriginInfo(subDep, classifiedDep)
+					} else {
+						setOriginInfo(subDep, graph.origins)
+						classified[subDep.RealPath] = subDep
+					}
+				}
+				continue
+			}
+
+			copyOriginInfo(subDep, readDep)
+			subDep.RPaths = readDep.RPaths
+			subDep.ID = readDep.ID
+			subDep.IDInfo = readDep.IDInfo
+			subDep.UUIDs = readDep.UUIDs
+			subDep.Arches = readDep.Arches
+			subDep.NotResolved = subDep.NotResolved || readDep.NotResolved
+			if _, seen := flatDeps[subDep.RealPath]; !seen {
+				flatDeps[subDep.RealPath] = subDep
+				walk(subDep)
+			}
 		}
+	}
 
-		for _, dep := range graph.TopDeps {
-			wg.Add(1)
-			go depsRead(dep, graph, &opts, limiter, &wg)
+	for _, topDep := range graph.TopDeps {
+		walk(topDep)
+	}
+	for _, dep := range graph.SortedFlatDeps() {
+		if _, seen := flatDeps[dep.RealPath]; !seen {
+			flatDeps[dep.RealPath] = dep
+			walk(dep)
 		}
-		wg.Wait()
 	}
+	graph.FlatDeps = flatDeps
 
-	return graph, nil
+	sortDiagnostics(graph.Diagnostics)
 }
 
 // DepsPrettyPrint prints a dependency graph in a format similar
@@ -334,8 +727,9 @@ func DepsPrettyPrint(dep *Dependency) {
 func DepsGetJSONSerialisableVersion(graph *DependencyGraph) *DependencyGraph {
 	seenDeps := make(map[string]bool)
 	ret := &DependencyGraph{
-		TopDeps:  make([]*Dependency, 0, len(graph.TopDeps)),
-		FlatDeps: make(map[string]*Dependency),
+		TopDeps:     make([]*Dependency, 0, len(graph.TopDeps)),
+		FlatDeps:    make(map[string]*Dependency),
+		Diagnostics: graph.Diagnostics,
 	}
 
 	var chopDep func(dep *Dependency) *Dependency
@@ -372,9 +766,86 @@ func DepsGetJSONSerialisableVersion(graph *DependencyGraph) *DependencyGraph {
 		ret.TopDeps = append(ret.TopDeps, chopDep(topDep))
 	}
 
-	for k, v := range graph.FlatDeps {
-		ret.FlatDeps[k] = chopDep(v)
+	for _, dep := range graph.SortedFlatDeps() {
+		ret.FlatDeps[dep.RealPath] = chopDep(dep)
 	}
 
 	return ret
 }
+
+// rehydrateGraph reverses DepsGetJSONSerialisableVersion, for a graph read from
+// JSON. Each repeated subtree, which was replaced by a stub marked with
+// PrunedByFlatDeps, shares the dependencies of the first reference to the
+// library again. As in DepsRead, a stub with the same path as that reference
+// is replaced by it.
+func rehydrateGraph(graph *DependencyGraph) {
+	topLevels := make(map[string]bool)
+	for _, topDep := range graph.TopDeps {
+		topLevels[topDep.RealPath] = true
+	}
+
+	first := make(map[string]*Dependency)
+	var find func(dep *Dependency)
+	find = func(dep *Dependency) {
+		if dep.Deps == nil && !dep.Pruned && !dep.NotResolved && !dep.PrunedByFlatDeps && !topLevels[dep.RealPath] {
+			// The libraries that were read but have no dependencies are serialised with null
+			dep.Deps = new([]*Dependency)
+		}
+		if dep.Deps == nil || dep.PrunedByFlatDeps {
+			return
+		} else if _, ok := first[dep.RealPath]; ok {
+			return
+		}
+
+		first[dep.RealPath] = dep
+		for _, subDep := range *dep.Deps {
+			find(subDep)
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		find(topDep)
+	}
+	for _, dep := range graph.SortedFlatDeps() {
+		find(dep)
+	}
+
+	// The references to a library with another install path share a pointer too
+	aliases := make(map[[2]string]*Dependency)
+	seen := make(map[*[]*Dependency]bool)
+	var share func(deps *[]*Dependency)
+	share = func(deps *[]*Dependency) {
+		if deps == nil || seen[deps] {
+			return
+		}
+		seen[deps] = true
+
+		for i, subDep := range *deps {
+			if !subDep.PrunedByFlatDeps {
+				share(subDep.Deps)
+			} else if dep, ok := first[subDep.RealPath]; !ok {
+				continue
+			} else if dep.Path == subDep.Path {
+				(*deps)[i] = dep
+			} else if alias, ok := aliases[[2]string{subDep.RealPath, subDep.Path}]; ok {
+				(*deps)[i] = alias
+			} else {
+				subDep.Deps = dep.Deps
+				subDep.PrunedByFlatDeps = false
+				aliases[[2]string{subDep.RealPath, subDep.Path}] = subDep
+			}
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		share(topDep.Deps)
+	}
+	for _, dep := range graph.SortedFlatDeps() {
+		share(dep.Deps)
+	}
+
+	for realPath := range graph.FlatDeps {
+		if dep, ok := first[realPath]; ok {
+			graph.FlatDeps[realPath] = dep
+		}
+	}
+	normaliseGraph(graph)
+}
@@ -0,0 +1,296 @@
+package lddx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDepsRead(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib", filepath.Join(dir, "sys", "libsys.dylib")},
+	})
+	writeTestMachO(t, filepath.Join(dir, "sys", "libsys.dylib"), testMachO{ID: "/sys/libsys.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{
+		ID:     "@rpath/liba.dylib",
+		Dylibs: []string{"@rpath/libb.dylib"},
+		RPaths: []string{"@loader_path"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "libb.dylib"), testMachO{ID: "@rpath/libb.dylib"})
+
+	opts := DependencyOptions{
+		Recursive:       true,
+		Jobs:            4,
+		IgnoredPrefixes: []string{filepath.Join(dir, "sys")},
+	}
+	graph, err := DepsRead(opts, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(graph.TopDeps) != 1 {
+		t.Fatalf("Expected 1 top-level dependency but got %d", len(graph.TopDeps))
+	} else if len(graph.FlatDeps) != 2 {
+		t.Fatalf("Expected 2 flat dependencies but got %d", len(graph.FlatDeps))
+	}
+
+	deps := *graph.TopDeps[0].Deps
+	if len(deps) != 2 || deps[0].Path != filepath.Join(dir, "sys", "libsys.dylib") || deps[1].Path != "@loader_path/liba.dylib" {
+		t.Fatalf("Unexpected dependencies of main: %v", deps)
+	} else if !deps[0].Pruned {
+		t.Errorf("Expected %s to be pruned", deps[0].Path)
+	} else if deps[1].NotResolved || len(*deps[1].Deps) != 1 {
+		t.Fatalf("Expected %s to be resolved with 1 dependency", deps[1].Path)
+	} else if libb := (*deps[1].Deps)[0]; libb.NotResolved || libb.RealPath != filepath.Join(dir, "libb.dylib") {
+		t.Errorf("Expected %s to resolve to %s but got %s", libb.Path, filepath.Join(dir, "libb.dylib"), libb.RealPath)
+	}
+}
+
+func TestDepsReadContextCancelled(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{ID: "@rpath/liba.dylib"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := DependencyOptions{Recursive: true, Jobs: 4}
+	if graph, err := DepsReadContext(ctx, opts, filepath.Join(dir, "main")); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v (graph %v)", err, graph)
+	}
+
+	collectorOpts := CollectorOptions{Folder: filepath.Join(dir, "out"), Jobs: 2}
+	graph := &DependencyGraph{FlatDeps: make(map[string]*Dependency)}
+	if _, err := CollectDepsContext(ctx, graph, &collectorOpts); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
+
+func TestDepsReadContextCancelledDuringScan(t *testing.T) {
+	dir := t.TempDir()
+
+	// A chain of libraries, which can only be read one after the other
+	const numLibs = 16
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{Dylibs: []string{"@loader_path/lib0.dylib"}})
+	for i := 0; i < numLibs; i++ {
+		var dylibs []string
+		if i+1 < numLibs {
+			dylibs = append(dylibs, fmt.Sprintf("@loader_path/lib%d.dylib", i+1))
+		}
+		writeTestMachO(t, filepath.Join(dir, fmt.Sprintf("lib%d.dylib", i)), testMachO{
+			ID:     fmt.Sprintf("@rpath/lib%d.dylib", i),
+			Dylibs: dylibs,
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	numRead := 0
+	opts := DependencyOptions{
+		Recursive: true,
+		Jobs:      4,
+		OnRead: func(dep *Dependency, topLevel bool) {
+			if numRead++; numRead == 3 {
+				cancel()
+			}
+		},
+	}
+
+	if graph, err := DepsReadContext(ctx, opts, filepath.Join(dir, "main")); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v (graph %v)", err, graph)
+	} else if numRead != 3 {
+		t.Errorf("Expected no files to be read after cancelling, but %d were read", numRead)
+	}
+}
+
+func TestDepsReadDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@rpath/libmissing.dylib", "@loader_path/libmissing.dylib"},
+		RPaths: []string{"@loader_path/lib"},
+	})
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := make(map[DiagnosticCode]Diagnostic)
+	for _, diag := range graph.Diagnostics {
+		codes[diag.Code] = diag
+	}
+
+	if diag, ok := codes[DiagUnresolvedRPath]; !ok {
+		t.Errorf("Expected a %s diagnostic in %v", DiagUnresolvedRPath, graph.Diagnostics)
+	} else if diag.Severity != SeverityWarning || diag.Dependency != "@rpath/libmissing.dylib" || diag.File != filepath.Join(dir, "main") {
+		t.Errorf("Unexpected diagnostic %+v", diag)
+	}
+	if _, ok := codes[DiagUnresolvedDependency]; !ok {
+		t.Errorf("Expected a %s diagnostic in %v", DiagUnresolvedDependency, graph.Diagnostics)
+	}
+}
+
+func TestDepsReadDeterministic(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(dir string)
+	}{
+		{
+			// Each library is referenced by both an @rpath and an @loader_path
+			// install name, so the order in which they are processed matters.
+			name: "referenced by the top-level file",
+			write: func(dir string) {
+				var mainDylibs []string
+				for i := 0; i < 8; i++ {
+					var dylibs []string
+					for j := 0; j < 8; j++ {
+						if j != i {
+							dylibs = append(dylibs, fmt.Sprintf("@rpath/lib%d.dylib", j), "@rpath/libmissing.dylib")
+						}
+					}
+					writeTestMachO(t, filepath.Join(dir, fmt.Sprintf("lib%d.dylib", i)), testMachO{
+						ID:     fmt.Sprintf("@rpath/lib%d.dylib", i),
+						Dylibs: dylibs,
+						RPaths: []string{"@loader_path"},
+					})
+					mainDylibs = append(mainDylibs, fmt.Sprintf("@loader_path/lib%d.dylib", i))
+				}
+				writeTestMachO(t, filepath.Join(dir, "main"), testMachO{Dylibs: mainDylibs})
+			},
+		},
+		{
+			// libc is only reached through liba and libb, by different install names,
+			// and has a diagnostic of its own.
+			name: "referenced by intermediate libraries",
+			write: func(dir string) {
+				writeTestMachO(t, filepath.Join(dir, "main"), testMachO{Dylibs: []string{"@loader_path/liba.dylib", "@loader_path/libb.dylib"}})
+				writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{
+					ID:     "@rpath/liba.dylib",
+					Dylibs: []string{"@rpath/libc.dylib"},
+					RPaths: []string{"@loader_path"},
+				})
+				writeTestMachO(t, filepath.Join(dir, "libb.dylib"), testMachO{ID: "@rpath/libb.dylib", Dylibs: []string{"@loader_path/libc.dylib"}})
+				writeTestMachO(t, filepath.Join(dir, "libc.dylib"), testMachO{ID: "@rpath/libc.dylib", Dylibs: []string{"@rpath/libmissing.dylib"}})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ResolveAbsPath(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.write(dir)
+
+		serialise := func(jobs int) (string, *DependencyGraph) {
+			opts := DependencyOptions{Recursive: true, Jobs: jobs, Logger: NewColorLogger(io.Discard, true, true)}
+			graph, err := DepsRead(opts, filepath.Join(dir, "main"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := json.Marshal(DepsGetJSONSerialisableVersion(graph))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(out), graph
+		}
+
+		expected, graph := serialise(1)
+		for _, diag := range graph.Diagnostics {
+			// The file of a diagnostic is its real path, whichever reference was read
+			if _, ok := graph.FlatDeps[diag.File]; !ok && diag.File != filepath.Join(dir, "main") {
+				t.Errorf("%s: Expected the diagnostic to refer to a real path, but got %+v", test.name, diag)
+			} else if !strings.Contains(diag.Message, diag.File) {
+				t.Errorf("%s: Expected the message to refer to %s, but got %s", test.name, diag.File, diag.Message)
+			}
+		}
+		for i := 0; i < 50; i++ {
+			if out, _ := serialise(8); out != expected {
+				t.Fatalf("%s: Run %d: Output differs from the sequential run:\n%s\n%s", test.name, i, expected, out)
+			}
+		}
+	}
+}
+
+// writeSyntheticGraph writes a top-level file that depends on every one of
+// n libraries, each of which depends on fanout of the other libraries.
+func writeSyntheticGraph(b *testing.B, dir string, n, fanout int) string {
+	var mainDylibs []string
+	for i := 0; i < n; i++ {
+		var dylibs []string
+		for j := 1; j <= fanout; j++ {
+			dylibs = append(dylibs, fmt.Sprintf("@rpath/lib%d.dylib", (i*7+j*13)%n))
+		}
+		writeTestMachO(b, filepath.Join(dir, fmt.Sprintf("lib%d.dylib", i)), testMachO{
+			ID:     fmt.Sprintf("@rpath/lib%d.dylib", i),
+			Dylibs: dylibs,
+			RPaths: []string{"@loader_path"},
+		})
+		mainDylibs = append(mainDylibs, fmt.Sprintf("@loader_path/lib%d.dylib", i))
+	}
+
+	main := filepath.Join(dir, "main")
+	writeTestMachO(b, main, testMachO{Dylibs: mainDylibs})
+	return main
+}
+
+func BenchmarkDepsRead(b *testing.B) {
+	benchmarks := []struct {
+		libs, fanout, jobs int
+	}{
+		{libs: 100, fanout: 4, jobs: 1},
+		{libs: 100, fanout: 4, jobs: 10},
+		{libs: 2000, fanout: 8, jobs: 1},
+		{libs: 2000, fanout: 8, jobs: 10},
+		{libs: 2000, fanout: 8, jobs: 64},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(fmt.Sprintf("libs=%d/fanout=%d/jobs=%d", bm.libs, bm.fanout, bm.jobs), func(b *testing.B) {
+			main := writeSyntheticGraph(b, b.TempDir(), bm.libs, bm.fanout)
+			opts := DependencyOptions{Recursive: true, Jobs: bm.jobs, Logger: NewColorLogger(io.Discard, true, true)}
+
+			// Sample the number of goroutines, as their stacks are not included in the allocations.
+			peak := int64(0)
+			done := make(chan bool)
+			go func() {
+				ticker := time.NewTicker(50 * time.Microsecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-done:
+						return
+					case <-ticker.C:
+						if n := int64(runtime.NumGoroutine()); n > atomic.LoadInt64(&peak) {
+							atomic.StoreInt64(&peak, n)
+						}
+					}
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := DepsRead(opts, main); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			close(done)
+			b.ReportMetric(float64(atomic.LoadInt64(&peak)), "peak-goroutines")
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package lddx
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity indicates how important a diagnostic is.
+type Severity string
+
+// The severities that a diagnostic may have.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// DiagnosticCode identifies the kind of outcome a diagnostic reports.
+type DiagnosticCode string
+
+// The diagnostic codes emitted while calculating dependencies.
+const (
+	DiagUnresolvedRPath      DiagnosticCode = "unresolved-rpath"      // An @rpath dependency could not be found in any rpath
+	DiagUnresolvedDependency DiagnosticCode = "unresolved-dependency" // A dependency could not be resolved to a file
+	DiagReadFailed           DiagnosticCode = "read-failed"           // The load commands of a file could not be read
+)
+
+// The diagnostic codes emitted while collecting dependencies.
+const (
+	DiagStatFailed          DiagnosticCode = "stat-failed"            // A file could not be checked
+	DiagSkippedExisting     DiagnosticCode = "skipped-existing"       // A library was not collected as it already exists
+	DiagSkippedUnresolved   DiagnosticCode = "skipped-unresolved"     // An unresolved library was not collected
+	DiagSkippedSpecialPath  DiagnosticCode = "skipped-special-path"   // A library with an @ path was not collected
+	DiagSkippedTopLevel     DiagnosticCode = "skipped-top-level"      // A library was not collected as it is a top-level file
+	DiagSkippedFramework    DiagnosticCode = "skipped-framework"      // A framework was not collected
+	DiagSkippedSymlink      DiagnosticCode = "skipped-symlink"        // A top-level symlink was not fixed
+	DiagLibraryConflict     DiagnosticCode = "library-conflict"       // Multiple libraries would be collected to the same name
+	DiagConflictResolved    DiagnosticCode = "conflict-resolved"      // A library conflict was resolved by the preferred order
+	DiagCopyFailed          DiagnosticCode = "copy-failed"            // A library could not be copied into the collection folder
+	DiagInstallNameFailed   DiagnosticCode = "install-name-failed"    // install_name_tool failed to update a library
+	DiagRelativePathFailed  DiagnosticCode = "relative-path-failed"   // A relative path between two libraries could not be determined
+	DiagTopLevelNotWritable DiagnosticCode = "top-level-not-writable" // A top-level file could not be made writeable
+)
+
+// Diagnostic describes a notable outcome of calculating or collecting
+// dependencies, such as a dependency that could not be resolved.
+type Diagnostic struct {
+	Code       DiagnosticCode // The kind of outcome
+	Severity   Severity       // How important the outcome is
+	File       string         // The file that was being processed
+	Dependency string         // The dependency concerned, if any
+	Message    string         // A human readable description
+}
+
+// newDiagnostic creates a diagnostic and logs its message to the
+// logger at the level matching its severity.
+func newDiagnostic(logger Logger, severity Severity, code DiagnosticCode, file, dependency, format string, args ...interface{}) Diagnostic {
+	diag := Diagnostic{
+		Code:       code,
+		Severity:   severity,
+		File:       file,
+		Dependency: dependency,
+		Message:    fmt.Sprintf(format, args...),
+	}
+
+	switch severity {
+	case SeverityError:
+		logger.Error("%s", diag.Message)
+	case SeverityWarning:
+		logger.Warn("%s", diag.Message)
+	default:
+		logger.Note("%s", diag.Message)
+	}
+	return diag
+}
+
+// String returns the diagnostic in a human readable form.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: [%s] %s", d.Severity, d.Code, d.Message)
+}
+
+// sortDiagnostics sorts the diagnostics by file, then dependency, code and message,
+// so that they do not depend on the order in which the files were processed.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		} else if a.Dependency != b.Dependency {
+			return a.Dependency < b.Dependency
+		} else if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		return a.Message < b.Message
+	})
+}
+
+// addDiagnostic records a diagnostic from reading the file with the real path
+// against the dependency graph, and against the file if its read is recorded.
+func (graph *DependencyGraph) addDiagnostic(realPath string, diag Diagnostic) {
+	graph.diagLock.Lock()
+	defer graph.diagLock.Unlock()
+	graph.Diagnostics = append(graph.Diagnostics, diag)
+	if graph.reads != nil {
+		read := graph.fileRead(realPath)
+		read.diagnostics = append(read.diagnostics, diag)
+	}
+}
+
+// CollectorResult contains the outcome of collecting dependencies
+// or fixing up top-level files.
+type CollectorResult struct {
+	Processed   []*Dependency // The dependencies that were collected or fixed
+	Diagnostics []Diagnostic  // Notable outcomes of the collection
+}
+
+// add records a diagnostic against the collector result.
+func (r *CollectorResult) add(diag Diagnostic) {
+	r.Diagnostics = append(r.Diagnostics, diag)
+}
+
+// err returns an error summarising the error diagnostics, if there are any.
+// The diagnostics themselves have already been logged when created.
+func (r *CollectorResult) err() error {
+	numErrors := 0
+	for _, diag := range r.Diagnostics {
+		if diag.Severity == SeverityError {
+			numErrors++
+		}
+	}
+
+	if numErrors > 0 {
+		return fmt.Errorf("%d error(s) occurred", numErrors)
+	}
+	return nil
+}
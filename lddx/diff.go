@@ -0,0 +1,248 @@
+package lddx
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiffChange describes a library whose properties differ between two graphs.
+type DiffChange struct {
+	InstallName string `json:"installName"` // The path to the library, as specified by the load command
+	Old         string `json:"old"`         // The value in the old graph
+	New         string `json:"new"`         // The value in the new graph
+}
+
+// GraphDiff contains the differences between two dependency graphs.
+// Libraries are identified by their install name, or their name
+// for top-level dependencies. The real paths inside the build being
+// compared are relative to its root folder.
+type GraphDiff struct {
+	Added           []string     `json:"added"`           // Libraries only in the new graph
+	Removed         []string     `json:"removed"`         // Libraries only in the old graph
+	PathChanges     []DiffChange `json:"pathChanges"`     // Libraries that resolve to a different real path
+	VersionChanges  []DiffChange `json:"versionChanges"`  // Libraries with different version info
+	NewlyUnresolved []string     `json:"newlyUnresolved"` // Libraries that could be resolved in the old graph, but not the new
+}
+
+// Empty checks if there are no differences.
+func (d *GraphDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.PathChanges) == 0 &&
+		len(d.VersionChanges) == 0 && len(d.NewlyUnresolved) == 0
+}
+
+// diffEntry aggregates every occurrence of a library in a graph
+// that resolves to the same relative real path.
+type diffEntry struct {
+	infos      map[string]bool
+	unresolved bool
+}
+
+func joinKeys(set map[string]bool) string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// graphRoot returns the folder that the real paths in the graph are compared
+// relative to, so that builds in different locations can be compared. This is
+// the common folder of the top-level files or, if they are inside an app
+// bundle, the outermost bundle, as its libraries are outside that folder.
+func graphRoot(graph *DependencyGraph) string {
+	var root []string
+	for i, topDep := range graph.TopDeps {
+		dir := strings.Split(filepath.Dir(topDep.RealPath), string(filepath.Separator))
+		if i == 0 {
+			root = dir
+			continue
+		}
+		n := 0
+		for n < len(root) && n < len(dir) && root[n] == dir[n] {
+			n++
+		}
+		root = root[:n]
+	}
+
+	ret := strings.Join(root, string(filepath.Separator))
+	for dir := ret; ; {
+		if strings.HasSuffix(dir, ".app") {
+			ret = dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ret
+}
+
+// relativePath returns the real path relative to the root, if it is inside it.
+func relativePath(root, realPath string) string {
+	if root == "" || !strings.HasPrefix(realPath, root+string(filepath.Separator)) {
+		return realPath
+	}
+	return filepath.ToSlash(realPath[len(root)+1:])
+}
+
+// getDiffEntries collects every library in the graph, keyed by install name
+// and then by real path, relative to the root of the graph. Top-level
+// dependencies are keyed by name instead of install name.
+func getDiffEntries(graph *DependencyGraph) map[string]map[string]*diffEntry {
+	entries := make(map[string]map[string]*diffEntry)
+	visited := make(map[string]bool)
+	root := graphRoot(graph)
+
+	add := func(key string, dep *Dependency) {
+		if entries[key] == nil {
+			entries[key] = make(map[string]*diffEntry)
+		}
+		realPath := relativePath(root, dep.RealPath)
+		entry, ok := entries[key][realPath]
+		if !ok {
+			entry = &diffEntry{infos: make(map[string]bool)}
+			entries[key][realPath] = entry
+		}
+		if dep.NotResolved {
+			entry.unresolved = true
+		}
+		if dep.Info != "" {
+			entry.infos[dep.Info] = true
+		}
+	}
+
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		if dep.Deps == nil || visited[dep.RealPath] {
+			return
+		}
+		visited[dep.RealPath] = true
+
+		for _, subDep := range *dep.Deps {
+			add(subDep.Path, subDep)
+			walk(subDep)
+		}
+	}
+
+	for _, topDep := range graph.TopDeps {
+		add(topDep.Name, topDep)
+		walk(topDep)
+	}
+	for _, dep := range graph.FlatDeps {
+		walk(dep)
+	}
+
+	return entries
+}
+
+// summariseEntries returns the resolved real paths and the version info of
+// every entry of a library, and whether any of them is unresolved.
+func summariseEntries(entries map[string]*diffEntry) (map[string]bool, map[string]bool, bool) {
+	realPaths := make(map[string]bool)
+	infos := make(map[string]bool)
+	unresolved := false
+	for realPath, entry := range entries {
+		if entry.unresolved {
+			unresolved = true
+		} else {
+			realPaths[realPath] = true
+		}
+		for info := range entry.infos {
+			infos[info] = true
+		}
+	}
+	return realPaths, infos, unresolved
+}
+
+// DepsDiff compares two dependency graphs, returning the libraries
+// that were added or removed, whose resolved path or version changed,
+// or that could no longer be resolved. The real paths inside the folder
+// of the top-level files (or their app bundle) are compared relative to
+// it, so the graphs may be of builds in different locations.
+func DepsDiff(oldGraph, newGraph *DependencyGraph) *GraphDiff {
+	oldEntries := getDiffEntries(oldGraph)
+	newEntries := getDiffEntries(newGraph)
+	// The lists are empty rather than nil, so that they are serialised as []
+	diff := &GraphDiff{
+		Added:           []string{},
+		Removed:         []string{},
+		PathChanges:     []DiffChange{},
+		VersionChanges:  []DiffChange{},
+		NewlyUnresolved: []string{},
+	}
+
+	for key, oldLib := range oldEntries {
+		newLib, ok := newEntries[key]
+		if !ok {
+			diff.Removed = append(diff.Removed, key)
+			continue
+		}
+
+		oldPaths, oldInfos, oldUnresolved := summariseEntries(oldLib)
+		newPaths, newInfos, newUnresolved := summariseEntries(newLib)
+		if newUnresolved && !oldUnresolved {
+			diff.NewlyUnresolved = append(diff.NewlyUnresolved, key)
+		} else if oldPath, newPath := joinKeys(oldPaths), joinKeys(newPaths); oldPath != newPath && oldPath != "" && newPath != "" {
+			diff.PathChanges = append(diff.PathChanges, DiffChange{InstallName: key, Old: oldPath, New: newPath})
+		}
+
+		if oldInfo, newInfo := joinKeys(oldInfos), joinKeys(newInfos); oldInfo != newInfo {
+			diff.VersionChanges = append(diff.VersionChanges, DiffChange{InstallName: key, Old: oldInfo, New: newInfo})
+		}
+	}
+
+	for key, newLib := range newEntries {
+		if _, ok := oldEntries[key]; !ok {
+			diff.Added = append(diff.Added, key)
+			if _, _, unresolved := summariseEntries(newLib); unresolved {
+				diff.NewlyUnresolved = append(diff.NewlyUnresolved, key)
+			}
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.NewlyUnresolved)
+	for _, changes := range [][]DiffChange{diff.PathChanges, diff.VersionChanges} {
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].InstallName < changes[j].InstallName
+		})
+	}
+
+	return diff
+}
+
+// DiffPrettyPrint prints the differences between two graphs.
+func DiffPrettyPrint(diff *GraphDiff) {
+	if diff.Empty() {
+		fmt.Println("No differences")
+		return
+	}
+
+	printList := func(title, marker string, list []string) {
+		if len(list) > 0 {
+			fmt.Printf("%s:\n", title)
+			for _, ent := range list {
+				fmt.Printf("    %s %s\n", marker, ent)
+			}
+		}
+	}
+	printChanges := func(title string, changes []DiffChange) {
+		if len(changes) > 0 {
+			fmt.Printf("%s:\n", title)
+			for _, change := range changes {
+				fmt.Printf("    ~ %s: %s => %s\n", change.InstallName, change.Old, change.New)
+			}
+		}
+	}
+
+	printList("Added", "+", diff.Added)
+	printList("Removed", "-", diff.Removed)
+	printChanges("Resolved path changed", diff.PathChanges)
+	printChanges("Version changed", diff.VersionChanges)
+	printList("Newly unresolved", "!", diff.NewlyUnresolved)
+}
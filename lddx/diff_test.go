@@ -0,0 +1,99 @@
+package lddx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDepsDiff(t *testing.T) {
+	oldGraph := newTestGraph(
+		&Dependency{Name: "main", Path: "/old/main", RealPath: "/old/main"},
+		&Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/opt/a/liba.dylib", Info: "1.0"},
+		&Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: "/opt/b/libb.dylib", Info: "1.0"},
+		&Dependency{Name: "libc.dylib", Path: "@rpath/libc.dylib", RealPath: "/opt/c/libc.dylib", Info: "1.0"},
+		&Dependency{Name: "libd.dylib", Path: "@rpath/libd.dylib", RealPath: "/opt/d/libd.dylib", Info: "1.0"},
+	)
+	newGraph := newTestGraph(
+		&Dependency{Name: "main", Path: "/new/main", RealPath: "/new/main"},
+		&Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/opt/a/liba.dylib", Info: "1.0"},
+		&Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: "/opt/b2/libb.dylib", Info: "1.0"},
+		&Dependency{Name: "libc.dylib", Path: "@rpath/libc.dylib", RealPath: "/opt/c/libc.dylib", Info: "2.0"},
+		&Dependency{Name: "libd.dylib", Path: "@rpath/libd.dylib", RealPath: "@rpath/libd.dylib", Info: "1.0", NotResolved: true},
+		&Dependency{Name: "libe.dylib", Path: "@rpath/libe.dylib", RealPath: "/opt/e/libe.dylib", Info: "1.0"},
+	)
+
+	expected := newTestDiff(GraphDiff{
+		Added:           []string{"@rpath/libe.dylib"},
+		PathChanges:     []DiffChange{{InstallName: "@rpath/libb.dylib", Old: "/opt/b/libb.dylib", New: "/opt/b2/libb.dylib"}},
+		VersionChanges:  []DiffChange{{InstallName: "@rpath/libc.dylib", Old: "1.0", New: "2.0"}},
+		NewlyUnresolved: []string{"@rpath/libd.dylib"},
+	})
+
+	if diff := DepsDiff(oldGraph, newGraph); !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, diff)
+	}
+	if diff := DepsDiff(oldGraph, oldGraph); !diff.Empty() {
+		t.Errorf("Expected no differences but got %+v", diff)
+	}
+
+	reverse := DepsDiff(newGraph, oldGraph)
+	if !reflect.DeepEqual(reverse.Removed, []string{"@rpath/libe.dylib"}) || len(reverse.NewlyUnresolved) != 0 {
+		t.Errorf("Unexpected reverse diff %+v", reverse)
+	}
+}
+
+func TestDepsDiffRelocated(t *testing.T) {
+	newBundleGraph := func(bundle, libb string) *DependencyGraph {
+		return newTestGraph(
+			&Dependency{Name: "main", Path: bundle + "/Contents/MacOS/main", RealPath: bundle + "/Contents/MacOS/main"},
+			&Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: bundle + "/Contents/Frameworks/liba.dylib", Info: "1.0"},
+			&Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: bundle + "/Contents/Frameworks/" + libb, Info: "1.0"},
+			&Dependency{Name: "libz.1.dylib", Path: "/opt/lib/libz.1.dylib", RealPath: "/opt/lib/libz.1.dylib", Info: "1.0"},
+		)
+	}
+	oldGraph := newBundleGraph("/builds/1/MyApp.app", "libb.dylib")
+
+	if diff := DepsDiff(oldGraph, newBundleGraph("/builds/2/MyApp.app", "libb.dylib")); !diff.Empty() {
+		t.Errorf("Expected no differences between the builds in different folders, but got %+v", diff)
+	}
+
+	expected := []DiffChange{{InstallName: "@rpath/libb.dylib", Old: "Contents/Frameworks/libb.dylib", New: "Contents/Frameworks/lib/libb.dylib"}}
+	if diff := DepsDiff(oldGraph, newBundleGraph("/tmp/MyApp.app", "lib/libb.dylib")); !reflect.DeepEqual(diff.PathChanges, expected) {
+		t.Errorf("Expected the path changes %+v, but got %+v", expected, diff)
+	}
+}
+
+func TestDepsDiffJSON(t *testing.T) {
+	oldGraph := newTestGraph(
+		&Dependency{Name: "main", Path: "/old/main", RealPath: "/old/main"},
+		&Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/opt/a/liba.dylib", Info: "1.0"},
+	)
+	newGraph := newTestGraph(
+		&Dependency{Name: "main", Path: "/new/main", RealPath: "/new/main"},
+		&Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/opt/a/liba.dylib", Info: "2.0"},
+	)
+
+	tests := []struct {
+		diff     *GraphDiff
+		expected string
+	}{
+		{
+			diff:     DepsDiff(oldGraph, oldGraph),
+			expected: `{"added":[],"removed":[],"pathChanges":[],"versionChanges":[],"newlyUnresolved":[]}`,
+		},
+		{
+			diff:     DepsDiff(oldGraph, newGraph),
+			expected: `{"added":[],"removed":[],"pathChanges":[],"versionChanges":[{"installName":"@rpath/liba.dylib","old":"1.0","new":"2.0"}],"newlyUnresolved":[]}`,
+		},
+	}
+
+	for _, test := range tests {
+		out, err := json.Marshal(test.diff)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(out) != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, out)
+		}
+	}
+}
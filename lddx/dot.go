@@ -0,0 +1,154 @@
+package lddx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DotOptions specifies how the dependency graph is rendered as a DOT digraph.
+type DotOptions struct {
+	CollapseIgnored bool // Group the ignored (pruned) libraries into a single cluster
+	MaxDepth        int  // The maximum depth of the dependencies to render, or 0 for unlimited
+}
+
+// graphDirectDeps returns the direct dependencies of each library in the
+// graph, keyed by real path. This also works for graphs read from JSON,
+// where each repeated subtree is only listed once.
+func graphDirectDeps(graph *DependencyGraph) map[string][]*Dependency {
+	ret := make(map[string][]*Dependency)
+
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		if dep.Deps == nil {
+			return
+		} else if _, ok := ret[dep.RealPath]; ok {
+			return
+		}
+
+		ret[dep.RealPath] = *dep.Deps
+		for _, subDep := range *dep.Deps {
+			walk(subDep)
+		}
+	}
+
+	for _, topDep := range graph.TopDeps {
+		walk(topDep)
+	}
+	for _, dep := range graph.SortedFlatDeps() {
+		walk(dep)
+	}
+	return ret
+}
+
+// dotQuote quotes a string as a DOT identifier.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// dotNodeStyle returns the attributes used to render a library.
+func dotNodeStyle(dep *Dependency, topLevel bool) string {
+	switch {
+	case dep.NotResolved:
+		return `style=filled, fillcolor="#f4cccc", color=red`
+	case dep.Pruned:
+		return `style=dashed, color=gray50, fontcolor=gray50`
+	case topLevel:
+		return `shape=box, style="bold,filled", fillcolor="#cfe2f3"`
+	case dep.Framework != "":
+		return `shape=folder, style=filled, fillcolor="#fff2cc"`
+	}
+	return ""
+}
+
+// DepsWriteDot writes the dependency graph as a Graphviz DOT digraph, with
+// one node per real path. Top-level files, frameworks, pruned (ignored) and
+// unresolved libraries are each styled differently, and weak dependencies
+// are drawn with dashed edges.
+func DepsWriteDot(w io.Writer, graph *DependencyGraph, opts DotOptions) error {
+	directDeps := graphDirectDeps(graph)
+	nodes := make(map[string]*Dependency)
+	topLevels := make(map[string]bool)
+	var order []string
+	var edges strings.Builder
+
+	addNode := func(dep *Dependency) bool {
+		if _, ok := nodes[dep.RealPath]; ok {
+			return false
+		}
+		nodes[dep.RealPath] = dep
+		order = append(order, dep.RealPath)
+		return true
+	}
+
+	// Breadth first, so that each library is shown at its shallowest depth
+	var queue []*Dependency
+	depths := make(map[string]int)
+	for _, topDep := range graph.TopDeps {
+		topLevels[topDep.RealPath] = true
+		if addNode(topDep) {
+			queue = append(queue, topDep)
+		}
+	}
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		depth := depths[dep.RealPath]
+		if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			continue
+		}
+
+		for _, subDep := range directDeps[dep.RealPath] {
+			attrs := ""
+			if subDep.IsWeakDep {
+				attrs = " [style=dashed]"
+			}
+			fmt.Fprintf(&edges, "\t%s -> %s%s;\n", dotQuote(dep.RealPath), dotQuote(subDep.RealPath), attrs)
+
+			if addNode(subDep) {
+				depths[subDep.RealPath] = depth + 1
+				queue = append(queue, subDep)
+			}
+		}
+	}
+	sort.Strings(order)
+
+	var out strings.Builder
+	out.WriteString("digraph dependencies {\n")
+	out.WriteString("\trankdir=LR;\n")
+	out.WriteString("\tnode [fontname=Helvetica];\n")
+
+	writeNode := func(indent string, dep *Dependency) {
+		attrs := fmt.Sprintf("label=%s, tooltip=%s", dotQuote(dep.Name), dotQuote(dep.RealPath))
+		if style := dotNodeStyle(dep, topLevels[dep.RealPath]); style != "" {
+			attrs += ", " + style
+		}
+		fmt.Fprintf(&out, "%s%s [%s];\n", indent, dotQuote(dep.RealPath), attrs)
+	}
+
+	var ignored []*Dependency
+	for _, realPath := range order {
+		dep := nodes[realPath]
+		if opts.CollapseIgnored && dep.Pruned && !dep.NotResolved {
+			ignored = append(ignored, dep)
+		} else {
+			writeNode("\t", dep)
+		}
+	}
+	if len(ignored) > 0 {
+		out.WriteString("\tsubgraph cluster_ignored {\n")
+		fmt.Fprintf(&out, "\t\tlabel=%s;\n", dotQuote("Ignored libraries"))
+		out.WriteString("\t\tstyle=dashed;\n\t\tcolor=gray50;\n")
+		for _, dep := range ignored {
+			writeNode("\t\t", dep)
+		}
+		out.WriteString("\t}\n")
+	}
+
+	out.WriteString(edges.String())
+	out.WriteString("}\n")
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,75 @@
+package lddx
+
+import (
+	"strings"
+	"testing"
+)
+
+type depsWriteDotTest struct {
+	opts             DotOptions
+	expectedLines    []string
+	notExpectedLines []string
+}
+
+func TestDepsWriteDot(t *testing.T) {
+	libc := &Dependency{Name: "libc.dylib", Path: "@rpath/libc.dylib", RealPath: "/opt/lib/libc.dylib", Deps: &[]*Dependency{}}
+	libb := &Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: "/opt/lib/libb.dylib", Deps: &[]*Dependency{libc}}
+	graph := newTestGraph(
+		&Dependency{Name: "main", Path: "main", RealPath: "/app/main"},
+		libb,
+		&Dependency{Name: "libweak.dylib", Path: "@rpath/libweak.dylib", RealPath: "/opt/lib/libweak.dylib", IsWeakDep: true, Deps: &[]*Dependency{}},
+		&Dependency{Name: "Foo", Path: "@rpath/Foo.framework/Foo", RealPath: "/opt/Foo.framework/Foo", Framework: "Foo", Deps: &[]*Dependency{}},
+		&Dependency{Name: "libSystem.B.dylib", Path: "/usr/lib/libSystem.B.dylib", RealPath: "/usr/lib/libSystem.B.dylib", Pruned: true},
+		&Dependency{Name: "libmissing.dylib", Path: "@rpath/libmissing.dylib", RealPath: "@rpath/libmissing.dylib", NotResolved: true},
+	)
+	graph.FlatDeps[libc.RealPath] = libc
+
+	testcases := []depsWriteDotTest{
+		{
+			expectedLines: []string{
+				`	"/app/main" [label="main", tooltip="/app/main", shape=box, style="bold,filled", fillcolor="#cfe2f3"];`,
+				`	"/opt/Foo.framework/Foo" [label="Foo", tooltip="/opt/Foo.framework/Foo", shape=folder, style=filled, fillcolor="#fff2cc"];`,
+				`	"/usr/lib/libSystem.B.dylib" [label="libSystem.B.dylib", tooltip="/usr/lib/libSystem.B.dylib", style=dashed, color=gray50, fontcolor=gray50];`,
+				`	"@rpath/libmissing.dylib" [label="libmissing.dylib", tooltip="@rpath/libmissing.dylib", style=filled, fillcolor="#f4cccc", color=red];`,
+				`	"/app/main" -> "/opt/lib/libweak.dylib" [style=dashed];`,
+				`	"/app/main" -> "/opt/lib/libb.dylib";`,
+				`	"/opt/lib/libb.dylib" -> "/opt/lib/libc.dylib";`,
+			},
+			notExpectedLines: []string{"\tsubgraph cluster_ignored {"},
+		},
+		{
+			opts: DotOptions{CollapseIgnored: true, MaxDepth: 1},
+			expectedLines: []string{
+				"\tsubgraph cluster_ignored {",
+				`		"/usr/lib/libSystem.B.dylib" [label="libSystem.B.dylib", tooltip="/usr/lib/libSystem.B.dylib", style=dashed, color=gray50, fontcolor=gray50];`,
+				`	"/app/main" -> "/opt/lib/libb.dylib";`,
+			},
+			notExpectedLines: []string{
+				`	"/opt/lib/libb.dylib" -> "/opt/lib/libc.dylib";`,
+				`	"/opt/lib/libc.dylib" [label="libc.dylib", tooltip="/opt/lib/libc.dylib"];`,
+			},
+		},
+	}
+
+	for i, test := range testcases {
+		var out strings.Builder
+		if err := DepsWriteDot(&out, graph, test.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := make(map[string]bool)
+		for _, line := range strings.Split(out.String(), "\n") {
+			lines[line] = true
+		}
+		for _, line := range test.expectedLines {
+			if !lines[line] {
+				t.Errorf("Test %d: Expected line %s in:\n%s", i, line, out.String())
+			}
+		}
+		for _, line := range test.notExpectedLines {
+			if lines[line] {
+				t.Errorf("Test %d: Unexpected line %s in:\n%s", i, line, out.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package lddx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DuplicateKind indicates how a set of duplicate libraries was identified.
+type DuplicateKind string
+
+// The ways in which duplicate libraries are identified.
+const (
+	DuplicateByID   DuplicateKind = "id"   // The libraries have the same install name (LC_ID_DYLIB)
+	DuplicateByUUID DuplicateKind = "uuid" // The libraries have the same Mach-O UUID
+)
+
+// DuplicateLibrary describes a library that is loaded from multiple locations.
+// As dyld loads each location separately, this may cause subtle crashes.
+type DuplicateLibrary struct {
+	Kind      DuplicateKind // How the duplicates were identified
+	Key       string        // The shared install name or UUID
+	Libraries []*Dependency // The duplicates, one per real path
+	Versions  []string      // The distinct version info of the duplicates (from LC_ID_DYLIB)
+}
+
+// MultipleVersions checks if the duplicates are different versions of the library.
+func (d *DuplicateLibrary) MultipleVersions() bool {
+	return len(d.Versions) > 1
+}
+
+// DepsDuplicates finds the libraries in the graph that are loaded from
+// more than one real path, by grouping them by their install name
+// (LC_ID_DYLIB) and by their Mach-O UUIDs. Each set of real paths is only
+// reported once, by install name if they share one, and otherwise by the
+// first of their shared UUIDs (e.g. for each architecture of a fat library).
+func DepsDuplicates(graph *DependencyGraph) []*DuplicateLibrary {
+	byID := make(map[string]map[string]*Dependency)
+	byUUID := make(map[string]map[string]*Dependency)
+
+	add := func(groups map[string]map[string]*Dependency, key string, dep *Dependency) {
+		if groups[key] == nil {
+			groups[key] = make(map[string]*Dependency)
+		}
+		groups[key][dep.RealPath] = dep
+	}
+
+	deps := append([]*Dependency(nil), graph.TopDeps...)
+	for _, dep := range graph.FlatDeps {
+		deps = append(deps, dep)
+	}
+
+	for _, dep := range deps {
+		if dep.ID != "" {
+			add(byID, dep.ID, dep)
+		}
+		for _, uuid := range dep.UUIDs {
+			add(byUUID, uuid, dep)
+		}
+	}
+
+	var ret []*DuplicateLibrary
+	collect := func(kind DuplicateKind, groups map[string]map[string]*Dependency) {
+		for key, group := range groups {
+			if len(group) < 2 {
+				continue
+			}
+
+			dup := &DuplicateLibrary{Kind: kind, Key: key}
+			versions := make(map[string]bool)
+			for _, dep := range group {
+				dup.Libraries = append(dup.Libraries, dep)
+				versions[dep.IDInfo] = true
+			}
+			for version := range versions {
+				dup.Versions = append(dup.Versions, version)
+			}
+
+			sort.Slice(dup.Libraries, func(i, j int) bool {
+				return dup.Libraries[i].RealPath < dup.Libraries[j].RealPath
+			})
+			sort.Strings(dup.Versions)
+			ret = append(ret, dup)
+		}
+	}
+	collect(DuplicateByID, byID)
+	collect(DuplicateByUUID, byUUID)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+		return ret[i].Key < ret[j].Key
+	})
+
+	// Merge the groups of the same libraries, keeping the first
+	seen := make(map[string]bool)
+	merged := ret[:0]
+	for _, dup := range ret {
+		var realPaths []string
+		for _, dep := range dup.Libraries {
+			realPaths = append(realPaths, dep.RealPath)
+		}
+		if key := strings.Join(realPaths, "\x00"); !seen[key] {
+			seen[key] = true
+			merged = append(merged, dup)
+		}
+	}
+	return merged
+}
+
+// DuplicatesPrettyPrint prints the results of DepsDuplicates.
+func DuplicatesPrettyPrint(dups []*DuplicateLibrary) {
+	for _, dup := range dups {
+		if dup.MultipleVersions() {
+			fmt.Printf("%s %s (loaded from %d locations, %d versions):\n", dup.Kind, dup.Key, len(dup.Libraries), len(dup.Versions))
+		} else {
+			fmt.Printf("%s %s (loaded from %d locations):\n", dup.Kind, dup.Key, len(dup.Libraries))
+		}
+
+		for _, dep := range dup.Libraries {
+			if dep.IDInfo != "" {
+				fmt.Printf("    %s (%s)\n", dep.RealPath, dep.IDInfo)
+			} else {
+				fmt.Printf("    %s\n", dep.RealPath)
+			}
+		}
+	}
+}
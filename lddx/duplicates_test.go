@@ -0,0 +1,97 @@
+package lddx
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDepsDuplicates(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uuid := [16]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{filepath.Join(dir, "local", "libpng16.16.dylib"), "@rpath/libpng16.16.dylib", "@rpath/libz.dylib"},
+		RPaths: []string{"@loader_path/bundle"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "local", "libpng16.16.dylib"), testMachO{ID: "/usr/local/opt/libpng/lib/libpng16.16.dylib", UUID: uuid})
+	writeTestMachO(t, filepath.Join(dir, "bundle", "libpng16.16.dylib"), testMachO{ID: "@rpath/libpng16.16.dylib", UUID: uuid})
+	writeTestMachO(t, filepath.Join(dir, "bundle", "libz.dylib"), testMachO{ID: "@rpath/libz.dylib"})
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dups := DepsDuplicates(graph)
+	if len(dups) != 1 {
+		t.Fatalf("Expected 1 duplicate but got %d", len(dups))
+	} else if dups[0].Kind != DuplicateByUUID || dups[0].Key != "DEADBEEF-0102-0304-0506-0708090A0B0C" {
+		t.Errorf("Unexpected duplicate %s %s", dups[0].Kind, dups[0].Key)
+	} else if len(dups[0].Libraries) != 2 || dups[0].MultipleVersions() {
+		t.Errorf("Expected 2 libraries with the same version but got %d libraries with versions %v", len(dups[0].Libraries), dups[0].Versions)
+	}
+
+	// Make the second copy share the install name as well, which is reported instead
+	writeTestMachO(t, filepath.Join(dir, "bundle", "libpng16.16.dylib"), testMachO{ID: "/usr/local/opt/libpng/lib/libpng16.16.dylib", UUID: uuid})
+	if graph, err = DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main")); err != nil {
+		t.Fatal(err)
+	}
+
+	dups = DepsDuplicates(graph)
+	if len(dups) != 1 || dups[0].Kind != DuplicateByID || dups[0].Key != "/usr/local/opt/libpng/lib/libpng16.16.dylib" {
+		t.Errorf("Expected a duplicate by install name but got %v", dups)
+	} else if dups[0].Libraries[0].RealPath != filepath.Join(dir, "bundle", "libpng16.16.dylib") {
+		t.Errorf("Expected the duplicates to be sorted by real path but got %s first", dups[0].Libraries[0].RealPath)
+	}
+}
+
+func TestDepsDuplicatesMerged(t *testing.T) {
+	uuids := []string{"11111111-0000-0000-0000-000000000000", "22222222-0000-0000-0000-000000000000"}
+	tests := []struct {
+		name     string
+		ids      []string
+		uuids    [][]string
+		expected []string
+	}{
+		{
+			name:     "fat library with the same install name",
+			ids:      []string{"@rpath/libz.dylib", "@rpath/libz.dylib"},
+			uuids:    [][]string{uuids, uuids},
+			expected: []string{"id @rpath/libz.dylib"},
+		},
+		{
+			name:     "fat library with different install names",
+			ids:      []string{"@rpath/libz.dylib", "/usr/local/lib/libz.dylib"},
+			uuids:    [][]string{uuids, uuids},
+			expected: []string{"uuid " + uuids[0]},
+		},
+		{
+			name:     "architectures shared by different copies",
+			ids:      []string{"@rpath/libz.dylib", "/usr/local/lib/libz.dylib", "/opt/lib/libz.dylib"},
+			uuids:    [][]string{uuids, uuids, uuids[1:]},
+			expected: []string{"uuid " + uuids[0], "uuid " + uuids[1]},
+		},
+	}
+
+	for _, test := range tests {
+		var deps []*Dependency
+		for i, id := range test.ids {
+			realPath := fmt.Sprintf("/copy%d/libz.dylib", i)
+			deps = append(deps, &Dependency{Name: "libz.dylib", Path: realPath, RealPath: realPath, ID: id, UUIDs: test.uuids[i]})
+		}
+		graph := newTestGraph(&Dependency{Name: "main", Path: "/main", RealPath: "/main"}, deps...)
+
+		var actual []string
+		for _, dup := range DepsDuplicates(graph) {
+			actual = append(actual, fmt.Sprintf("%s %s", dup.Kind, dup.Key))
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: Expected %v but got %v", test.name, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package lddx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// frameworkPath contains the components of a path to the binary
+// of a framework bundle, e.g. /Library/Frameworks/Foo.framework/Versions/A/Foo
+type frameworkPath struct {
+	Bundle  string // The path to the bundle (e.g. /Library/Frameworks/Foo.framework)
+	Name    string // The name of the framework (e.g. Foo)
+	Version string // The bundle version (e.g. A), or empty for shallow bundles
+}
+
+// parseFrameworkPath determines if the path refers to the binary of a
+// framework bundle. Both versioned (Foo.framework/Versions/A/Foo) and
+// shallow (Foo.framework/Foo) bundles are recognised. Other files that
+// happen to live inside a bundle are not considered to be frameworks.
+func parseFrameworkPath(path string) (*frameworkPath, bool) {
+	parts := strings.Split(path, "/")
+
+	for i := len(parts) - 2; i >= 0; i-- {
+		if !strings.HasSuffix(parts[i], ".framework") {
+			continue
+		}
+
+		name := strings.TrimSuffix(parts[i], ".framework")
+		rest := parts[i+1:]
+		ret := &frameworkPath{
+			Bundle: strings.Join(parts[:i+1], "/"),
+			Name:   name,
+		}
+
+		if name == "" {
+			return nil, false
+		} else if len(rest) == 1 && rest[0] == name {
+			return ret, true
+		} else if len(rest) == 3 && rest[0] == "Versions" && rest[1] != "" && rest[2] == name {
+			ret.Version = rest[1]
+			return ret, true
+		}
+		return nil, false
+	}
+
+	return nil, false
+}
+
+// getFrameworkPath returns the framework components of the dependency.
+// The real path is preferred, as it contains the actual bundle version
+// once symlinks (e.g. Versions/Current) have been resolved.
+func getFrameworkPath(dep *Dependency) (*frameworkPath, bool) {
+	if fw, ok := parseFrameworkPath(dep.RealPath); ok {
+		return fw, true
+	}
+	return parseFrameworkPath(dep.Path)
+}
+
+// isFrameworkLib determines if the dependency is the binary of a framework bundle.
+func isFrameworkLib(dep *Dependency) bool {
+	return dep.Framework != ""
+}
+
+// collectedPath returns the path, relative to the collection folder,
+// that the dependency will be collected into. Plain libraries are placed
+// directly in the folder, while frameworks keep their bundle layout.
+func collectedPath(dep *Dependency) string {
+	if fw, ok := getFrameworkPath(dep); ok && isFrameworkLib(dep) {
+		rel, err := filepath.Rel(fw.Bundle, dep.RealPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = dep.Name
+		}
+		return filepath.Join(filepath.Base(fw.Bundle), rel)
+	}
+	return dep.Name
+}
+
+// collectedName returns the name of the entry in the collection folder
+// that the dependency will be collected into. For frameworks, this is
+// the name of the bundle.
+func collectedName(dep *Dependency) string {
+	if isFrameworkLib(dep) {
+		return dep.Framework + ".framework"
+	}
+	return dep.Name
+}
+
+// copyTree recursively copies a folder, preserving any symlinks within it.
+// Regular files are made writeable so that they may be modified afterwards.
+func copyTree(from, to string) error {
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+
+		if (info.Mode() & os.ModeSymlink) != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		} else if info.IsDir() {
+			return os.MkdirAll(target, info.Mode()|0700)
+		}
+		return copyFile(path, target)
+	}
+
+	return filepath.Walk(from, walkFn)
+}
+
+// copyFrameworkBundle copies the entire framework bundle that contains
+// the dependency into the given folder. This includes the Versions/Current
+// symlinks, Resources and Info.plist files.
+func copyFrameworkBundle(dep *Dependency, folder string) error {
+	fw, ok := getFrameworkPath(dep)
+	if !ok {
+		return fmt.Errorf("%s: Not a framework", dep.Path)
+	}
+
+	destination := filepath.Join(folder, filepath.Base(fw.Bundle))
+	if err := os.RemoveAll(destination); err != nil {
+		return err
+	}
+	return copyTree(fw.Bundle, destination)
+}
@@ -0,0 +1,91 @@
+package lddx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type parseFrameworkPathTest struct {
+	path            string
+	expectedOk      bool
+	expectedBundle  string
+	expectedName    string
+	expectedVersion string
+}
+
+func TestParseFrameworkPath(t *testing.T) {
+	testcases := []parseFrameworkPathTest{
+		{path: "/Library/Frameworks/Foo.framework/Versions/A/Foo", expectedOk: true, expectedBundle: "/Library/Frameworks/Foo.framework", expectedName: "Foo", expectedVersion: "A"},
+		{path: "/Library/Frameworks/Foo.framework/Versions/Current/Foo", expectedOk: true, expectedBundle: "/Library/Frameworks/Foo.framework", expectedName: "Foo", expectedVersion: "Current"},
+		{path: "@rpath/Qt Core.framework/Versions/5/Qt Core", expectedOk: true, expectedBundle: "@rpath/Qt Core.framework", expectedName: "Qt Core", expectedVersion: "5"},
+		{path: "/Library/Frameworks/Foo.framework/Foo", expectedOk: true, expectedBundle: "/Library/Frameworks/Foo.framework", expectedName: "Foo", expectedVersion: ""},
+		{path: "/Library/Frameworks/Foo.framework/Versions/A/Bar", expectedOk: false},
+		{path: "/Library/Frameworks/Foo.framework/Versions/A/Libraries/libbar.dylib", expectedOk: false},
+		{path: "/Library/Frameworks/Foo.framework", expectedOk: false},
+		{path: "/usr/local/bin/plugin", expectedOk: false},
+		{path: "/usr/local/lib/libfoo", expectedOk: false},
+		{path: "/usr/local/lib/libfoo.dylib", expectedOk: false},
+	}
+
+	for _, test := range testcases {
+		fw, ok := parseFrameworkPath(test.path)
+		if ok != test.expectedOk {
+			t.Errorf("Path %s: Expected ok %v but got %v", test.path, test.expectedOk, ok)
+		} else if ok && (fw.Bundle != test.expectedBundle || fw.Name != test.expectedName || fw.Version != test.expectedVersion) {
+			t.Errorf("Path %s: Expected (%s, %s, %s) but got (%s, %s, %s)", test.path,
+				test.expectedBundle, test.expectedName, test.expectedVersion,
+				fw.Bundle, fw.Name, fw.Version)
+		}
+	}
+}
+
+func TestCopyFrameworkBundle(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	bundle := filepath.Join(src, "Foo.framework")
+
+	if err := os.MkdirAll(filepath.Join(bundle, "Versions/A/Resources"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"Versions/A/Foo", "Versions/A/Resources/Info.plist"} {
+		if err := os.WriteFile(filepath.Join(bundle, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"Versions/Current": "A",
+		"Foo":              "Versions/Current/Foo",
+		"Resources":        "Versions/Current/Resources",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(bundle, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dep := &Dependency{
+		Name:     "Foo",
+		Path:     "@rpath/Foo.framework/Foo",
+		RealPath: filepath.Join(bundle, "Versions/A/Foo"),
+	}
+	setFrameworkInfo(dep)
+	if dep.Framework != "Foo" || dep.FrameworkVersion != "A" {
+		t.Fatalf("Expected framework Foo (A) but got %s (%s)", dep.Framework, dep.FrameworkVersion)
+	} else if path := collectedPath(dep); path != filepath.Join("Foo.framework", "Versions", "A", "Foo") {
+		t.Fatalf("Unexpected collected path %s", path)
+	} else if err := copyFrameworkBundle(dep, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for link, target := range links {
+		if got, err := os.Readlink(filepath.Join(dst, "Foo.framework", link)); err != nil {
+			t.Errorf("Link %s: %s", link, err)
+		} else if got != target {
+			t.Errorf("Link %s: Expected target %s but got %s", link, target, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "Foo.framework", "Resources", "Info.plist")); err != nil {
+		t.Errorf("Info.plist was not collected: %s", err)
+	}
+}
@@ -0,0 +1,176 @@
+package lddx
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// testMachO describes a minimal Mach-O file to be generated for tests.
+type testMachO struct {
+	ID       string     // The LC_ID_DYLIB install name, if any
+	Dylibs   []string   // LC_LOAD_DYLIB entries
+	Weak     []string   // LC_LOAD_WEAK_DYLIB entries
+	RPaths   []string   // LC_RPATH entries
+	UUID     [16]byte   // LC_UUID, if non-zero
+	Symbols  int        // The number of symbols in the LC_SYMTAB symbol table, if non-zero
+	FileType macho.Type // The file type, if not MH_EXECUTE (or MH_DYLIB if there is an ID)
+}
+
+func padLoadCmd(buf *bytes.Buffer, str string) {
+	buf.WriteString(str)
+	buf.WriteByte(0)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+func dylibLoadCmd(cmd uint32, name string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{cmd, 0, 24, 2, 0x10203, 0x10000})
+	padLoadCmd(&buf, name)
+	ret := buf.Bytes()
+	binary.LittleEndian.PutUint32(ret[4:], uint32(len(ret)))
+	return ret
+}
+
+// writeTestMachO writes a 64-bit little endian Mach-O file that only
+// consists of a header and the load commands described by m.
+func writeTestMachO(t testing.TB, path string, m testMachO) {
+	t.Helper()
+
+	var cmds [][]byte
+	if m.ID != "" {
+		cmds = append(cmds, dylibLoadCmd(0xd, m.ID))
+	}
+	for _, lib := range m.Dylibs {
+		cmds = append(cmds, dylibLoadCmd(0xc, lib))
+	}
+	for _, lib := range m.Weak {
+		cmds = append(cmds, dylibLoadCmd(loadCmdWeakDylib, lib))
+	}
+	for _, rpath := range m.RPaths {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, []uint32{0x8000001c, 0, 12})
+		padLoadCmd(&buf, rpath)
+		cmd := buf.Bytes()
+		binary.LittleEndian.PutUint32(cmd[4:], uint32(len(cmd)))
+		cmds = append(cmds, cmd)
+	}
+	if m.UUID != [16]byte{} {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, []uint32{0x1b, 24})
+		buf.Write(m.UUID[:])
+		cmds = append(cmds, buf.Bytes())
+	}
+
+	if m.Symbols > 0 {
+		// The offsets are filled in once the size of the load commands is known
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, []uint32{0x2, 24, 0, uint32(m.Symbols), 0, 0})
+		cmds = append(cmds, buf.Bytes())
+	}
+
+	fileType := uint32(2) // MH_EXECUTE
+	if m.FileType != 0 {
+		fileType = uint32(m.FileType)
+	} else if m.ID != "" {
+		fileType = 6 // MH_DYLIB
+	}
+
+	sizeOfCmds := 0
+	for _, cmd := range cmds {
+		sizeOfCmds += len(cmd)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{
+		mhMagic64, 0x01000007, 3, fileType, uint32(len(cmds)), uint32(sizeOfCmds), 0, 0,
+	})
+	for _, cmd := range cmds {
+		buf.Write(cmd)
+	}
+
+	if m.Symbols > 0 {
+		var strtab bytes.Buffer
+		strtab.WriteByte(0)
+		symtab := buf.Bytes()[buf.Len()-24:]
+		binary.LittleEndian.PutUint32(symtab[8:], uint32(buf.Len()))
+		for i := 0; i < m.Symbols; i++ {
+			binary.Write(&buf, binary.LittleEndian, struct {
+				Name  uint32
+				Type  uint8
+				Sect  uint8
+				Desc  uint16
+				Value uint64
+			}{uint32(strtab.Len()), 0xf, 1, 0, uint64(0x1000 + i*16)})
+			strtab.WriteString(fmt.Sprintf("_symbol_%d", i))
+			strtab.WriteByte(0)
+		}
+		symtab = buf.Bytes()[32+sizeOfCmds-24:]
+		binary.LittleEndian.PutUint32(symtab[16:], uint32(buf.Len()))
+		binary.LittleEndian.PutUint32(symtab[20:], uint32(strtab.Len()))
+		buf.Write(strtab.Bytes())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeInstallNameTool puts an install_name_tool shell script with the given
+// body first on the PATH, for the duration of the test. Its arguments are
+// appended to the log file returned, one invocation per line.
+func fakeInstallNameTool(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("install_name_tool is faked with a shell script")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "install_name_tool.log")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> '%s'\n%s\n", log, body)
+	if err := os.WriteFile(filepath.Join(dir, "install_name_tool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+// newTestGraph returns a graph of the top-level file and its direct dependencies.
+func newTestGraph(topDep *Dependency, deps ...*Dependency) *DependencyGraph {
+	topDep.Deps = &deps
+	graph := &DependencyGraph{
+		TopDeps:  []*Dependency{topDep},
+		FlatDeps: make(map[string]*Dependency),
+	}
+	for _, dep := range deps {
+		if !dep.Pruned && !dep.NotResolved {
+			graph.FlatDeps[dep.RealPath] = dep
+		}
+	}
+	return graph
+}
+
+// newTestDiff returns the diff with the lists that are nil replaced by empty
+// lists, as DepsDiff returns them.
+func newTestDiff(diff GraphDiff) *GraphDiff {
+	for _, list := range []*[]string{&diff.Added, &diff.Removed, &diff.NewlyUnresolved} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	for _, list := range []*[]DiffChange{&diff.PathChanges, &diff.VersionChanges} {
+		if *list == nil {
+			*list = []DiffChange{}
+		}
+	}
+	return &diff
+}
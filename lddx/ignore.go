@@ -0,0 +1,148 @@
+package lddx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRuleKind specifies how the pattern of an ignore rule is matched.
+type IgnoreRuleKind string
+
+// The kinds of patterns that an ignore rule may have.
+const (
+	IgnoreGlob  IgnoreRuleKind = "glob"  // A glob, where ** also matches across path separators
+	IgnoreRegex IgnoreRuleKind = "regex" // A regular expression, which may match any part of the value
+)
+
+// IgnoreTarget specifies which field of a dependency an ignore rule is matched against.
+type IgnoreTarget string
+
+// The fields that an ignore rule may be matched against.
+const (
+	IgnoreTargetAny         IgnoreTarget = "any"          // Any of the fields below
+	IgnoreTargetName        IgnoreTarget = "name"         // The library name (e.g. libz.1.dylib)
+	IgnoreTargetInstallName IgnoreTarget = "install-name" // The path in the load command (e.g. @rpath/libz.1.dylib)
+	IgnoreTargetRealPath    IgnoreTarget = "real-path"    // The resolved path (e.g. /usr/local/lib/libz.1.dylib)
+)
+
+// IgnoreRule prunes the dependencies that match its pattern.
+type IgnoreRule struct {
+	Rule    string         // The rule as it was specified
+	Kind    IgnoreRuleKind // How the pattern is matched
+	Target  IgnoreTarget   // The field that the pattern is matched against
+	Pattern string         // The pattern to match
+	regex   *regexp.Regexp
+}
+
+// globToRegexp converts a glob to an anchored regular expression. A * or ?
+// does not match a path separator, while ** matches any number of folders.
+func globToRegexp(glob string) string {
+	var ret strings.Builder
+	ret.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// **/ matches zero or more folders
+					i++
+					ret.WriteString("(.*/)?")
+				} else {
+					ret.WriteString(".*")
+				}
+			} else {
+				ret.WriteString("[^/]*")
+			}
+		case '?':
+			ret.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end >= 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				ret.WriteString("[" + class + "]")
+				i += end + 1
+			} else {
+				ret.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		default:
+			ret.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	ret.WriteString("$")
+	return ret.String()
+}
+
+// ParseIgnoreRule parses an ignore rule of the form [target:]kind:pattern,
+// e.g. glob:**/Python.framework/** or real-path:regex:^/opt/local/.
+// The target is one of any, name, install-name or real-path, and defaults to
+// any. The kind is either glob or regex. If no kind is specified, the pattern
+// is treated as a glob.
+func ParseIgnoreRule(rule string) (*IgnoreRule, error) {
+	ret := &IgnoreRule{
+		Rule:   rule,
+		Kind:   IgnoreGlob,
+		Target: IgnoreTargetAny,
+	}
+
+	pattern := rule
+	if parts := strings.SplitN(pattern, ":", 2); len(parts) == 2 {
+		switch IgnoreTarget(parts[0]) {
+		case IgnoreTargetAny, IgnoreTargetName, IgnoreTargetInstallName, IgnoreTargetRealPath:
+			ret.Target = IgnoreTarget(parts[0])
+			pattern = parts[1]
+		}
+	}
+	if parts := strings.SplitN(pattern, ":", 2); len(parts) == 2 {
+		switch IgnoreRuleKind(parts[0]) {
+		case IgnoreGlob, IgnoreRegex:
+			ret.Kind = IgnoreRuleKind(parts[0])
+			pattern = parts[1]
+		}
+	}
+
+	if pattern == "" {
+		return nil, fmt.Errorf("%s: Empty pattern in ignore rule", rule)
+	}
+	ret.Pattern = pattern
+
+	expr := pattern
+	if ret.Kind == IgnoreGlob {
+		expr = globToRegexp(pattern)
+	}
+
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: Invalid ignore rule: %s", rule, err)
+	}
+	ret.regex = regex
+	return ret, nil
+}
+
+// String returns the rule as it was specified.
+func (r *IgnoreRule) String() string {
+	return r.Rule
+}
+
+// Matches checks if the rule matches the given field of a dependency.
+func (r *IgnoreRule) Matches(target IgnoreTarget, value string) bool {
+	if r.Target != IgnoreTargetAny && r.Target != target {
+		return false
+	}
+	return r.regex.MatchString(value)
+}
+
+// matchIgnoreRules returns the first rule that matches the given field of the dependency.
+func matchIgnoreRules(rules []*IgnoreRule, target IgnoreTarget, value string) *IgnoreRule {
+	for _, rule := range rules {
+		if rule.Matches(target, value) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package lddx
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type ignoreRuleTest struct {
+	rule          string
+	target        IgnoreTarget
+	value         string
+	expectedMatch bool
+}
+
+func TestIgnoreRule(t *testing.T) {
+	testcases := []ignoreRuleTest{
+		{rule: "glob:**/Python.framework/**", target: IgnoreTargetRealPath, value: "/Library/Frameworks/Python.framework/Versions/3.9/Python", expectedMatch: true},
+		{rule: "glob:**/Python.framework/**", target: IgnoreTargetInstallName, value: "@rpath/Python.framework/Python", expectedMatch: true},
+		{rule: "glob:**/Python.framework/**", target: IgnoreTargetRealPath, value: "/Library/Frameworks/Tcl.framework/Tcl", expectedMatch: false},
+		{rule: "libgfortran.*.dylib", target: IgnoreTargetName, value: "libgfortran.5.dylib", expectedMatch: true},
+		{rule: "libgfortran.*.dylib", target: IgnoreTargetRealPath, value: "/opt/lib/libgfortran.5.dylib", expectedMatch: false},
+		{rule: "glob:/opt/*/libz.dylib", target: IgnoreTargetRealPath, value: "/opt/local/lib/libz.dylib", expectedMatch: false},
+		{rule: "glob:/opt/lib/libz.[0-9].dylib", target: IgnoreTargetRealPath, value: "/opt/lib/libz.1.dylib", expectedMatch: true},
+		{rule: "glob:/opt/lib/libz.[!0-9].dylib", target: IgnoreTargetRealPath, value: "/opt/lib/libz.1.dylib", expectedMatch: false},
+		{rule: "real-path:regex:^/opt/local/", target: IgnoreTargetRealPath, value: "/opt/local/lib/libz.dylib", expectedMatch: true},
+		{rule: "real-path:regex:^/opt/local/", target: IgnoreTargetInstallName, value: "/opt/local/lib/libz.dylib", expectedMatch: false},
+		{rule: "install-name:regex:^@rpath/", target: IgnoreTargetInstallName, value: "@rpath/libz.dylib", expectedMatch: true},
+		{rule: "name:glob:libz*", target: IgnoreTargetName, value: "libz.1.dylib", expectedMatch: true},
+		{rule: "regex:libz", target: IgnoreTargetName, value: "libzstd.dylib", expectedMatch: true},
+	}
+
+	for _, test := range testcases {
+		rule, err := ParseIgnoreRule(test.rule)
+		if err != nil {
+			t.Errorf("Rule %s: Unexpected error: %s", test.rule, err)
+		} else if match := rule.Matches(test.target, test.value); match != test.expectedMatch {
+			t.Errorf("Rule %s: Expected match %v for %s %s but got %v", test.rule, test.expectedMatch, test.target, test.value, match)
+		}
+	}
+
+	for _, rule := range []string{"regex:(", "glob:", "real-path:"} {
+		if _, err := ParseIgnoreRule(rule); err == nil {
+			t.Errorf("Rule %s: Expected error but got nil", rule)
+		}
+	}
+}
+
+func TestDepsReadIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/libgfortran.5.dylib", "@loader_path/libz.dylib", "@loader_path/sys/libSystem.B.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "sys", "libSystem.B.dylib"), testMachO{ID: "/usr/lib/libSystem.B.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "libgfortran.5.dylib"), testMachO{ID: "@rpath/libgfortran.5.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "libz.dylib"), testMachO{ID: "@rpath/libz.dylib"})
+
+	rules := []*IgnoreRule{}
+	for _, rule := range []string{"name:libgfortran.*.dylib", "real-path:glob:**/libz.dylib"} {
+		ignoreRule, err := ParseIgnoreRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, ignoreRule)
+	}
+
+	opts := DependencyOptions{IgnoreRules: rules, IgnoredPrefixes: []string{filepath.Join(dir, "sys")}}
+	graph, err := DepsRead(opts, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"@loader_path/libgfortran.5.dylib":   "rule:name:libgfortran.*.dylib",
+		"@loader_path/libz.dylib":            "rule:real-path:glob:**/libz.dylib",
+		"@loader_path/sys/libSystem.B.dylib": "ignore-prefix:" + filepath.Join(dir, "sys"),
+	}
+	for _, dep := range *graph.TopDeps[0].Deps {
+		if !dep.Pruned || dep.PrunedBy != expected[dep.Path] {
+			t.Errorf("Dependency %s: Expected to be pruned by %s but got %s (pruned: %v)", dep.Path, expected[dep.Path], dep.PrunedBy, dep.Pruned)
+		}
+	}
+}
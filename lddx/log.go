@@ -1,55 +1,174 @@
 package lddx
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
 	"sync"
 
 	"github.com/fatih/color"
 	"github.com/mattn/go-colorable"
 )
 
-var logMutex sync.Mutex
-var isQuiet bool
+// Logger receives the log messages emitted while calculating or
+// collecting dependencies. Implementations must be safe for concurrent use.
+type Logger interface {
+	Error(format string, args ...interface{}) // Logs an error message
+	Warn(format string, args ...interface{})  // Logs a warning message
+	Info(format string, args ...interface{})  // Logs an info message
+	Note(format string, args ...interface{})  // Logs a note message
+}
+
+// ColorLogger is a Logger that writes colourised messages to a writer.
+// Info and note messages are omitted if the logger is quiet.
+type ColorLogger struct {
+	out     io.Writer
+	quiet   bool
+	lock    sync.Mutex
+	red     *color.Color
+	yellow  *color.Color
+	green   *color.Color
+	magenta *color.Color
+}
+
+// NewColorLogger creates a logger that writes to out, optionally without colour.
+// Otherwise, colour is used if supported by the terminal.
+func NewColorLogger(out io.Writer, noColor, quiet bool) *ColorLogger {
+	ret := &ColorLogger{
+		out:     out,
+		quiet:   quiet,
+		red:     color.New(color.FgRed),
+		yellow:  color.New(color.FgYellow),
+		green:   color.New(color.FgGreen),
+		magenta: color.New(color.FgMagenta),
+	}
+
+	if noColor {
+		for _, c := range []*color.Color{ret.red, ret.yellow, ret.green, ret.magenta} {
+			c.DisableColor()
+		}
+	}
+	return ret
+}
+
+func (l *ColorLogger) log(c *color.Color, format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	c.Fprintf(l.out, format, args...)
+}
 
-func init() {
-	color.Output = colorable.NewColorableStderr()
+// Error logs an error message
+func (l *ColorLogger) Error(format string, args ...interface{}) {
+	l.log(l.red, format, args...)
 }
 
-// LogInit initialises the logger
+// Warn logs a warning message
+func (l *ColorLogger) Warn(format string, args ...interface{}) {
+	l.log(l.yellow, format, args...)
+}
+
+// Info logs an info message
+func (l *ColorLogger) Info(format string, args ...interface{}) {
+	if !l.quiet {
+		l.log(l.green, format, args...)
+	}
+}
+
+// Note logs a note message
+func (l *ColorLogger) Note(format string, args ...interface{}) {
+	if !l.quiet {
+		l.log(l.magenta, format, args...)
+	}
+}
+
+// SlogLogger is a Logger that forwards messages to a log/slog logger.
+// Errors, warnings and info messages are logged at the matching slog
+// level, while notes are logged at the debug level.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a logger that forwards messages to the slog logger.
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger: logger}
+}
+
+func (l *SlogLogger) log(level slog.Level, format string, args ...interface{}) {
+	l.logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+// Error logs an error message
+func (l *SlogLogger) Error(format string, args ...interface{}) {
+	l.log(slog.LevelError, format, args...)
+}
+
+// Warn logs a warning message
+func (l *SlogLogger) Warn(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, format, args...)
+}
+
+// Info logs an info message
+func (l *SlogLogger) Info(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, format, args...)
+}
+
+// Note logs a note message
+func (l *SlogLogger) Note(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, format, args...)
+}
+
+var defaultLoggerLock sync.RWMutex
+var defaultLogger Logger = NewColorLogger(colorable.NewColorableStderr(), color.NoColor, false)
+
+// LogInit initialises the default logger
 func LogInit(noColor, quiet bool) {
-	color.NoColor = noColor
-	isQuiet = quiet
+	SetDefaultLogger(NewColorLogger(colorable.NewColorableStderr(), noColor, quiet))
+}
+
+// SetDefaultLogger sets the logger used when no logger is specified in
+// the options, and by the package level logging functions.
+func SetDefaultLogger(logger Logger) {
+	defaultLoggerLock.Lock()
+	defer defaultLoggerLock.Unlock()
+	defaultLogger = logger
+}
+
+// DefaultLogger returns the logger used when no logger is specified in the options.
+func DefaultLogger() Logger {
+	defaultLoggerLock.RLock()
+	defer defaultLoggerLock.RUnlock()
+	return defaultLogger
+}
+
+// orDefaultLogger returns the logger, or the default logger if it is nil.
+func orDefaultLogger(logger Logger) Logger {
+	if logger == nil {
+		return DefaultLogger()
+	}
+	return logger
 }
 
 // LogError logs an error message
 func LogError(format string, args ...interface{}) {
-	logMutex.Lock()
-	defer logMutex.Unlock()
-	color.Red(format, args...)
+	DefaultLogger().Error(format, args...)
 }
 
 // LogWarn logs a warning message
 func LogWarn(format string, args ...interface{}) {
-	logMutex.Lock()
-	defer logMutex.Unlock()
-	color.Yellow(format, args...)
+	DefaultLogger().Warn(format, args...)
 }
 
 // LogInfo logs an info message
 func LogInfo(format string, args ...interface{}) {
-	if isQuiet {
-		return
-	}
-	logMutex.Lock()
-	defer logMutex.Unlock()
-	color.Green(format, args...)
+	DefaultLogger().Info(format, args...)
 }
 
 // LogNote logs a note message
 func LogNote(format string, args ...interface{}) {
-	if isQuiet {
-		return
-	}
-	logMutex.Lock()
-	defer logMutex.Unlock()
-	color.Magenta(format, args...)
+	DefaultLogger().Note(format, args...)
 }
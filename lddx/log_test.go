@@ -0,0 +1,32 @@
+package lddx
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerPerAnalysis(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMachO(t, filepath.Join(dir, "main1"), testMachO{Dylibs: []string{"@rpath/libone.dylib"}})
+	writeTestMachO(t, filepath.Join(dir, "main2"), testMachO{Dylibs: []string{"@rpath/libtwo.dylib"}})
+
+	var out1, out2 bytes.Buffer
+	opts1 := DependencyOptions{Logger: NewColorLogger(&out1, true, false)}
+	opts2 := DependencyOptions{Logger: NewSlogLogger(slog.New(slog.NewTextHandler(&out2, nil)))}
+
+	if _, err := DepsRead(opts1, filepath.Join(dir, "main1")); err != nil {
+		t.Fatal(err)
+	} else if _, err := DepsRead(opts2, filepath.Join(dir, "main2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out1.String(), "libone") || strings.Contains(out1.String(), "libtwo") {
+		t.Errorf("Unexpected output from first logger: %q", out1.String())
+	}
+	if !strings.Contains(out2.String(), "level=WARN") || !strings.Contains(out2.String(), "libtwo") || strings.Contains(out2.String(), "libone") {
+		t.Errorf("Unexpected output from second logger: %q", out2.String())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"debug/macho"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -21,6 +22,13 @@ const (
 	loadCmdReq       = 0x80000000
 	loadCmdWeakDylib = (0x18 | loadCmdReq)
 	loadCmdId        = 0x0d
+	loadCmdUUID      = 0x1b
+
+	loadCmdVersionMinMacOSX   = 0x24
+	loadCmdVersionMinIPhoneOS = 0x25
+	loadCmdVersionMinTvOS     = 0x2f
+	loadCmdVersionMinWatchOS  = 0x30
+	loadCmdBuildVersion       = 0x32
 )
 
 type ArchType struct {
@@ -28,6 +36,30 @@ type ArchType struct {
 	SubCpu uint32    // ???
 }
 
+// archNames are the names of the architectures (as used by lipo and otool),
+// keyed by CPU type and then subtype, with 0 for the default name.
+var archNames = map[macho.Cpu]map[uint32]string{
+	macho.Cpu386:   {0: "i386"},
+	macho.CpuAmd64: {0: "x86_64", 8: "x86_64h"},
+	macho.CpuArm:   {0: "arm", 6: "armv6", 9: "armv7", 11: "armv7s", 12: "armv7k"},
+	macho.CpuArm64: {0: "arm64", 2: "arm64e"},
+	macho.CpuPpc:   {0: "ppc"},
+	macho.CpuPpc64: {0: "ppc64"},
+}
+
+// String returns the name of the architecture (e.g. x86_64 or arm64).
+func (a *ArchType) String() string {
+	names, ok := archNames[a.Cpu]
+	if !ok {
+		return fmt.Sprintf("cpu%d", uint32(a.Cpu))
+	}
+	// The upper byte of the subtype holds capability bits
+	if name, ok := names[a.SubCpu&0xffffff]; ok {
+		return name
+	}
+	return names[0]
+}
+
 type Dylib struct {
 	Path           string    // The path to the library
 	Time           uint32    // Time of library
@@ -48,8 +80,8 @@ func IsFatMachO(file string) (bool, error) {
 	defer fp.Close()
 
 	bytes := make([]byte, 4)
-	if num, err := fp.Read(bytes); num != 4 || err != nil {
-		if err != nil && err != io.EOF {
+	if _, err := io.ReadFull(fp, bytes); err != nil {
+		if err != io.EOF {
 			return false, err
 		}
 		return false, nil
@@ -124,97 +156,313 @@ func TryParseLoadCmd(loadCmd macho.LoadCmd, data []byte, byteOrder binary.ByteOr
 	}, nil
 }
 
-// ReadDylibs returns the list of dynamic libraries referenced by a file.
-// The file may either be a fat file or a normal Mach-O file.
-// This method will search for both normal libs and weakly loaded libs.
-func ReadDylibs(file string, limiter chan int) ([]Dylib, []string, error) {
-	var libs []*macho.File
-	var rpaths []string
+// BuildVersion describes the platform and OS versions that a file was built for,
+// from either LC_BUILD_VERSION or one of the LC_VERSION_MIN_* load commands.
+type BuildVersion struct {
+	Platform string // The platform (e.g. macos or ios)
+	MinOS    string // The minimum OS version
+	SDK      string // The SDK version
+}
 
-	if limiter != nil {
-		<-limiter
-		defer func() { limiter <- 1 }()
+// LoadInfo contains the information read from the load commands of a file.
+type LoadInfo struct {
+	Dylibs        []Dylib        // The libraries referenced by the file
+	RPaths        []string       // The rpaths of the file
+	IDs           []Dylib        // The identity of the file (from LC_ID_DYLIB), one per architecture
+	UUIDs         []string       // The UUIDs of the file, one per architecture
+	Arches        []string       // The architectures of the file (e.g. x86_64), one per architecture
+	BuildVersions []BuildVersion // The build versions of the file, one per architecture
+}
+
+// ErrNotMachO is returned when reading the load commands of a file
+// that is neither a Mach-O nor a Universal (fat) file.
+var ErrNotMachO = errors.New("Not a Mach-O/Universal binary")
+
+// buildPlatforms are the names of the platforms in LC_BUILD_VERSION.
+var buildPlatforms = map[uint32]string{
+	1:  "macos",
+	2:  "ios",
+	3:  "tvos",
+	4:  "watchos",
+	5:  "bridgeos",
+	6:  "maccatalyst",
+	7:  "iossimulator",
+	8:  "tvossimulator",
+	9:  "watchossimulator",
+	10: "driverkit",
+	11: "visionos",
+	12: "visionossimulator",
+}
+
+// versionMinPlatforms are the platforms of the LC_VERSION_MIN_* load commands.
+var versionMinPlatforms = map[macho.LoadCmd]string{
+	loadCmdVersionMinMacOSX:   "macos",
+	loadCmdVersionMinIPhoneOS: "ios",
+	loadCmdVersionMinTvOS:     "tvos",
+	loadCmdVersionMinWatchOS:  "watchos",
+}
+
+// formatUUID formats the raw bytes of a Mach-O UUID in the same way as dwarfdump.
+func formatUUID(uuid []byte) string {
+	return fmt.Sprintf("%X-%X-%X-%X-%X", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// formatOSVersion formats a version encoded as xxxx.yy.zz, omitting a zero patch version.
+func formatOSVersion(version uint32) string {
+	if version&0xff == 0 {
+		return fmt.Sprintf("%d.%d", version>>16, (version>>8)&0xff)
 	}
+	return fmt.Sprintf("%d.%d.%d", version>>16, (version>>8)&0xff, version&0xff)
+}
 
-	if fp, err := macho.Open(file); err != nil {
-		if fat, err := macho.OpenFat(file); err != nil {
-			return nil, nil, err
-		} else {
-			for _, lib := range fat.Arches {
-				libs = append(libs, lib.File)
-			}
-			defer fat.Close()
-		}
-	} else {
-		defer fp.Close()
-		libs = append(libs, fp)
+// readCString reads a NUL terminated string at the given offset of a load command.
+func readCString(data []byte, offset uint32) (string, error) {
+	if offset >= uint32(len(data)) {
+		return "", errors.New("invalid string offset in load command")
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return string(data[offset:]), nil
+	}
+	return string(data[offset : offset+uint32(end)]), nil
+}
+
+// loadCommand is a load command of a Mach-O file.
+type loadCommand struct {
+	Cmd  macho.LoadCmd // The type of the load command
+	Data []byte        // The whole load command, including its type and size
+}
+
+// machOLoadCommands contains the load commands of a Mach-O file, or of one
+// architecture of a Universal (fat) file.
+type machOLoadCommands struct {
+	Arch      *ArchType        // The architecture of the file
+	ByteOrder binary.ByteOrder // The byte order of the file
+	Is64      bool             // Indicates if this is a 64-bit Mach-O file
+	FileType  macho.Type       // The type of the file (e.g. executable or dylib)
+	Flags     uint32           // The flags in the header of the file
+	Commands  []loadCommand    // The load commands, in order
+}
+
+// readMachOLoadCommands reads the load commands of the Mach-O file at the given offset.
+// Only the header and the load commands are read, not the rest of the file.
+func readMachOLoadCommands(r io.ReaderAt, offset, size int64) (*machOLoadCommands, error) {
+	var header [32]byte
+	if _, err := r.ReadAt(header[:28], offset); err != nil {
+		return nil, ErrNotMachO
 	}
 
-	var ret []Dylib
-	for _, lib := range libs {
-		arch := ArchType{
-			Cpu:    lib.Cpu,
-			SubCpu: lib.SubCpu,
+	ret := &machOLoadCommands{}
+	headerSize := int64(28)
+	switch binary.LittleEndian.Uint32(header[0:4]) {
+	case mhMagic:
+		ret.ByteOrder = binary.LittleEndian
+	case mhCigam:
+		ret.ByteOrder = binary.BigEndian
+	case mhMagic64:
+		ret.ByteOrder, ret.Is64, headerSize = binary.LittleEndian, true, 32
+	case mhCigam64:
+		ret.ByteOrder, ret.Is64, headerSize = binary.BigEndian, true, 32
+	default:
+		return nil, ErrNotMachO
+	}
+
+	byteOrder := ret.ByteOrder
+	ret.Arch = &ArchType{
+		Cpu:    macho.Cpu(byteOrder.Uint32(header[4:8])),
+		SubCpu: byteOrder.Uint32(header[8:12]),
+	}
+	ret.FileType = macho.Type(byteOrder.Uint32(header[12:16]))
+	ret.Flags = byteOrder.Uint32(header[24:28])
+	numCmds := byteOrder.Uint32(header[16:20])
+	sizeOfCmds := int64(byteOrder.Uint32(header[20:24]))
+	if offset+headerSize+sizeOfCmds > size {
+		return nil, errors.New("load commands extend past the end of the file")
+	}
+
+	cmds := make([]byte, sizeOfCmds)
+	if _, err := r.ReadAt(cmds, offset+headerSize); err != nil {
+		return nil, err
+	}
+
+	for i := uint32(0); i < numCmds; i++ {
+		if len(cmds) < 8 {
+			return nil, fmt.Errorf("command block too small (load command %d)", i)
+		}
+		cmd := macho.LoadCmd(byteOrder.Uint32(cmds[0:4]))
+		cmdSize := byteOrder.Uint32(cmds[4:8])
+		if cmdSize < 8 || cmdSize > uint32(len(cmds)) {
+			return nil, fmt.Errorf("invalid command size %d (load command %d)", cmdSize, i)
 		}
+		ret.Commands = append(ret.Commands, loadCommand{Cmd: cmd, Data: cmds[:cmdSize]})
+		cmds = cmds[cmdSize:]
+	}
+	return ret, nil
+}
+
+// readLoadInfo adds the information in the load commands to info.
+func (m *machOLoadCommands) readLoadInfo(info *LoadInfo) error {
+	byteOrder := m.ByteOrder
+	info.Arches = append(info.Arches, m.Arch.String())
 
-		for _, load := range lib.Loads {
-			if dyl, ok := load.(*macho.Dylib); ok {
-				ret = append(ret, Dylib{
-					Path:           dyl.Name,
-					Time:           dyl.Time,
-					CurrentVersion: dyl.CurrentVersion,
-					CompatVersion:  dyl.CompatVersion,
-					Weak:           false,
-					Arch:           &arch,
+	for i, lc := range m.Commands {
+		cmd, data := lc.Cmd, lc.Data
+		switch cmd {
+		case macho.LoadCmdDylib, loadCmdWeakDylib, loadCmdId:
+			dylib, err := TryParseLoadCmd(cmd, data, byteOrder)
+			if err != nil {
+				return err
+			}
+			dylib.Weak = cmd == loadCmdWeakDylib
+			dylib.Arch = m.Arch
+			if cmd == loadCmdId {
+				info.IDs = append(info.IDs, *dylib)
+			} else {
+				info.Dylibs = append(info.Dylibs, *dylib)
+			}
+		case macho.LoadCmdRpath:
+			if len(data) < 12 {
+				return fmt.Errorf("invalid rpath command (load command %d)", i)
+			}
+			path, err := readCString(data, byteOrder.Uint32(data[8:12]))
+			if err != nil {
+				return err
+			}
+			info.RPaths = append(info.RPaths, path)
+		case loadCmdUUID:
+			if len(data) >= 24 {
+				info.UUIDs = append(info.UUIDs, formatUUID(data[8:24]))
+			}
+		case loadCmdBuildVersion:
+			if len(data) >= 20 {
+				platform := byteOrder.Uint32(data[8:12])
+				name, ok := buildPlatforms[platform]
+				if !ok {
+					name = fmt.Sprintf("platform %d", platform)
+				}
+				info.BuildVersions = append(info.BuildVersions, BuildVersion{
+					Platform: name,
+					MinOS:    formatOSVersion(byteOrder.Uint32(data[12:16])),
+					SDK:      formatOSVersion(byteOrder.Uint32(data[16:20])),
+				})
+			}
+		case loadCmdVersionMinMacOSX, loadCmdVersionMinIPhoneOS, loadCmdVersionMinTvOS, loadCmdVersionMinWatchOS:
+			if len(data) >= 16 {
+				info.BuildVersions = append(info.BuildVersions, BuildVersion{
+					Platform: versionMinPlatforms[cmd],
+					MinOS:    formatOSVersion(byteOrder.Uint32(data[8:12])),
+					SDK:      formatOSVersion(byteOrder.Uint32(data[12:16])),
 				})
-			} else if rp, ok := load.(*macho.Rpath); ok {
-				rpaths = append(rpaths, rp.Path)
-			} else if dl, err := TryParseLoadCmd(loadCmdWeakDylib, load.Raw(), lib.ByteOrder); err != nil {
-				return nil, nil, err
-			} else if dl != nil {
-				dl.Arch = &arch
-				ret = append(ret, *dl)
 			}
 		}
 	}
-	return ret, rpaths, nil
+	return nil
 }
 
-// GetDylibInfo gets information about the file itself, if available.
-// For example, if the file is a dylib, it returns information about the Dylib itself.
-func GetDylibInfo(file string) ([]Dylib, error) {
-	var libs []*macho.File
+// readFatOffsets reads the offset of each architecture in a Universal (fat) file.
+func readFatOffsets(r io.ReaderAt, size int64) ([]int64, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, ErrNotMachO
+	}
 
-	if fp, err := macho.Open(file); err != nil {
-		if fat, err := macho.OpenFat(file); err != nil {
-			return nil, err
-		} else {
-			for _, lib := range fat.Arches {
-				libs = append(libs, lib.File)
-			}
-			defer fat.Close()
+	numArches := binary.BigEndian.Uint32(header[4:8])
+	if numArches < 1 || int64(numArches)*20 > size {
+		return nil, errors.New("invalid number of architectures in fat header")
+	}
+
+	arches := make([]byte, numArches*20)
+	if _, err := r.ReadAt(arches, 8); err != nil {
+		return nil, err
+	}
+	var ret []int64
+	for i := uint32(0); i < numArches; i++ {
+		ret = append(ret, int64(binary.BigEndian.Uint32(arches[i*20+8:])))
+	}
+	return ret, nil
+}
+
+// readFileLoadCommands reads the load commands of each architecture of a file,
+// which may either be a fat file or a normal Mach-O file. Also returns whether
+// it is a fat file. If the file is neither, the error is ErrNotMachO.
+func readFileLoadCommands(file string) ([]*machOLoadCommands, bool, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, false, err
+	}
+	defer fp.Close()
+
+	stat, err := fp.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var magic [4]byte
+	if _, err := fp.ReadAt(magic[:], 0); err != nil {
+		return nil, false, ErrNotMachO
+	}
+
+	offsets := []int64{0}
+	fat := binary.BigEndian.Uint32(magic[:]) == fatMagic
+	if fat {
+		if offsets, err = readFatOffsets(fp, stat.Size()); err != nil {
+			return nil, false, err
 		}
-	} else {
-		defer fp.Close()
-		libs = append(libs, fp)
 	}
 
-	var ret []Dylib
-	for _, lib := range libs {
-		arch := ArchType{
-			Cpu:    lib.Cpu,
-			SubCpu: lib.SubCpu,
+	var ret []*machOLoadCommands
+	for _, offset := range offsets {
+		cmds, err := readMachOLoadCommands(fp, offset, stat.Size())
+		if err != nil {
+			return nil, false, err
 		}
+		ret = append(ret, cmds)
+	}
+	return ret, fat, nil
+}
 
-		for _, load := range lib.Loads {
-			if dl, err := TryParseLoadCmd(loadCmdId, load.Raw(), lib.ByteOrder); err != nil {
-				return nil, err
-			} else if dl != nil {
-				dl.Arch = &arch
-				ret = append(ret, *dl)
-				break
-			}
+// ReadLoadInfo reads the libraries, rpaths, identity, UUIDs and build
+// versions of a file in one pass. The file may either be a fat file or a
+// normal Mach-O file. Only the headers and the load commands are read.
+// This method will search for both normal libs and weakly loaded libs.
+// If the file is neither, the error is ErrNotMachO.
+func ReadLoadInfo(file string, limiter chan int) (*LoadInfo, error) {
+	if limiter != nil {
+		<-limiter
+		defer func() { limiter <- 1 }()
+	}
+
+	arches, _, err := readFileLoadCommands(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &LoadInfo{}
+	for _, arch := range arches {
+		if err := arch.readLoadInfo(ret); err != nil {
+			return nil, err
 		}
 	}
 	return ret, nil
 }
+
+// ReadDylibs returns the list of dynamic libraries referenced by a file.
+// The file may either be a fat file or a normal Mach-O file.
+// This method will search for both normal libs and weakly loaded libs.
+func ReadDylibs(file string, limiter chan int) ([]Dylib, []string, error) {
+	info, err := ReadLoadInfo(file, limiter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info.Dylibs, info.RPaths, nil
+}
+
+// GetDylibInfo gets information about the file itself, if available.
+// For example, if the file is a dylib, it returns information about the Dylib itself.
+func GetDylibInfo(file string) ([]Dylib, error) {
+	info, err := ReadLoadInfo(file, nil)
+	if err != nil {
+		return nil, err
+	}
+	return info.IDs, nil
+}
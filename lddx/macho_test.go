@@ -1,7 +1,10 @@
 package lddx
 
 import (
+	"debug/macho"
+	"errors"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -35,3 +38,171 @@ func TestIsFatMachO(t *testing.T) {
 		}
 	}
 }
+
+func TestReadLoadInfo(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "libfoo.dylib")
+	writeTestMachO(t, file, testMachO{
+		ID:     "@rpath/libfoo.dylib",
+		Dylibs: []string{"/usr/lib/libSystem.B.dylib"},
+		Weak:   []string{"@rpath/libweak.dylib"},
+		RPaths: []string{"@loader_path/../lib"},
+		UUID:   [16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	})
+
+	info, err := ReadLoadInfo(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.IDs) != 1 || info.IDs[0].Path != "@rpath/libfoo.dylib" || info.IDs[0].Weak {
+		t.Errorf("Unexpected IDs %+v", info.IDs)
+	}
+	if len(info.Dylibs) != 2 || info.Dylibs[0].Path != "/usr/lib/libSystem.B.dylib" || info.Dylibs[0].Weak ||
+		info.Dylibs[1].Path != "@rpath/libweak.dylib" || !info.Dylibs[1].Weak {
+		t.Errorf("Unexpected dylibs %+v", info.Dylibs)
+	}
+	if !reflect.DeepEqual(info.RPaths, []string{"@loader_path/../lib"}) {
+		t.Errorf("Unexpected rpaths %v", info.RPaths)
+	}
+	if !reflect.DeepEqual(info.UUIDs, []string{"00010203-0405-0607-0809-0A0B0C0D0E0F"}) {
+		t.Errorf("Unexpected UUIDs %v", info.UUIDs)
+	}
+}
+
+func TestArchTypeString(t *testing.T) {
+	testcases := map[ArchType]string{
+		{Cpu: macho.CpuAmd64, SubCpu: 3}:          "x86_64",
+		{Cpu: macho.CpuAmd64, SubCpu: 8}:          "x86_64h",
+		{Cpu: macho.CpuArm64, SubCpu: 0}:          "arm64",
+		{Cpu: macho.CpuArm64, SubCpu: 0x80000002}: "arm64e",
+		{Cpu: macho.Cpu386, SubCpu: 3}:            "i386",
+		{Cpu: macho.CpuPpc, SubCpu: 0}:            "ppc",
+		{Cpu: 42, SubCpu: 0}:                      "cpu42",
+	}
+
+	for arch, expected := range testcases {
+		if name := arch.String(); name != expected {
+			t.Errorf("%+v: Expected %s, got %s", arch, expected, name)
+		}
+	}
+}
+
+// readLoadInfoDebugMachO reads the load information with debug/macho,
+// which parses the whole file, to check ReadLoadInfo against.
+func readLoadInfoDebugMachO(file string) (*LoadInfo, error) {
+	var libs []*macho.File
+	if fp, err := macho.Open(file); err != nil {
+		fat, err := macho.OpenFat(file)
+		if err != nil {
+			return nil, err
+		}
+		defer fat.Close()
+		for _, lib := range fat.Arches {
+			libs = append(libs, lib.File)
+		}
+	} else {
+		defer fp.Close()
+		libs = append(libs, fp)
+	}
+
+	ret := &LoadInfo{}
+	for _, lib := range libs {
+		arch := &ArchType{Cpu: lib.Cpu, SubCpu: lib.SubCpu}
+		ret.Arches = append(ret.Arches, arch.String())
+		for _, load := range lib.Loads {
+			raw := load.Raw()
+			if dyl, ok := load.(*macho.Dylib); ok {
+				ret.Dylibs = append(ret.Dylibs, Dylib{Path: dyl.Name, Time: dyl.Time,
+					CurrentVersion: dyl.CurrentVersion, CompatVersion: dyl.CompatVersion, Arch: arch})
+			} else if rp, ok := load.(*macho.Rpath); ok {
+				ret.RPaths = append(ret.RPaths, rp.Path)
+			} else if dl, _ := TryParseLoadCmd(loadCmdWeakDylib, raw, lib.ByteOrder); dl != nil {
+				dl.Arch = arch
+				ret.Dylibs = append(ret.Dylibs, *dl)
+			} else if dl, _ := TryParseLoadCmd(loadCmdId, raw, lib.ByteOrder); dl != nil {
+				dl.Arch = arch
+				dl.Weak = false
+				ret.IDs = append(ret.IDs, *dl)
+			} else if len(raw) >= 24 && lib.ByteOrder.Uint32(raw[0:4]) == loadCmdUUID {
+				ret.UUIDs = append(ret.UUIDs, formatUUID(raw[8:24]))
+			}
+		}
+	}
+	return ret, nil
+}
+
+type readLoadInfoTest struct {
+	file                  string
+	expectedBuildVersions []BuildVersion
+	expectedError         error
+}
+
+func TestReadLoadInfoFiles(t *testing.T) {
+	synthetic := filepath.Join(t.TempDir(), "libfoo.dylib")
+	writeTestMachO(t, synthetic, testMachO{
+		ID:      "@rpath/libfoo.dylib",
+		Dylibs:  []string{"/usr/lib/libSystem.B.dylib"},
+		Weak:    []string{"@rpath/libweak.dylib"},
+		RPaths:  []string{"@loader_path/../lib", "@executable_path"},
+		UUID:    [16]byte{1},
+		Symbols: 10,
+	})
+
+	testcases := []readLoadInfoTest{
+		{file: filepath.Join("testdata", "macho09")},
+		{file: filepath.Join("testdata", "macho10"), expectedBuildVersions: []BuildVersion{{Platform: "macos", MinOS: "10.12", SDK: "10.12"}}},
+		{file: synthetic},
+		{file: filepath.Join("testdata", "macho07"), expectedError: ErrNotMachO},
+		{file: filepath.Join("testdata", "macho08"), expectedError: ErrNotMachO},
+	}
+
+	for _, test := range testcases {
+		info, err := ReadLoadInfo(test.file, nil)
+		if test.expectedError != nil {
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("File %s: Expected error %v but got %v", test.file, test.expectedError, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("File %s: Unexpected error: %s", test.file, err)
+			continue
+		}
+
+		expected, err := readLoadInfoDebugMachO(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.BuildVersions = test.expectedBuildVersions
+		if !reflect.DeepEqual(info, expected) {
+			t.Errorf("File %s: Expected %+v but got %+v", test.file, expected, info)
+		}
+	}
+}
+
+func BenchmarkReadLoadInfo(b *testing.B) {
+	file := filepath.Join(b.TempDir(), "libfoo.dylib")
+	writeTestMachO(b, file, testMachO{
+		ID:      "@rpath/libfoo.dylib",
+		Dylibs:  []string{"/usr/lib/libSystem.B.dylib", "@rpath/libbar.dylib"},
+		RPaths:  []string{"@loader_path"},
+		Symbols: 20000,
+	})
+
+	readers := []struct {
+		name string
+		read func(string) (*LoadInfo, error)
+	}{
+		{name: "debug-macho", read: readLoadInfoDebugMachO},
+		{name: "load-commands", read: func(file string) (*LoadInfo, error) { return ReadLoadInfo(file, nil) }},
+	}
+	for _, reader := range readers {
+		b.Run(reader.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := reader.read(file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package lddx
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// The types of records written by NDJSONWriter.
+const (
+	NDJSONNodeRecord       = "node"
+	NDJSONEdgeRecord       = "edge"
+	NDJSONDiagnosticRecord = "diagnostic"
+)
+
+// NDJSONNode is the record written for each library. Nodes are identified
+// by their real path, so a library referenced by several install names
+// has a single node, with one edge per install name.
+type NDJSONNode struct {
+	Type             string   // Always "node"
+	RealPath         string   // The real path to the library, which identifies the node
+	Name             string   // The name of the library
+	Path             string   // The path to the library, as first seen
+	TopLevel         bool     // Indicates if the library is one of the files that was processed
+	Info             string   // Compatibility and current version info
+	Pruned           bool     // Indicates if checking the dependencies of this library were skipped
+	PrunedBy         string   // The option or ignore rule that caused this library to be pruned, if any
+	NotResolved      bool     // Indicates if the dependencies could not be resolved
+	Framework        string   // The name of the framework bundle, if this library is a framework binary
+	FrameworkVersion string   // The version of the framework bundle, if versioned
+	Origin           Origin   // The package manager (or system) that installed the library, if known
+	Package          string   // The name of the package that installed the library, if known
+	PackageVersion   string   // The version of the package that installed the library, if known
+	RPaths           []string // The rpaths associated with this file
+	ID               string   // The install name of the library itself, if available
+	IDInfo           string   // Compatibility and current version info of the library itself, if available
+	UUIDs            []string // The Mach-O UUIDs of the file, one per architecture
+	Arches           []string // The architectures of the file
+}
+
+// NDJSONEdge is the record written for each load command of a library.
+type NDJSONEdge struct {
+	Type string // Always "edge"
+	From string // The real path of the library with the load command
+	To   string // The real path of the library that is loaded
+	Path string // The path to the library, as specified by the load command
+	Weak bool   // Indicates if this is a weak load command
+}
+
+// NDJSONDiagnostic is the record written for each diagnostic.
+type NDJSONDiagnostic struct {
+	Type string // Always "diagnostic"
+	Diagnostic
+}
+
+// NDJSONWriter writes the dependency graph as newline delimited JSON while it
+// is being calculated, with one record per node and one per edge. Set its
+// Dependency method as the OnRead option of DepsRead. It is safe for concurrent use.
+type NDJSONWriter struct {
+	encoder *json.Encoder
+	written map[string]bool // The nodes that have been written
+	err     error           // The first error that occurred while writing
+	lock    sync.Mutex
+}
+
+// NewNDJSONWriter creates a writer that writes the records to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{
+		encoder: json.NewEncoder(w),
+		written: make(map[string]bool),
+	}
+}
+
+func (w *NDJSONWriter) write(record interface{}) {
+	if w.err == nil {
+		w.err = w.encoder.Encode(record)
+	}
+}
+
+func (w *NDJSONWriter) writeNode(dep *Dependency, topLevel bool) {
+	if w.written[dep.RealPath] {
+		return
+	}
+	w.written[dep.RealPath] = true
+
+	w.write(&NDJSONNode{
+		Type:             NDJSONNodeRecord,
+		RealPath:         dep.RealPath,
+		Name:             dep.Name,
+		Path:             dep.Path,
+		TopLevel:         topLevel,
+		Info:             dep.Info,
+		Pruned:           dep.Pruned,
+		PrunedBy:         dep.PrunedBy,
+		NotResolved:      dep.NotResolved,
+		Framework:        dep.Framework,
+		FrameworkVersion: dep.FrameworkVersion,
+		Origin:           dep.Origin,
+		Package:          dep.Package,
+		PackageVersion:   dep.PackageVersion,
+		RPaths:           dep.RPaths,
+		ID:               dep.ID,
+		IDInfo:           dep.IDInfo,
+		UUIDs:            dep.UUIDs,
+		Arches:           dep.Arches,
+	})
+}
+
+// Dependency writes the node of a library whose dependencies have been read,
+// along with its edges. The nodes of the pruned and unresolved dependencies
+// are also written, as they are never read.
+func (w *NDJSONWriter) Dependency(dep *Dependency, topLevel bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.writeNode(dep, topLevel)
+	for _, subDep := range *dep.Deps {
+		// Only the dependencies without their own list of dependencies are never read
+		if subDep.Deps == nil && (subDep.Pruned || subDep.NotResolved) {
+			w.writeNode(subDep, false)
+		}
+		w.write(&NDJSONEdge{
+			Type: NDJSONEdgeRecord,
+			From: dep.RealPath,
+			To:   subDep.RealPath,
+			Path: subDep.Path,
+			Weak: subDep.IsWeakDep,
+		})
+	}
+}
+
+// Diagnostics writes a record for each diagnostic.
+func (w *NDJSONWriter) Diagnostics(diags []Diagnostic) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, diag := range diags {
+		w.write(&NDJSONDiagnostic{Type: NDJSONDiagnosticRecord, Diagnostic: diag})
+	}
+}
+
+// Err returns the first error that occurred while writing, if any.
+func (w *NDJSONWriter) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
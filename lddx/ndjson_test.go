@@ -0,0 +1,97 @@
+package lddx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib", "@rpath/liba.dylib", "@loader_path/libmissing.dylib"},
+		Weak:   []string{"/usr/lib/libweak.dylib"},
+		RPaths: []string{"@loader_path"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{ID: "@rpath/liba.dylib", Dylibs: []string{"@loader_path/libb.dylib"}})
+	writeTestMachO(t, filepath.Join(dir, "libb.dylib"), testMachO{ID: "@rpath/libb.dylib"})
+
+	var out bytes.Buffer
+	writer := NewNDJSONWriter(&out)
+	opts := DependencyOptions{
+		Recursive:    true,
+		Jobs:         4,
+		SkipWeakLibs: true,
+		Logger:       NewColorLogger(io.Discard, true, true),
+		OnRead:       writer.Dependency,
+	}
+	graph, err := DepsRead(opts, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Diagnostics(graph.Diagnostics)
+	if err := writer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := make(map[string]NDJSONNode)
+	var edges []NDJSONEdge
+	diagnostics := 0
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record struct{ Type string }
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid record %s: %s", scanner.Text(), err)
+		}
+
+		switch record.Type {
+		case NDJSONNodeRecord:
+			var node NDJSONNode
+			json.Unmarshal(scanner.Bytes(), &node)
+			if _, ok := nodes[node.RealPath]; ok {
+				t.Errorf("Node %s was written more than once", node.RealPath)
+			}
+			nodes[node.RealPath] = node
+		case NDJSONEdgeRecord:
+			var edge NDJSONEdge
+			json.Unmarshal(scanner.Bytes(), &edge)
+			edges = append(edges, edge)
+		case NDJSONDiagnosticRecord:
+			diagnostics++
+		default:
+			t.Errorf("Unexpected record type %s", record.Type)
+		}
+	}
+
+	// main, liba, libb, libmissing and libweak
+	if len(nodes) != 5 {
+		t.Errorf("Expected 5 nodes but got %d: %v", len(nodes), nodes)
+	}
+	// Two edges to liba, one each to libmissing, libweak and libb
+	if len(edges) != 5 {
+		t.Errorf("Expected 5 edges but got %d: %v", len(edges), edges)
+	}
+	for _, edge := range edges {
+		if _, ok := nodes[edge.From]; !ok {
+			t.Errorf("Edge %+v: No node for %s", edge, edge.From)
+		} else if _, ok := nodes[edge.To]; !ok {
+			t.Errorf("Edge %+v: No node for %s", edge, edge.To)
+		}
+	}
+	if diagnostics != len(graph.Diagnostics) || diagnostics == 0 {
+		t.Errorf("Expected %d diagnostics but got %d", len(graph.Diagnostics), diagnostics)
+	}
+
+	if node := nodes[filepath.Join(dir, "main")]; !node.TopLevel {
+		t.Errorf("Expected main to be a top-level node: %+v", node)
+	}
+	if node := nodes["/usr/lib/libweak.dylib"]; !node.Pruned || node.PrunedBy != "skip-weak" {
+		t.Errorf("Expected libweak to be pruned: %+v", node)
+	}
+	if node := nodes["@loader_path/libmissing.dylib"]; !node.NotResolved {
+		t.Errorf("Expected libmissing to be unresolved: %+v", node)
+	}
+}
@@ -0,0 +1,426 @@
+package lddx
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// OtoolOptions specifies how the load commands are written, as by otool.
+type OtoolOptions struct {
+	LoadCommands bool   // Write every load command, as otool -l, instead of the libraries, as otool -L
+	Arch         string // The architecture to write for fat files, "all", or empty for the host architecture if present
+}
+
+// loadCmdNames are the names of the load commands, as printed by otool -l.
+var loadCmdNames = map[macho.LoadCmd]string{
+	0x1:        "LC_SEGMENT",
+	0x2:        "LC_SYMTAB",
+	0xb:        "LC_DYSYMTAB",
+	0xc:        "LC_LOAD_DYLIB",
+	0xd:        "LC_ID_DYLIB",
+	0xe:        "LC_LOAD_DYLINKER",
+	0xf:        "LC_ID_DYLINKER",
+	0x19:       "LC_SEGMENT_64",
+	0x1b:       "LC_UUID",
+	0x1d:       "LC_CODE_SIGNATURE",
+	0x1e:       "LC_SEGMENT_SPLIT_INFO",
+	0x20:       "LC_LAZY_LOAD_DYLIB",
+	0x21:       "LC_ENCRYPTION_INFO",
+	0x22:       "LC_DYLD_INFO",
+	0x24:       "LC_VERSION_MIN_MACOSX",
+	0x25:       "LC_VERSION_MIN_IPHONEOS",
+	0x26:       "LC_FUNCTION_STARTS",
+	0x27:       "LC_DYLD_ENVIRONMENT",
+	0x29:       "LC_DATA_IN_CODE",
+	0x2a:       "LC_SOURCE_VERSION",
+	0x2b:       "LC_DYLIB_CODE_SIGN_DRS",
+	0x2c:       "LC_ENCRYPTION_INFO_64",
+	0x2e:       "LC_LINKER_OPTIMIZATION_HINT",
+	0x2f:       "LC_VERSION_MIN_TVOS",
+	0x30:       "LC_VERSION_MIN_WATCHOS",
+	0x32:       "LC_BUILD_VERSION",
+	0x80000018: "LC_LOAD_WEAK_DYLIB",
+	0x8000001c: "LC_RPATH",
+	0x8000001f: "LC_REEXPORT_DYLIB",
+	0x80000022: "LC_DYLD_INFO_ONLY",
+	0x80000023: "LC_LOAD_UPWARD_DYLIB",
+	0x80000028: "LC_MAIN",
+	0x80000033: "LC_DYLD_EXPORTS_TRIE",
+	0x80000034: "LC_DYLD_CHAINED_FIXUPS",
+}
+
+// dylibSuffixes are the suffixes of the libraries in otool -L output, by load command.
+var dylibSuffixes = map[macho.LoadCmd]string{
+	0xc:        "",
+	0xd:        "",
+	0x20:       ", lazy",
+	0x80000018: ", weak",
+	0x8000001f: ", reexport",
+	0x80000023: ", upward",
+}
+
+// hostArch returns the name of the architecture that lddx is running on.
+func hostArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i386"
+	}
+	return runtime.GOARCH
+}
+
+// otoolArches returns the architectures of a file to write, and whether to
+// name the architecture in their headers. As otool does, only the host
+// architecture of a fat file is written by default, if it is present.
+func otoolArches(arches []*machOLoadCommands, fat bool, arch string) ([]*machOLoadCommands, bool, error) {
+	if !fat && arch == "" {
+		return arches, false, nil
+	} else if arch == "all" {
+		return arches, fat, nil
+	}
+
+	name := arch
+	if name == "" {
+		name = hostArch()
+	}
+	for _, m := range arches {
+		if m.Arch.String() == name {
+			return []*machOLoadCommands{m}, arch != "", nil
+		}
+	}
+	if arch == "" {
+		return arches, true, nil
+	}
+	return nil, false, fmt.Errorf("does not contain architecture: %s", arch)
+}
+
+// loadCmdReader reads the fields of a load command, which are zero if out of range.
+type loadCmdReader struct {
+	data      []byte
+	byteOrder binary.ByteOrder
+}
+
+func (r *loadCmdReader) u32(offset int) uint32 {
+	if offset+4 > len(r.data) {
+		return 0
+	}
+	return r.byteOrder.Uint32(r.data[offset:])
+}
+
+func (r *loadCmdReader) u64(offset int) uint64 {
+	if offset+8 > len(r.data) {
+		return 0
+	}
+	return r.byteOrder.Uint64(r.data[offset:])
+}
+
+// name16 reads a segment or section name, which is not terminated if it is 16 characters long.
+func (r *loadCmdReader) name16(offset int) string {
+	if offset+16 > len(r.data) {
+		return ""
+	}
+	name := r.data[offset : offset+16]
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+	return string(name)
+}
+
+// str reads the string whose offset in the load command is at the given offset.
+func (r *loadCmdReader) str(offset int) (string, uint32) {
+	strOffset := r.u32(offset)
+	str, err := readCString(r.data, strOffset)
+	if err != nil {
+		return "?(bad offset)", strOffset
+	}
+	return str, strOffset
+}
+
+// otoolVersion formats a version encoded as xxxx.yy.zz, omitting a zero patch version.
+func otoolVersion(version uint32) string {
+	if version == 0 {
+		return "n/a"
+	}
+	return formatOSVersion(version)
+}
+
+// otoolDylibVersion formats the version of a library as x.y.z.
+func otoolDylibVersion(version uint32) string {
+	if version == 0xffffffff {
+		return "n/a"
+	}
+	return fmt.Sprintf("%d.%d.%d", version>>16, (version>>8)&0xff, version&0xff)
+}
+
+// otoolSourceVersion formats a version encoded as a.b.c.d.e, omitting the trailing zeros after b.
+func otoolSourceVersion(version uint64) string {
+	parts := []uint64{version >> 40, (version >> 30) & 0x3ff, (version >> 20) & 0x3ff, (version >> 10) & 0x3ff, version & 0x3ff}
+	for len(parts) > 2 && parts[len(parts)-1] == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	var ret []string
+	for _, part := range parts {
+		ret = append(ret, fmt.Sprint(part))
+	}
+	return strings.Join(ret, ".")
+}
+
+// writeOtoolLibraries writes the libraries of a Mach-O file, as otool -L.
+func writeOtoolLibraries(out *strings.Builder, m *machOLoadCommands) {
+	for _, lc := range m.Commands {
+		suffix, ok := dylibSuffixes[lc.Cmd]
+		if !ok {
+			continue
+		}
+		dylib, err := TryParseLoadCmd(lc.Cmd, lc.Data, m.ByteOrder)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(out, "\t%s (compatibility version %s, current version %s%s)\n", dylib.Path,
+			otoolDylibVersion(dylib.CompatVersion), otoolDylibVersion(dylib.CurrentVersion), suffix)
+	}
+}
+
+// writeOtoolSegment writes a segment load command and its sections, as otool -l.
+func writeOtoolSegment(out *strings.Builder, r *loadCmdReader, is64 bool) {
+	headerSize, sectionSize, addrFormat := 56, 68, "0x%08x"
+	if is64 {
+		headerSize, sectionSize, addrFormat = 72, 80, "0x%016x"
+	}
+	readAddr := func(offset int) (uint64, int) {
+		if is64 {
+			return r.u64(offset), offset + 8
+		}
+		return uint64(r.u32(offset)), offset + 4
+	}
+
+	segname := r.name16(8)
+	vmaddr, offset := readAddr(24)
+	vmsize, offset := readAddr(offset)
+	fileoff, offset := readAddr(offset)
+	filesize, offset := readAddr(offset)
+	maxprot, initprot, nsects, flags := r.u32(offset), r.u32(offset+4), r.u32(offset+8), r.u32(offset+12)
+
+	if int(r.u32(4)) != headerSize+int(nsects)*sectionSize {
+		out.WriteString(" Inconsistent size\n")
+	} else {
+		out.WriteString("\n")
+	}
+	fmt.Fprintf(out, "  segname %s\n", segname)
+	fmt.Fprintf(out, "   vmaddr "+addrFormat+"\n", vmaddr)
+	fmt.Fprintf(out, "   vmsize "+addrFormat+"\n", vmsize)
+	fmt.Fprintf(out, "  fileoff %d\n", fileoff)
+	fmt.Fprintf(out, " filesize %d\n", filesize)
+	fmt.Fprintf(out, "  maxprot 0x%08x\n", maxprot)
+	fmt.Fprintf(out, " initprot 0x%08x\n", initprot)
+	fmt.Fprintf(out, "   nsects %d\n", nsects)
+	fmt.Fprintf(out, "    flags 0x%x\n", flags)
+
+	for i := 0; i < int(nsects); i++ {
+		base := headerSize + i*sectionSize
+		if base+sectionSize > len(r.data) {
+			break
+		}
+		addr, offset := readAddr(base + 32)
+		size, offset := readAddr(offset)
+		sectOffset, align, reloff, nreloc := r.u32(offset), r.u32(offset+4), r.u32(offset+8), r.u32(offset+12)
+		sectFlags, reserved1, reserved2 := r.u32(offset+16), r.u32(offset+20), r.u32(offset+24)
+
+		out.WriteString("Section\n")
+		fmt.Fprintf(out, "  sectname %s\n", r.name16(base))
+		fmt.Fprintf(out, "   segname %s\n", r.name16(base+16))
+		fmt.Fprintf(out, "      addr "+addrFormat+"\n", addr)
+		fmt.Fprintf(out, "      size "+addrFormat+"\n", size)
+		fmt.Fprintf(out, "    offset %d\n", sectOffset)
+		fmt.Fprintf(out, "     align 2^%d (%d)\n", align, 1<<align)
+		fmt.Fprintf(out, "    reloff %d\n", reloff)
+		fmt.Fprintf(out, "    nreloc %d\n", nreloc)
+		fmt.Fprintf(out, "     flags 0x%08x\n", sectFlags)
+
+		// The symbol pointer and stub sections use the reserved fields
+		switch sectFlags & 0xff {
+		case 0x6, 0x7, 0x10:
+			fmt.Fprintf(out, " reserved1 %d (index into indirect symbol table)\n", reserved1)
+			fmt.Fprintf(out, " reserved2 %d\n", reserved2)
+		case 0x8:
+			fmt.Fprintf(out, " reserved1 %d (index into indirect symbol table)\n", reserved1)
+			fmt.Fprintf(out, " reserved2 %d (size of stubs)\n", reserved2)
+		default:
+			fmt.Fprintf(out, " reserved1 %d\n", reserved1)
+			fmt.Fprintf(out, " reserved2 %d\n", reserved2)
+		}
+		if is64 {
+			fmt.Fprintf(out, " reserved3 %d\n", r.u32(offset+28))
+		}
+	}
+}
+
+// writeOtoolFields writes the fields of a load command, right aligned to a common width.
+func writeOtoolFields(out *strings.Builder, fields [][2]string) {
+	width := 0
+	for _, field := range fields {
+		if len(field[0]) > width {
+			width = len(field[0])
+		}
+	}
+	for _, field := range fields {
+		fmt.Fprintf(out, "%*s %s\n", width+1, field[0], field[1])
+	}
+}
+
+// cmdSizeCheck returns the suffix of the cmdsize field of a load command with a fixed size.
+func cmdSizeCheck(r *loadCmdReader, size int) string {
+	if int(r.u32(4)) != size {
+		return " Incorrect size"
+	}
+	return ""
+}
+
+// writeOtoolLoadCommand writes a load command, as otool -l.
+func writeOtoolLoadCommand(out *strings.Builder, m *machOLoadCommands, lc loadCommand) {
+	r := &loadCmdReader{data: lc.Data, byteOrder: m.ByteOrder}
+	name, known := loadCmdNames[lc.Cmd]
+	cmdsize := fmt.Sprint(r.u32(4))
+	u32 := func(offset int) string { return fmt.Sprint(r.u32(offset)) }
+
+	switch lc.Cmd {
+	case 0x1, 0x19:
+		fmt.Fprintf(out, "      cmd %s\n  cmdsize %s", name, cmdsize)
+		writeOtoolSegment(out, r, lc.Cmd == 0x19)
+	case 0x2:
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 24)},
+			{"symoff", u32(8)}, {"nsyms", u32(12)}, {"stroff", u32(16)}, {"strsize", u32(20)}})
+	case 0xb:
+		fields := [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 80)}}
+		for i, field := range []string{"ilocalsym", "nlocalsym", "iextdefsym", "nextdefsym", "iundefsym", "nundefsym",
+			"tocoff", "ntoc", "modtaboff", "nmodtab", "extrefsymoff", "nextrefsyms", "indirectsymoff", "nindirectsyms",
+			"extreloff", "nextrel", "locreloff", "nlocrel"} {
+			fields = append(fields, [2]string{field, u32(8 + 4*i)})
+		}
+		writeOtoolFields(out, fields)
+	case 0xc, 0xd, 0x20, 0x80000018, 0x8000001f, 0x80000023:
+		path, offset := r.str(8)
+		timestamp := r.u32(12)
+		fmt.Fprintf(out, "          cmd %s\n", name)
+		fmt.Fprintf(out, "      cmdsize %s\n", cmdsize)
+		fmt.Fprintf(out, "         name %s (offset %d)\n", path, offset)
+		fmt.Fprintf(out, "   time stamp %d %s\n", timestamp, time.Unix(int64(timestamp), 0).Format("Mon Jan _2 15:04:05 2006"))
+		fmt.Fprintf(out, "      current version %s\n", otoolDylibVersion(r.u32(16)))
+		fmt.Fprintf(out, "compatibility version %s\n", otoolDylibVersion(r.u32(20)))
+	case 0xe, 0xf, 0x27:
+		path, offset := r.str(8)
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize}, {"name", fmt.Sprintf("%s (offset %d)", path, offset)}})
+	case 0x8000001c:
+		path, offset := r.str(8)
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize}, {"path", fmt.Sprintf("%s (offset %d)", path, offset)}})
+	case 0x1b:
+		uuid := "?"
+		if len(lc.Data) >= 24 {
+			uuid = formatUUID(lc.Data[8:24])
+		}
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 24)}, {"uuid", uuid}})
+	case 0x1d, 0x1e, 0x26, 0x29, 0x2b, 0x2e, 0x80000033, 0x80000034:
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 16)},
+			{"dataoff", u32(8)}, {"datasize", u32(12)}})
+	case 0x21, 0x2c:
+		fields := [][2]string{{"cmd", name}, {"cmdsize", cmdsize}, {"cryptoff", u32(8)}, {"cryptsize", u32(12)}, {"cryptid", u32(16)}}
+		if lc.Cmd == 0x2c {
+			fields = append(fields, [2]string{"pad", u32(20)})
+		}
+		writeOtoolFields(out, fields)
+	case 0x22, 0x80000022:
+		fields := [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 48)}}
+		for i, field := range []string{"rebase_off", "rebase_size", "bind_off", "bind_size", "weak_bind_off",
+			"weak_bind_size", "lazy_bind_off", "lazy_bind_size", "export_off", "export_size"} {
+			fields = append(fields, [2]string{field, u32(8 + 4*i)})
+		}
+		writeOtoolFields(out, fields)
+	case 0x24, 0x25, 0x2f, 0x30:
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 16)},
+			{"version", formatOSVersion(r.u32(8))}, {"sdk", otoolVersion(r.u32(12))}})
+	case 0x2a:
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 16)},
+			{"version", otoolSourceVersion(r.u64(8))}})
+	case 0x80000028:
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 24)},
+			{"entryoff", fmt.Sprint(r.u64(8))}, {"stacksize", fmt.Sprint(r.u64(16))}})
+	case 0x32:
+		ntools := r.u32(20)
+		writeOtoolFields(out, [][2]string{{"cmd", name}, {"cmdsize", cmdsize + cmdSizeCheck(r, 24+8*int(ntools))},
+			{"platform", u32(8)}, {"minos", formatOSVersion(r.u32(12))}, {"sdk", otoolVersion(r.u32(16))}, {"ntools", u32(20)}})
+		for i := 0; i < int(ntools) && 24+8*i+8 <= len(lc.Data); i++ {
+			fmt.Fprintf(out, "     tool %d\n", r.u32(24+8*i))
+			fmt.Fprintf(out, "  version %s\n", formatOSVersion(r.u32(28+8*i)))
+		}
+	default:
+		if known {
+			fmt.Fprintf(out, "      cmd %s\n", name)
+		} else {
+			fmt.Fprintf(out, "      cmd ?(0x%08x) Unknown load command\n", uint32(lc.Cmd))
+		}
+		fmt.Fprintf(out, "  cmdsize %s\n", cmdsize)
+	}
+}
+
+// WriteOtool writes the libraries (as otool -L) or load commands (as otool -l)
+// of a Mach-O or Universal (fat) file. The name is printed in the header of
+// each architecture, as otool prints the path given on its command line.
+func WriteOtool(w io.Writer, file, name string, opts OtoolOptions) error {
+	arches, fat, err := readFileLoadCommands(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	arches, namedArch, err := otoolArches(arches, fat, opts.Arch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	var out strings.Builder
+	for _, m := range arches {
+		if namedArch {
+			fmt.Fprintf(&out, "%s (architecture %s):\n", name, m.Arch)
+		} else {
+			fmt.Fprintf(&out, "%s:\n", name)
+		}
+
+		if !opts.LoadCommands {
+			writeOtoolLibraries(&out, m)
+			continue
+		}
+		for i, lc := range m.Commands {
+			fmt.Fprintf(&out, "Load command %d\n", i)
+			writeOtoolLoadCommand(&out, m, lc)
+		}
+	}
+
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// DepsWriteOtool writes the libraries or load commands of each top-level file,
+// as otool -L or otool -l would. If the dependencies were found recursively,
+// those of each resolved library that was not ignored are then written too, sorted by real path.
+func DepsWriteOtool(w io.Writer, graph *DependencyGraph, opts OtoolOptions) error {
+	topLevels := make(map[string]bool)
+	for _, topDep := range graph.TopDeps {
+		topLevels[topDep.RealPath] = true
+		if err := WriteOtool(w, topDep.RealPath, topDep.Path, opts); err != nil {
+			return err
+		}
+	}
+	for _, dep := range graph.SortedFlatDeps() {
+		if !topLevels[dep.RealPath] && !dep.NotResolved && !dep.Pruned {
+			if err := WriteOtool(w, dep.RealPath, dep.RealPath, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
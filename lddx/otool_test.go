@@ -0,0 +1,125 @@
+package lddx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type writeOtoolTest struct {
+	opts     OtoolOptions
+	expected string
+}
+
+func TestWriteOtool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "libfoo.dylib")
+	writeTestMachO(t, path, testMachO{
+		ID:     "@rpath/libfoo.dylib",
+		Dylibs: []string{"/usr/lib/libSystem.B.dylib"},
+		Weak:   []string{"@rpath/libweak.dylib"},
+		RPaths: []string{"@loader_path"},
+		UUID:   [16]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+	})
+	timestamp := time.Unix(2, 0).Format("Mon Jan _2 15:04:05 2006")
+
+	testcases := []writeOtoolTest{
+		{
+			opts: OtoolOptions{},
+			expected: `libfoo.dylib:
+	@rpath/libfoo.dylib (compatibility version 1.0.0, current version 1.2.3)
+	/usr/lib/libSystem.B.dylib (compatibility version 1.0.0, current version 1.2.3)
+	@rpath/libweak.dylib (compatibility version 1.0.0, current version 1.2.3, weak)
+`,
+		},
+		{
+			opts: OtoolOptions{LoadCommands: true},
+			expected: `libfoo.dylib:
+Load command 0
+          cmd LC_ID_DYLIB
+      cmdsize 48
+         name @rpath/libfoo.dylib (offset 24)
+   time stamp 2 ` + timestamp + `
+      current version 1.2.3
+compatibility version 1.0.0
+Load command 1
+          cmd LC_LOAD_DYLIB
+      cmdsize 56
+         name /usr/lib/libSystem.B.dylib (offset 24)
+   time stamp 2 ` + timestamp + `
+      current version 1.2.3
+compatibility version 1.0.0
+Load command 2
+          cmd LC_LOAD_WEAK_DYLIB
+      cmdsize 48
+         name @rpath/libweak.dylib (offset 24)
+   time stamp 2 ` + timestamp + `
+      current version 1.2.3
+compatibility version 1.0.0
+Load command 3
+     cmd LC_RPATH
+ cmdsize 32
+    path @loader_path (offset 12)
+Load command 4
+     cmd LC_UUID
+ cmdsize 24
+    uuid DEADBEEF-0102-0304-0506-0708090A0B0C
+`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		var out strings.Builder
+		if err := WriteOtool(&out, path, "libfoo.dylib", testcase.opts); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != testcase.expected {
+			t.Errorf("Expected otool output (%+v):\n%s\nBut got:\n%s", testcase.opts, testcase.expected, out.String())
+		}
+	}
+}
+
+func TestWriteOtoolSegments(t *testing.T) {
+	var out strings.Builder
+	if err := WriteOtool(&out, "testdata/macho09", "macho09", OtoolOptions{LoadCommands: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Load command 1\n      cmd LC_SEGMENT_64\n  cmdsize 472\n  segname __TEXT\n   vmaddr 0x0000000100000000\n",
+		"Section\n  sectname __symbol_stub1\n   segname __TEXT\n      addr 0x0000000100000f81\n",
+		"     flags 0x80000408\n reserved1 0 (index into indirect symbol table)\n reserved2 6 (size of stubs)\n reserved3 0\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected otool output to contain:\n%s\nBut got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestWriteOtoolArch(t *testing.T) {
+	var out strings.Builder
+	err := WriteOtool(&out, "testdata/macho09", "macho09", OtoolOptions{Arch: "ppc"})
+	if err == nil || !strings.Contains(err.Error(), "does not contain architecture: ppc") {
+		t.Errorf("Expected an error for a missing architecture, but got: %v", err)
+	}
+}
+
+type otoolVersionTest struct {
+	version  uint64
+	expected string
+}
+
+func TestOtoolSourceVersion(t *testing.T) {
+	testcases := []otoolVersionTest{
+		{0, "0.0"},
+		{609 << 40, "609.0"},
+		{609<<40 | 1<<30 | 2<<20, "609.1.2"},
+		{609<<40 | 3<<10 | 4, "609.0.0.3.4"},
+	}
+
+	for _, testcase := range testcases {
+		if actual := otoolSourceVersion(testcase.version); actual != testcase.expected {
+			t.Errorf("Expected source version %s for %x, but got %s", testcase.expected, testcase.version, actual)
+		}
+	}
+}
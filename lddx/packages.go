@@ -0,0 +1,316 @@
+package lddx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Origin is the package manager (or the system) that installed a library.
+type Origin string
+
+// The origins that a library may be classified as.
+const (
+	OriginHomebrew Origin = "homebrew" // Installed into a Homebrew Cellar
+	OriginMacPorts Origin = "macports" // Installed into the MacPorts prefix (/opt/local)
+	OriginNix      Origin = "nix"      // Installed into the Nix store
+	OriginConda    Origin = "conda"    // Installed into a Conda environment
+	OriginSystem   Origin = "system"   // Part of macOS
+)
+
+// systemPrefixes are the paths of the libraries that are part of macOS.
+var systemPrefixes = []string{"/System/", "/usr/lib/", "/Library/Apple/"}
+
+// packageRef identifies the package that installed a library.
+type packageRef struct {
+	Origin  Origin // The package manager that installed the library
+	Name    string // The name of the package, if known
+	Version string // The version of the package, if known
+}
+
+// detectPackage identifies the package that installed the library at the
+// given real path, from the path conventions of Homebrew, Nix and macOS:
+//
+//	<prefix>/Cellar/<name>/<version>/...
+//	/nix/store/<hash>-<name>-<version>/...
+//
+// MacPorts installs every port directly into its prefix (e.g. /opt/local/lib),
+// so only the origin can be identified from the path (the port that installed
+// each file is only recorded in the SQLite database of the MacPorts registry,
+// which is not read, so MacPorts libraries have no package URL), and Conda environments
+// can only be identified from their metadata (see originClassifier).
+func detectPackage(realPath string) (*packageRef, bool) {
+	if i := strings.Index(realPath, "/Cellar/"); i >= 0 {
+		parts := strings.SplitN(realPath[i+len("/Cellar/"):], "/", 3)
+		if len(parts) == 3 && parts[0] != "" && parts[1] != "" {
+			return &packageRef{Origin: OriginHomebrew, Name: parts[0], Version: parts[1]}, true
+		}
+	}
+
+	if strings.HasPrefix(realPath, "/nix/store/") {
+		entry := strings.SplitN(realPath[len("/nix/store/"):], "/", 2)[0]
+		if hashEnd := strings.IndexByte(entry, '-'); hashEnd > 0 {
+			name, version := splitNixName(entry[hashEnd+1:])
+			if name != "" {
+				return &packageRef{Origin: OriginNix, Name: name, Version: version}, true
+			}
+		}
+	}
+
+	for _, prefix := range systemPrefixes {
+		if strings.HasPrefix(realPath, prefix) {
+			return &packageRef{Origin: OriginSystem}, true
+		}
+	}
+
+	return nil, false
+}
+
+// splitNixName splits a Nix store name into the package name and version.
+// As in Nix, the version starts at the first dash followed by a digit.
+func splitNixName(name string) (string, string) {
+	for i := 0; i+1 < len(name); i++ {
+		if name[i] == '-' && name[i+1] >= '0' && name[i+1] <= '9' {
+			return name[:i], name[i+1:]
+		}
+	}
+	return name, ""
+}
+
+// purlEscape percent-encodes every character of a package URL component
+// other than letters, digits and the unreserved characters.
+func purlEscape(s string) string {
+	var ret strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte(".-_~", c) >= 0:
+			ret.WriteByte(c)
+		default:
+			fmt.Fprintf(&ret, "%%%02X", c)
+		}
+	}
+	return ret.String()
+}
+
+// purlTypes maps the origins to their package URL types, if they have one.
+var purlTypes = map[Origin]string{
+	OriginHomebrew: "brew",
+	OriginNix:      "nix",
+	OriginConda:    "conda",
+}
+
+// PURL returns the package URL (purl) of the package, e.g. pkg:brew/openssl%403@3.1.0,
+// or an empty string if the package cannot be identified by one.
+func (p *packageRef) PURL() string {
+	purlType, ok := purlTypes[p.Origin]
+	if !ok || p.Name == "" {
+		return ""
+	}
+
+	ret := "pkg:" + purlType + "/" + purlEscape(p.Name)
+	if p.Version != "" {
+		ret += "@" + purlEscape(p.Version)
+	}
+	return ret
+}
+
+// getPackageRef returns the package that installed the dependency, from its
+// origin if it was classified, or else from the path conventions (e.g. for
+// graphs saved before the origins were classified).
+func getPackageRef(dep *Dependency) (*packageRef, bool) {
+	if dep.Origin != "" {
+		return &packageRef{Origin: dep.Origin, Name: dep.Package, Version: dep.PackageVersion}, true
+	}
+	return detectPackage(dep.RealPath)
+}
+
+// condaPackage is the part of a package record in conda-meta that is needed.
+type condaPackage struct {
+	Name    string
+	Version string
+	Files   []string // The files installed by the package, relative to the environment
+}
+
+// originClassifier classifies the origin of libraries. The metadata of
+// each Conda environment is only read once. It is safe for concurrent use.
+type originClassifier struct {
+	condaEnvs  map[string]string                 // The Conda environment of each folder, or empty if none
+	condaFiles map[string]map[string]*packageRef // The package of each file in each Conda environment
+	lock       sync.Mutex
+}
+
+func newOriginClassifier() *originClassifier {
+	return &originClassifier{
+		condaEnvs:  make(map[string]string),
+		condaFiles: make(map[string]map[string]*packageRef),
+	}
+}
+
+// condaEnv returns the Conda environment that contains the folder, if any.
+// Environments are identified by their conda-meta folder.
+func (c *originClassifier) condaEnv(folder string) string {
+	if env, ok := c.condaEnvs[folder]; ok {
+		return env
+	}
+
+	env := ""
+	if info, err := os.Stat(filepath.Join(folder, "conda-meta")); err == nil && info.IsDir() {
+		env = folder
+	} else if parent := filepath.Dir(folder); parent != folder {
+		env = c.condaEnv(parent)
+	}
+	c.condaEnvs[folder] = env
+	return env
+}
+
+// condaPackages returns the package of each file in the Conda environment,
+// keyed by the path relative to the environment.
+func (c *originClassifier) condaPackages(env string) map[string]*packageRef {
+	if ret, ok := c.condaFiles[env]; ok {
+		return ret
+	}
+
+	ret := make(map[string]*packageRef)
+	records, _ := filepath.Glob(filepath.Join(env, "conda-meta", "*.json"))
+	for _, record := range records {
+		var pkg condaPackage
+		if data, err := ioutil.ReadFile(record); err != nil {
+			continue
+		} else if err := json.Unmarshal(data, &pkg); err != nil || pkg.Name == "" {
+			continue
+		}
+
+		ref := &packageRef{Origin: OriginConda, Name: pkg.Name, Version: pkg.Version}
+		for _, file := range pkg.Files {
+			ret[file] = ref
+		}
+	}
+	c.condaFiles[env] = ret
+	return ret
+}
+
+// classify returns the package that installed the library at the real path.
+func (c *originClassifier) classify(realPath string) (*packageRef, bool) {
+	if ref, ok := detectPackage(realPath); ok {
+		return ref, true
+	} else if !filepath.IsAbs(realPath) {
+		// e.g. an unresolved @rpath dependency
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if env := c.condaEnv(filepath.Dir(realPath)); env != "" {
+		if rel, err := filepath.Rel(env, realPath); err == nil {
+			if ref, ok := c.condaPackages(env)[filepath.ToSlash(rel)]; ok {
+				return ref, true
+			}
+		}
+		return &packageRef{Origin: OriginConda}, true
+	}
+
+	if strings.HasPrefix(realPath, "/opt/local/") {
+		return &packageRef{Origin: OriginMacPorts}, true
+	}
+	return nil, false
+}
+
+// setOriginInfo fills in the origin and package fields of the dependency,
+// if the package manager that installed it can be identified.
+func setOriginInfo(dep *Dependency, origins *originClassifier) {
+	if ref, ok := origins.classify(dep.RealPath); ok {
+		dep.Origin = ref.Origin
+		dep.Package = ref.Name
+		dep.PackageVersion = ref.Version
+	}
+}
+
+// copyOriginInfo copies the origin and package fields from another reference to the same library.
+func copyOriginInfo(dep, from *Dependency) {
+	dep.Origin = from.Origin
+	dep.Package = from.Package
+	dep.PackageVersion = from.PackageVersion
+}
+
+// packageGroup contains the libraries that were installed by a package.
+type packageGroup struct {
+	Title string        // The origin, package name and version (e.g. homebrew openssl@3 3.1.0)
+	Deps  []*Dependency // The libraries, sorted by name and real path
+}
+
+// groupByPackage returns the libraries that the dependency depends on,
+// directly or indirectly, grouped by the package that installed them.
+// Each library is listed once, even if it is referenced by several paths.
+// The groups are sorted by title, with the unknown and unresolved libraries last.
+func groupByPackage(dep *Dependency) []*packageGroup {
+	groups := make(map[string]*packageGroup)
+	seen := make(map[string]bool)
+
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		if dep.Deps == nil {
+			return
+		}
+
+		for _, subDep := range *dep.Deps {
+			if seen[subDep.RealPath] {
+				continue
+			}
+			seen[subDep.RealPath] = true
+
+			// Libraries that could not be found can still be classified by their path (e.g. /usr/lib)
+			title := "(unknown)"
+			if subDep.Origin != "" {
+				title = strings.TrimSpace(fmt.Sprintf("%s %s %s", subDep.Origin, subDep.Package, subDep.PackageVersion))
+			} else if subDep.NotResolved {
+				title = "(unresolved)"
+			}
+			if groups[title] == nil {
+				groups[title] = &packageGroup{Title: title}
+			}
+			groups[title].Deps = append(groups[title].Deps, subDep)
+			walk(subDep)
+		}
+	}
+	walk(dep)
+
+	ret := make([]*packageGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group.Deps, func(i, j int) bool {
+			if group.Deps[i].Name != group.Deps[j].Name {
+				return group.Deps[i].Name < group.Deps[j].Name
+			}
+			return group.Deps[i].RealPath < group.Deps[j].RealPath
+		})
+		ret = append(ret, group)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		// The parenthesised titles sort after the known origins
+		if iUnknown, jUnknown := strings.HasPrefix(ret[i].Title, "("), strings.HasPrefix(ret[j].Title, "("); iUnknown != jUnknown {
+			return jUnknown
+		}
+		return ret[i].Title < ret[j].Title
+	})
+	return ret
+}
+
+// DepsPrettyPrintByPackage prints the libraries that a dependency depends on,
+// grouped by the package manager and package that installed them.
+func DepsPrettyPrintByPackage(dep *Dependency) {
+	for _, group := range groupByPackage(dep) {
+		fmt.Printf("    %s:\n", group.Title)
+		for _, subDep := range group.Deps {
+			if subDep.Path != subDep.RealPath {
+				fmt.Printf("      %s => %s (%s)\n", subDep.Name, subDep.Path, subDep.RealPath)
+			} else {
+				fmt.Printf("      %s => %s\n", subDep.Name, subDep.Path)
+			}
+		}
+	}
+}
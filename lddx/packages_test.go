@@ -0,0 +1,150 @@
+package lddx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type detectPackageTest struct {
+	realPath string
+	origin   Origin
+	purl     string
+}
+
+func TestDetectPackage(t *testing.T) {
+	testcases := []detectPackageTest{
+		{"/opt/homebrew/Cellar/openssl@3/3.1.0/lib/libssl.3.dylib", OriginHomebrew, "pkg:brew/openssl%403@3.1.0"},
+		{"/usr/local/Cellar/icu4c/73.2/lib/libicuuc.73.dylib", OriginHomebrew, "pkg:brew/icu4c@73.2"},
+		{"/usr/local/Cellar/libpng/1.6.40_1/lib/libpng16.16.dylib", OriginHomebrew, "pkg:brew/libpng@1.6.40_1"},
+		{"/nix/store/0c2kxkzwr3b0pf7fmb1aqrjjnyx6m2xv-zlib-1.3/lib/libz.dylib", OriginNix, "pkg:nix/zlib@1.3"},
+		{"/nix/store/0c2kxkzwr3b0pf7fmb1aqrjjnyx6m2xv-gtk+3-3.24.38/lib/libgtk-3.0.dylib", OriginNix, "pkg:nix/gtk%2B3@3.24.38"},
+		{"/nix/store/0c2kxkzwr3b0pf7fmb1aqrjjnyx6m2xv-libiconv/lib/libiconv.dylib", OriginNix, "pkg:nix/libiconv"},
+		{"/usr/lib/libSystem.B.dylib", OriginSystem, ""},
+		{"/System/Library/Frameworks/Cocoa.framework/Versions/A/Cocoa", OriginSystem, ""},
+		{"/usr/local/Cellar/icu4c", "", ""},
+		{"/usr/local/lib/libz.dylib", "", ""},
+		{"/nix/store/libz.dylib", "", ""},
+	}
+
+	for _, test := range testcases {
+		pkg, ok := detectPackage(test.realPath)
+		if ok != (test.origin != "") {
+			t.Errorf("%s: Expected detected to be %v, got %v", test.realPath, test.origin != "", ok)
+		} else if ok && (pkg.Origin != test.origin || pkg.PURL() != test.purl) {
+			t.Errorf("%s: Expected %s %s, got %s %s", test.realPath, test.origin, test.purl, pkg.Origin, pkg.PURL())
+		}
+	}
+}
+
+func TestOriginClassifier(t *testing.T) {
+	env := filepath.Join(t.TempDir(), "envs", "py")
+	for _, folder := range []string{"conda-meta", "lib"} {
+		if err := os.MkdirAll(filepath.Join(env, folder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record := `{"name": "libffi", "version": "3.4.4", "build": "h0", "files": ["lib/libffi.8.dylib", "include/ffi.h"]}`
+	if err := os.WriteFile(filepath.Join(env, "conda-meta", "libffi-3.4.4-h0.json"), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]*packageRef{
+		filepath.Join(env, "lib", "libffi.8.dylib"):       {Origin: OriginConda, Name: "libffi", Version: "3.4.4"},
+		filepath.Join(env, "lib", "libunknown.dylib"):     {Origin: OriginConda},
+		"/opt/local/lib/libz.1.dylib":                     {Origin: OriginMacPorts},
+		"/usr/lib/libc++.1.dylib":                         {Origin: OriginSystem},
+		"/opt/homebrew/Cellar/xz/5.4.4/lib/liblzma.dylib": {Origin: OriginHomebrew, Name: "xz", Version: "5.4.4"},
+		filepath.Join(env, "..", "libother.dylib"):        nil,
+	}
+
+	origins := newOriginClassifier()
+	for realPath, expected := range testcases {
+		ref, ok := origins.classify(realPath)
+		if ok != (expected != nil) {
+			t.Errorf("%s: Expected classified to be %v, got %v", realPath, expected != nil, ok)
+		} else if ok && !reflect.DeepEqual(ref, expected) {
+			t.Errorf("%s: Expected %+v, got %+v", realPath, expected, ref)
+		}
+	}
+	if purl := (&packageRef{Origin: OriginConda, Name: "libffi", Version: "3.4.4"}).PURL(); purl != "pkg:conda/libffi@3.4.4" {
+		t.Errorf("Unexpected conda purl %s", purl)
+	}
+}
+
+func TestGroupByPackage(t *testing.T) {
+	libcrypto := &Dependency{Name: "libcrypto.3.dylib", Path: "/opt/homebrew/opt/openssl@3/lib/libcrypto.3.dylib",
+		RealPath: "/opt/homebrew/Cellar/openssl@3/3.1.0/lib/libcrypto.3.dylib", Origin: OriginHomebrew, Package: "openssl@3", PackageVersion: "3.1.0", Deps: &[]*Dependency{}}
+	libssl := &Dependency{Name: "libssl.3.dylib", Path: "/opt/homebrew/opt/openssl@3/lib/libssl.3.dylib",
+		RealPath: "/opt/homebrew/Cellar/openssl@3/3.1.0/lib/libssl.3.dylib", Origin: OriginHomebrew, Package: "openssl@3", PackageVersion: "3.1.0", Deps: &[]*Dependency{libcrypto}}
+	graph := newTestGraph(
+		&Dependency{Name: "main", Path: "main", RealPath: "/app/main"},
+		libssl,
+		libcrypto,
+		&Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/app/liba.dylib", Deps: &[]*Dependency{}},
+		&Dependency{Name: "libmissing.dylib", Path: "@rpath/libmissing.dylib", RealPath: "@rpath/libmissing.dylib", NotResolved: true},
+		&Dependency{Name: "libz.1.dylib", Path: "/opt/local/lib/libz.1.dylib", RealPath: "/opt/local/lib/libz.1.dylib", Origin: OriginMacPorts, Deps: &[]*Dependency{}},
+		&Dependency{Name: "libSystem.B.dylib", Path: "/usr/lib/libSystem.B.dylib", RealPath: "/usr/lib/libSystem.B.dylib", Origin: OriginSystem, Pruned: true},
+	)
+
+	var titles []string
+	var names [][]string
+	for _, group := range groupByPackage(graph.TopDeps[0]) {
+		titles = append(titles, group.Title)
+		var groupNames []string
+		for _, dep := range group.Deps {
+			groupNames = append(groupNames, dep.Name)
+		}
+		names = append(names, groupNames)
+	}
+
+	expectedTitles := []string{"homebrew openssl@3 3.1.0", "macports", "system", "(unknown)", "(unresolved)"}
+	expectedNames := [][]string{{"libcrypto.3.dylib", "libssl.3.dylib"}, {"libz.1.dylib"}, {"libSystem.B.dylib"}, {"liba.dylib"}, {"libmissing.dylib"}}
+	if !reflect.DeepEqual(titles, expectedTitles) {
+		t.Errorf("Expected groups %v, got %v", expectedTitles, titles)
+	}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected libraries %v, got %v", expectedNames, names)
+	}
+}
+
+func TestDepsReadOrigin(t *testing.T) {
+	env := t.TempDir()
+	// libffi is referenced by two install names, and libz is ignored
+	writeTestMachO(t, filepath.Join(env, "bin", "python"), testMachO{
+		Dylibs: []string{"@loader_path/../lib/libffi.8.dylib", "@rpath/libffi.8.dylib", "@rpath/libz.1.dylib"},
+		RPaths: []string{"@loader_path/../lib"},
+	})
+	writeTestMachO(t, filepath.Join(env, "lib", "libz.1.dylib"), testMachO{ID: "@rpath/libz.1.dylib"})
+	writeTestMachO(t, filepath.Join(env, "lib", "libffi.8.dylib"), testMachO{ID: "@rpath/libffi.8.dylib"})
+	record := `{"name": "libffi", "version": "3.4.4", "files": ["lib/libffi.8.dylib"]}`
+	if err := os.MkdirAll(filepath.Join(env, "conda-meta"), 0755); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(env, "conda-meta", "libffi-3.4.4-h0.json"), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DependencyOptions{Recursive: true, IgnoredPrefixes: []string{filepath.Join(env, "lib", "libz")}}
+	graph, err := DepsRead(opts, filepath.Join(env, "bin", "python"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if topDep := graph.TopDeps[0]; topDep.Origin != OriginConda || topDep.Package != "" {
+		t.Errorf("Expected python to be from an unknown conda package, got %s %s", topDep.Origin, topDep.Package)
+	}
+	// Every reference shares the origin of the library
+	deps := *graph.TopDeps[0].Deps
+	if len(deps) != 3 {
+		t.Fatalf("Expected 3 dependencies, got %v", deps)
+	}
+	for _, dep := range deps[:2] {
+		if dep.Origin != OriginConda || dep.Package != "libffi" || dep.PackageVersion != "3.4.4" {
+			t.Errorf("Expected %s to be from conda libffi 3.4.4, got %s %s %s", dep.Path, dep.Origin, dep.Package, dep.PackageVersion)
+		}
+	}
+	if dep := deps[2]; !dep.Pruned || dep.Origin != OriginConda || dep.Package != "" {
+		t.Errorf("Expected the ignored %s to be from an unknown conda package, got %s %s", dep.Path, dep.Origin, dep.Package)
+	}
+}
@@ -0,0 +1,695 @@
+package lddx
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// QueryFieldKind is the type of the values of a query field.
+type QueryFieldKind int
+
+// The types of the query fields.
+const (
+	QueryBool    QueryFieldKind = iota // true or false
+	QueryInt                           // An integer, compared numerically
+	QueryString                        // A string, compared exactly or matched by regular expression
+	QueryVersion                       // A dotted version (e.g. 1.2.3), compared component by component
+	QueryList                          // A list of strings, which matches if any string matches
+)
+
+// QueryField is a field of a library that can be filtered on and printed.
+type QueryField struct {
+	Name        string         // The name used in expressions and field lists
+	Kind        QueryFieldKind // The type of the values of the field
+	Description string         // A description of the field for people
+	value       func(row *QueryRow) interface{}
+}
+
+// QueryFields are the fields that can be queried, in the order they are listed.
+var QueryFields = []*QueryField{
+	{"name", QueryString, "The name of the library", func(r *QueryRow) interface{} { return r.Node.Name }},
+	{"path", QueryString, "The real path to the library, or its install name if it could not be resolved", func(r *QueryRow) interface{} { return r.Node.RealPath }},
+	{"loadPaths", QueryList, "The paths by which the library is loaded, as specified by the load commands", func(r *QueryRow) interface{} { return r.LoadPaths }},
+	{"installName", QueryString, "The install name of the library itself (LC_ID_DYLIB)", func(r *QueryRow) interface{} { return r.Node.InstallName }},
+	{"version", QueryVersion, "The current version of the library", func(r *QueryRow) interface{} { return r.versions().Current }},
+	{"compatVersion", QueryVersion, "The compatibility version of the library", func(r *QueryRow) interface{} { return r.versions().Compatibility }},
+	{"depth", QueryInt, "The fewest load commands between a top-level file and the library (0 for the top-level files)", func(r *QueryRow) interface{} { return r.Depth }},
+	{"parents", QueryInt, "The number of libraries that load the library", func(r *QueryRow) interface{} { return r.Parents }},
+	{"deps", QueryInt, "The number of libraries that the library loads", func(r *QueryRow) interface{} { return r.Deps }},
+	{"topLevel", QueryBool, "Whether the library is one of the files that was processed", func(r *QueryRow) interface{} { return r.Node.TopLevel }},
+	{"weak", QueryBool, "Whether the library is only loaded by weak load commands", func(r *QueryRow) interface{} { return r.Weak }},
+	{"unresolved", QueryBool, "Whether the library could not be found or read", func(r *QueryRow) interface{} { return r.Node.Unresolved }},
+	{"ignored", QueryBool, "Whether the dependencies of the library were not read, as it was ignored", func(r *QueryRow) interface{} { return r.Ignored }},
+	{"ignoredBy", QueryString, "The option or ignore rule that caused the library to be ignored", func(r *QueryRow) interface{} { return r.IgnoredBy }},
+	{"origin", QueryString, "The package manager (or system) that installed the library", func(r *QueryRow) interface{} { return string(r.pkg().Origin) }},
+	{"package", QueryString, "The name of the package that installed the library", func(r *QueryRow) interface{} { return r.pkg().Name }},
+	{"packageVersion", QueryString, "The version of the package that installed the library", func(r *QueryRow) interface{} { return r.pkg().Version }},
+	{"framework", QueryString, "The name of the framework bundle, if the library is a framework binary", func(r *QueryRow) interface{} { return r.framework().Name }},
+	{"arches", QueryList, "The architectures of the file", func(r *QueryRow) interface{} { return r.Node.Arches }},
+	{"uuids", QueryList, "The Mach-O UUIDs of the file", func(r *QueryRow) interface{} { return r.Node.UUIDs }},
+	{"rpaths", QueryList, "The rpaths of the file", func(r *QueryRow) interface{} { return r.Node.RPaths }},
+}
+
+// getQueryField returns the query field with the given name.
+func getQueryField(name string) (*QueryField, error) {
+	for _, field := range QueryFields {
+		if field.Name == name {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown field: %s", name)
+}
+
+// QueryRow is a library that can be queried, along with what is known about it from its edges.
+type QueryRow struct {
+	Node      *GraphNode
+	LoadPaths []string // The paths by which the library is loaded, sorted
+	Depth     int      // The fewest load commands from a top-level file, or -1 if unreachable
+	Parents   int      // The number of libraries that load the library
+	Deps      int      // The number of libraries that the library loads
+	Weak      bool     // Indicates if the library is only loaded by weak load commands
+	Ignored   bool     // Indicates if the library is only loaded by ignored load commands
+	IgnoredBy string   // The option or ignore rule that caused the library to be ignored, if any
+	version   *GraphVersions
+}
+
+func (r *QueryRow) versions() *GraphVersions {
+	if r.Node.Version != nil {
+		return r.Node.Version
+	} else if r.version != nil {
+		return r.version
+	}
+	return &GraphVersions{}
+}
+
+func (r *QueryRow) pkg() *GraphPackage {
+	if r.Node.Package != nil {
+		return r.Node.Package
+	}
+	return &GraphPackage{}
+}
+
+func (r *QueryRow) framework() *GraphFramework {
+	if r.Node.Framework != nil {
+		return r.Node.Framework
+	}
+	return &GraphFramework{}
+}
+
+// Value returns the value of the field for the library.
+func (r *QueryRow) Value(field *QueryField) interface{} {
+	return field.value(r)
+}
+
+// NewQueryRows returns a row for each node of the document, in the same order.
+func NewQueryRows(doc *GraphDocument) []*QueryRow {
+	rows := make([]*QueryRow, len(doc.Nodes))
+	children := make([][]int, len(doc.Nodes))
+	incoming := make([]int, len(doc.Nodes))
+	weak := make([]int, len(doc.Nodes))
+	ignored := make([]int, len(doc.Nodes))
+	loadPaths := make([]map[string]bool, len(doc.Nodes))
+
+	for i, node := range doc.Nodes {
+		rows[i] = &QueryRow{Node: node, Depth: -1}
+		loadPaths[i] = make(map[string]bool)
+	}
+	for _, edge := range doc.Edges {
+		row := rows[edge.To]
+		children[edge.From] = append(children[edge.From], edge.To)
+		rows[edge.From].Deps++
+		row.Parents++
+		incoming[edge.To]++
+		loadPaths[edge.To][edge.InstallName] = true
+		if edge.Weak {
+			weak[edge.To]++
+		}
+		if edge.Ignored {
+			ignored[edge.To]++
+			if row.IgnoredBy == "" {
+				row.IgnoredBy = edge.IgnoredBy
+			}
+		}
+		if row.version == nil {
+			row.version = edge.Version
+		}
+	}
+
+	for i, row := range rows {
+		for path := range loadPaths[i] {
+			row.LoadPaths = append(row.LoadPaths, path)
+		}
+		sort.Strings(row.LoadPaths)
+		row.Weak = incoming[i] > 0 && weak[i] == incoming[i] && !row.Node.TopLevel
+		row.Ignored = incoming[i] > 0 && ignored[i] == incoming[i] && !row.Node.TopLevel
+		if !row.Ignored {
+			row.IgnoredBy = ""
+		}
+	}
+
+	// The depths are found breadth first from the top-level files
+	var queue []int
+	for _, id := range doc.Roots {
+		if rows[id].Depth < 0 {
+			rows[id].Depth = 0
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			if rows[child].Depth < 0 {
+				rows[child].Depth = rows[id].Depth + 1
+				queue = append(queue, child)
+			}
+		}
+	}
+	return rows
+}
+
+// compareVersions compares two dotted versions component by component,
+// where missing components are zero.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bPart, _ = strconv.Atoi(bParts[i])
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Query is a parsed filter expression, which matches libraries.
+type Query struct {
+	expr queryExpr
+	text string
+}
+
+// queryExpr is a node of a parsed filter expression.
+type queryExpr interface {
+	match(row *QueryRow) bool
+}
+
+type queryAnd struct{ left, right queryExpr }
+type queryOr struct{ left, right queryExpr }
+type queryNot struct{ expr queryExpr }
+
+// queryTerm compares a field with a value, or tests if it is set if there is no operator.
+type queryTerm struct {
+	field *QueryField
+	op    string
+	value string
+	num   int
+	re    *regexp.Regexp
+}
+
+func (e *queryAnd) match(row *QueryRow) bool { return e.left.match(row) && e.right.match(row) }
+func (e *queryOr) match(row *QueryRow) bool  { return e.left.match(row) || e.right.match(row) }
+func (e *queryNot) match(row *QueryRow) bool { return !e.expr.match(row) }
+
+// compareOp returns whether the comparison of a value with the term's value
+// (as -1, 0 or 1) satisfies the operator.
+func compareOp(op string, cmp int) bool {
+	switch op {
+	case "=", "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// matchString returns whether a string value satisfies the operator.
+func (e *queryTerm) matchString(op, value string) bool {
+	switch op {
+	case "~":
+		return e.re.MatchString(value)
+	case "!~":
+		return !e.re.MatchString(value)
+	}
+	if e.field.Kind == QueryVersion {
+		return value != "" && compareOp(op, compareVersions(value, e.value))
+	}
+	return compareOp(op, strings.Compare(value, e.value))
+}
+
+func (e *queryTerm) match(row *QueryRow) bool {
+	value := row.Value(e.field)
+	if e.op == "" {
+		switch v := value.(type) {
+		case bool:
+			return v
+		case int:
+			return v != 0
+		case string:
+			return v != ""
+		case []string:
+			return len(v) > 0
+		}
+		return false
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return compareOp(e.op, strings.Compare(strconv.FormatBool(v), e.value))
+	case int:
+		switch {
+		case v < e.num:
+			return compareOp(e.op, -1)
+		case v > e.num:
+			return compareOp(e.op, 1)
+		}
+		return compareOp(e.op, 0)
+	case string:
+		return e.matchString(e.op, v)
+	case []string:
+		// The negated operators match if none of the strings match the operator that they negate
+		op, negated := e.op, false
+		switch e.op {
+		case "!=":
+			op, negated = "=", true
+		case "!~":
+			op, negated = "~", true
+		}
+		for _, s := range v {
+			if e.matchString(op, s) {
+				return !negated
+			}
+		}
+		return negated
+	}
+	return false
+}
+
+// queryParser parses filter expressions with the grammar:
+//
+//	expr   = and { ("or" | "||") and }
+//	and    = unary { ("and" | "&&") unary }
+//	unary  = ("not" | "!") unary | "(" expr ")" | term
+//	term   = field [ op value ]
+//	op     = "=" | "==" | "!=" | "~" | "!~" | "<" | "<=" | ">" | ">="
+//
+// Values may be quoted with double quotes, and otherwise end at a space or ")".
+type queryParser struct {
+	s   string
+	pos int
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// keyword consumes one of the keywords or symbols, if it is next.
+func (p *queryParser) keyword(keywords ...string) bool {
+	p.skipSpace()
+	for _, keyword := range keywords {
+		if !strings.HasPrefix(p.s[p.pos:], keyword) {
+			continue
+		}
+		// A word must not be followed by a letter, e.g. the field "notes"
+		end := p.pos + len(keyword)
+		if unicode.IsLetter(rune(keyword[0])) && end < len(p.s) && isQueryIdentChar(p.s[end]) {
+			continue
+		}
+		p.pos = end
+		return true
+	}
+	return false
+}
+
+func isQueryIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d of %q", fmt.Sprintf(format, args...), p.pos+1, p.s)
+}
+
+func (p *queryParser) parseExpr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.keyword("or", "||") {
+		var right queryExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = &queryOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.keyword("and", "&&") {
+		var right queryExpr
+		if right, err = p.parseUnary(); err == nil {
+			left = &queryAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseUnary() (queryExpr, error) {
+	if p.keyword("not", "!") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{expr}, nil
+	} else if p.keyword("(") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		} else if !p.keyword(")") {
+			return nil, p.errorf("expected )")
+		}
+		return expr, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *queryParser) parseValue() (string, error) {
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.s); p.pos++ {
+			switch c := p.s[p.pos]; {
+			case c == '"':
+				p.pos++
+				return value.String(), nil
+			case c == '\\' && p.pos+1 < len(p.s):
+				p.pos++
+				value.WriteByte(p.s[p.pos])
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", p.errorf("unterminated string")
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && !unicode.IsSpace(rune(p.s[p.pos])) && p.s[p.pos] != ')' {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a value")
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *queryParser) parseTerm() (queryExpr, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && isQueryIdentChar(p.s[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("expected a field")
+	}
+	field, err := getQueryField(p.s[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("%s", err)
+	}
+
+	term := &queryTerm{field: field}
+	for _, op := range []string{"==", "!=", "!~", "<=", ">=", "=", "~", "<", ">"} {
+		if p.keyword(op) {
+			term.op = op
+			break
+		}
+	}
+	if term.op == "" {
+		return term, nil
+	} else if term.value, err = p.parseValue(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case term.op == "~" || term.op == "!~":
+		if field.Kind == QueryBool || field.Kind == QueryInt {
+			return nil, p.errorf("%s cannot be matched by a regular expression", field.Name)
+		} else if term.re, err = regexp.Compile(term.value); err != nil {
+			return nil, p.errorf("invalid regular expression: %s", err)
+		}
+	case field.Kind == QueryBool:
+		if term.value != "true" && term.value != "false" {
+			return nil, p.errorf("%s must be compared with true or false", field.Name)
+		} else if term.op != "=" && term.op != "==" && term.op != "!=" {
+			return nil, p.errorf("%s can only be compared for equality", field.Name)
+		}
+	case field.Kind == QueryInt:
+		if term.num, err = strconv.Atoi(term.value); err != nil {
+			return nil, p.errorf("%s must be compared with an integer", field.Name)
+		}
+	case field.Kind == QueryString || field.Kind == QueryList:
+		if term.op != "=" && term.op != "==" && term.op != "!=" {
+			return nil, p.errorf("%s can only be compared for equality or matched by a regular expression", field.Name)
+		}
+	}
+	return term, nil
+}
+
+// ParseQuery parses a filter expression, such as "unresolved", "weak and depth<3"
+// or "path~^/opt/homebrew". Each term is either a field, which matches if the
+// field is set (true, non-zero or non-empty), or compares a field with a value.
+// The ~ and !~ operators match regular expressions, and the list fields match
+// if any of their strings match. Terms are combined with and, or, not and
+// parentheses.
+func ParseQuery(expr string) (*Query, error) {
+	p := &queryParser{s: expr}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	} else if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return &Query{expr: e, text: expr}, nil
+}
+
+// Match returns whether the library matches the query.
+func (q *Query) Match(row *QueryRow) bool {
+	return q == nil || q.expr.match(row)
+}
+
+// String returns the expression that the query was parsed from.
+func (q *Query) String() string {
+	return q.text
+}
+
+// FilterQueryRows returns the rows that match the query, or every row if the query is nil.
+func FilterQueryRows(rows []*QueryRow, query *Query) []*QueryRow {
+	var ret []*QueryRow
+	for _, row := range rows {
+		if query.Match(row) {
+			ret = append(ret, row)
+		}
+	}
+	return ret
+}
+
+// ParseQueryFields parses a comma separated list of field names.
+func ParseQueryFields(names string) ([]*QueryField, error) {
+	var ret []*QueryField
+	for _, name := range strings.Split(names, ",") {
+		field, err := getQueryField(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, field)
+	}
+	return ret, nil
+}
+
+// formatQueryValue formats the value of a field for a table.
+func formatQueryValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		if len(v) == 0 {
+			return "-"
+		}
+		return strings.Join(v, ",")
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// WriteQueryTable writes the fields of the libraries as a table, with a header.
+func WriteQueryTable(w io.Writer, rows []*QueryRow, fields []*QueryField) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for i, field := range fields {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, strings.ToUpper(field.Name))
+	}
+	fmt.Fprintln(tw)
+
+	for _, row := range rows {
+		for i, field := range fields {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, formatQueryValue(row.Value(field)))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// QueryCount is the number of libraries with a value of a field.
+type QueryCount struct {
+	Value string
+	Count int
+}
+
+// AggregateQueryRows counts the libraries by the value of a field, most common first.
+// The libraries with a list field are counted once for each of its strings.
+func AggregateQueryRows(rows []*QueryRow, field *QueryField) []QueryCount {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		switch v := row.Value(field).(type) {
+		case []string:
+			if len(v) == 0 {
+				counts["-"]++
+			}
+			for _, s := range v {
+				counts[s]++
+			}
+		default:
+			counts[formatQueryValue(v)]++
+		}
+	}
+
+	ret := make([]QueryCount, 0, len(counts))
+	for value, count := range counts {
+		ret = append(ret, QueryCount{Value: value, Count: count})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Value < ret[j].Value
+	})
+	return ret
+}
+
+// FilterGraphDocument returns the subgraph of the libraries that match the
+// query, with the load commands between them. The nodes are renumbered, and
+// the diagnostics are kept if they concern one of the libraries. The libraries
+// that are not reachable from a selected top-level file are also roots.
+func FilterGraphDocument(doc *GraphDocument, rows []*QueryRow, query *Query) *GraphDocument {
+	ret := &GraphDocument{
+		SchemaVersion: doc.SchemaVersion,
+		Generator:     doc.Generator,
+		Roots:         []int{},
+		Nodes:         []*GraphNode{},
+		Edges:         []*GraphEdge{},
+		Diagnostics:   []*GraphDiagnostic{},
+	}
+
+	ids := make(map[int]int)
+	paths := make(map[string]bool)
+	for _, row := range rows {
+		if !query.Match(row) {
+			continue
+		}
+		node := *row.Node
+		node.ID = len(ret.Nodes)
+		ids[row.Node.ID] = node.ID
+		ret.Nodes = append(ret.Nodes, &node)
+		paths[node.RealPath] = true
+		if node.Path != "" {
+			paths[node.Path] = true
+		}
+		for _, path := range row.LoadPaths {
+			paths[path] = true
+		}
+	}
+
+	children := make([][]int, len(ret.Nodes))
+	for _, edge := range doc.Edges {
+		from, fromOK := ids[edge.From]
+		to, toOK := ids[edge.To]
+		if fromOK && toOK {
+			newEdge := *edge
+			newEdge.From, newEdge.To = from, to
+			ret.Edges = append(ret.Edges, &newEdge)
+			children[from] = append(children[from], to)
+		}
+	}
+
+	// The libraries that can no longer be reached from a top-level file become
+	// roots, so that the whole subgraph is kept when it is read back.
+	reached := make([]bool, len(ret.Nodes))
+	addRoot := func(id int) {
+		if reached[id] {
+			return
+		}
+		ret.Roots = append(ret.Roots, id)
+		reached[id] = true
+		queue := []int{id}
+		for len(queue) > 0 {
+			for _, child := range children[queue[0]] {
+				if !reached[child] {
+					reached[child] = true
+					queue = append(queue, child)
+				}
+			}
+			queue = queue[1:]
+		}
+	}
+	for _, id := range doc.Roots {
+		if newID, ok := ids[id]; ok {
+			addRoot(newID)
+		}
+	}
+	parents := make([]int, len(ret.Nodes))
+	for _, edge := range ret.Edges {
+		parents[edge.To]++
+	}
+	for id := range ret.Nodes {
+		if parents[id] == 0 {
+			addRoot(id)
+		}
+	}
+	for id := range ret.Nodes {
+		// Only cycles remain
+		addRoot(id)
+	}
+	for _, diag := range doc.Diagnostics {
+		if paths[diag.Dependency] || diag.Dependency == "" && paths[diag.File] {
+			ret.Diagnostics = append(ret.Diagnostics, diag)
+		}
+	}
+	return ret
+}
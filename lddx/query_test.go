@@ -0,0 +1,221 @@
+package lddx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newTestQueryDocument() *GraphDocument {
+	libz := &Dependency{Name: "libz.1.dylib", Path: "@rpath/libz.1.dylib", RealPath: "/opt/homebrew/Cellar/zlib/1.3/lib/libz.1.dylib",
+		Info: "compatibility version 1.0.0, current version 1.3.0", Origin: OriginHomebrew, Package: "zlib", PackageVersion: "1.3",
+		Arches: []string{"arm64", "x86_64"}, Deps: &[]*Dependency{}}
+	libpng := &Dependency{Name: "libpng16.16.dylib", Path: "@rpath/libpng16.16.dylib", RealPath: "/opt/homebrew/Cellar/libpng/1.6.40/lib/libpng16.16.dylib",
+		Info: "compatibility version 57.0.0, current version 57.0.0", Origin: OriginHomebrew, Package: "libpng", PackageVersion: "1.6.40",
+		Arches: []string{"arm64"}, Deps: &[]*Dependency{libz}}
+	graph := newTestGraph(
+		&Dependency{Name: "main", Path: "main", RealPath: "/app/main"},
+		libpng,
+		&Dependency{Name: "libweak.dylib", Path: "/opt/lib/libweak.dylib", RealPath: "/opt/lib/libweak.dylib", IsWeakDep: true,
+			Info: "compatibility version 1.0.0, current version 2.10.0", Deps: &[]*Dependency{}},
+		&Dependency{Name: "libSystem.B.dylib", Path: "/usr/lib/libSystem.B.dylib", RealPath: "/usr/lib/libSystem.B.dylib",
+			Pruned: true, PrunedBy: "ignore-prefix:/usr/lib", Origin: OriginSystem},
+		&Dependency{Name: "libmissing.dylib", Path: "@rpath/libmissing.dylib", RealPath: "@rpath/libmissing.dylib", NotResolved: true},
+	)
+	graph.FlatDeps[libz.RealPath] = libz
+	graph.Diagnostics = []Diagnostic{
+		{Code: DiagUnresolvedRPath, Severity: SeverityWarning, File: "main", Dependency: "@rpath/libmissing.dylib", Message: "missing"},
+	}
+	return NewGraphDocument(graph, JSONOptions{})
+}
+
+// queryNames returns the names of the libraries that match the expression.
+func queryNames(t *testing.T, rows []*QueryRow, expr string) []string {
+	query, err := ParseQuery(expr)
+	if err != nil {
+		t.Fatalf("%s: %s", expr, err)
+	}
+	var ret []string
+	for _, row := range FilterQueryRows(rows, query) {
+		ret = append(ret, row.Node.Name)
+	}
+	return ret
+}
+
+type queryTest struct {
+	expr     string
+	expected []string
+}
+
+func TestQuery(t *testing.T) {
+	rows := NewQueryRows(newTestQueryDocument())
+	testcases := []queryTest{
+		{"unresolved", []string{"libmissing.dylib"}},
+		{"weak", []string{"libweak.dylib"}},
+		{"ignored", []string{"libSystem.B.dylib"}},
+		{"topLevel", []string{"main"}},
+		{"path~/opt/homebrew", []string{"libpng16.16.dylib", "libz.1.dylib"}},
+		{`path~"^/opt/homebrew/.*/libz"`, []string{"libz.1.dylib"}},
+		{"depth<2 and not topLevel", []string{"libpng16.16.dylib", "libweak.dylib", "libSystem.B.dylib", "libmissing.dylib"}},
+		{"depth>=2", []string{"libz.1.dylib"}},
+		{"origin=homebrew && package!=zlib", []string{"libpng16.16.dylib"}},
+		{"!(topLevel || depth=1)", []string{"libz.1.dylib"}},
+		{"version>2.9", []string{"libpng16.16.dylib", "libweak.dylib"}},
+		{"version<=1.3", []string{"libz.1.dylib"}},
+		{"arches=x86_64", []string{"libz.1.dylib"}},
+		{"arches and arches!=x86_64", []string{"libpng16.16.dylib"}},
+		{"loadPaths~^@rpath/ and not unresolved", []string{"libpng16.16.dylib", "libz.1.dylib"}},
+		{"weak=false and ignoredBy", []string{"libSystem.B.dylib"}},
+		{"deps=1 or parents>1", []string{"libpng16.16.dylib"}},
+	}
+
+	for _, testcase := range testcases {
+		if actual := queryNames(t, rows, testcase.expr); !reflect.DeepEqual(actual, testcase.expected) {
+			t.Errorf("Expected %v for %q, but got %v", testcase.expected, testcase.expr, actual)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	testcases := map[string]string{
+		"":                   "expected a field",
+		"foo":                "unknown field: foo",
+		"depth<":             "expected a value",
+		"depth<abc":          "must be compared with an integer",
+		"weak=yes":           "must be compared with true or false",
+		"weak<true":          "can only be compared for equality",
+		"depth~1":            "cannot be matched by a regular expression",
+		"name>a":             "can only be compared for equality or matched by a regular expression",
+		"path~(":             "invalid regular expression",
+		"(weak":              "expected )",
+		"weak unresolved":    "unexpected \"unresolved\"",
+		`name="unterminated`: "unterminated string",
+	}
+
+	for expr, expected := range testcases {
+		if _, err := ParseQuery(expr); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q for %q, but got %v", expected, expr, err)
+		}
+	}
+}
+
+func TestWriteQueryTable(t *testing.T) {
+	rows := NewQueryRows(newTestQueryDocument())
+	fields, err := ParseQueryFields("name, depth,version,arches")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := WriteQueryTable(&out, rows[:3], fields); err != nil {
+		t.Fatal(err)
+	}
+	expected := `NAME               DEPTH  VERSION  ARCHES
+main               0      -        -
+libpng16.16.dylib  1      57.0.0   arm64
+libz.1.dylib       2      1.3.0    arm64,x86_64
+`
+	if out.String() != expected {
+		t.Errorf("Expected the table:\n%s\nBut got:\n%s", expected, out.String())
+	}
+
+	if _, err := ParseQueryFields("name,foo"); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+}
+
+func TestAggregateQueryRows(t *testing.T) {
+	rows := NewQueryRows(newTestQueryDocument())
+	origin, _ := getQueryField("origin")
+	arches, _ := getQueryField("arches")
+
+	expected := []QueryCount{{"-", 3}, {"homebrew", 2}, {"system", 1}}
+	if actual := AggregateQueryRows(rows, origin); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+	expected = []QueryCount{{"-", 4}, {"arm64", 2}, {"x86_64", 1}}
+	if actual := AggregateQueryRows(rows, arches); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+}
+
+func TestFilterGraphDocument(t *testing.T) {
+	doc := newTestQueryDocument()
+	rows := NewQueryRows(doc)
+	query, err := ParseQuery("topLevel or path~/opt/homebrew or unresolved")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered := FilterGraphDocument(doc, rows, query)
+	var names []string
+	for i, node := range filtered.Nodes {
+		if node.ID != i {
+			t.Errorf("Expected node %d to have been renumbered, but got %d", i, node.ID)
+		}
+		names = append(names, node.Name)
+	}
+	if expected := []string{"main", "libpng16.16.dylib", "libz.1.dylib", "libmissing.dylib"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the nodes %v, but got %v", expected, names)
+	}
+	if len(filtered.Edges) != 3 || !reflect.DeepEqual(filtered.Roots, []int{0}) || len(filtered.Diagnostics) != 1 {
+		t.Errorf("Expected 3 edges, the root 0 and 1 diagnostic, but got %d, %v and %d", len(filtered.Edges), filtered.Roots, len(filtered.Diagnostics))
+	}
+
+	// The subgraph can be read back as a dependency graph
+	if _, err := filtered.Graph(); err != nil {
+		t.Error(err)
+	}
+}
+
+// queryRowSummaries summarises the rows by real path, leaving out the fields
+// that depend on which libraries are top-level files.
+func queryRowSummaries(rows []*QueryRow) []string {
+	var ret []string
+	for _, row := range rows {
+		ret = append(ret, fmt.Sprintf("%s name=%s loadPaths=%v parents=%d deps=%d unresolved=%t weak=%t ignored=%t package=%v",
+			row.Node.RealPath, row.Node.Name, row.LoadPaths, row.Parents, row.Deps, row.Node.Unresolved, row.Weak, row.Ignored, row.Node.Package))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestFilterGraphDocumentReload(t *testing.T) {
+	doc := newTestQueryDocument()
+	rows := NewQueryRows(doc)
+	testcases := []string{
+		"unresolved",
+		"not topLevel",
+		"path~/opt/homebrew",
+		"topLevel or path~/opt/homebrew or unresolved",
+		"ignored or weak",
+		"name=libz.1.dylib",
+	}
+
+	for _, expr := range testcases {
+		query, err := ParseQuery(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+		filtered := FilterGraphDocument(doc, rows, query)
+		data, err := json.Marshal(filtered)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		graph, err := DepsLoadJSON(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %s", expr, err)
+			continue
+		}
+		expected := queryRowSummaries(NewQueryRows(filtered))
+		actual := queryRowSummaries(NewQueryRows(NewGraphDocument(graph, JSONOptions{})))
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: Expected the exported subgraph to be read back as\n%s\nbut got\n%s", expr, strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+		}
+	}
+}
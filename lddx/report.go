@@ -0,0 +1,305 @@
+package lddx
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed report
+var reportAssets embed.FS
+
+// ReportOptions specifies how the HTML report is written.
+type ReportOptions struct {
+	Title     string    // The title of the report
+	Generator string    // The name and version of the tool that wrote the report
+	Timestamp time.Time // When the report was generated, or the current time if zero
+}
+
+// reportNode is a library in the dependency tree of the report.
+type reportNode struct {
+	Dep      *Dependency   // The library, as referenced by its parent
+	Children []*reportNode // The dependencies of the library
+	Class    string        // The CSS class of the library
+	Note     string        // Why the library is shown differently, if it is
+	SeeAbove bool          // Indicates if the dependencies are not repeated, as they are listed above
+	Open     bool          // Indicates if the dependencies are shown initially
+}
+
+// reportLibrary is a row of the library table of the report.
+type reportLibrary struct {
+	Name     string   // The name of the library
+	Paths    []string // Every install name by which the library is referenced
+	RealPath string   // The real path to the library
+	Versions string   // The compatibility and current version of the library
+	Arches   string   // The architectures of the library
+	Size     string   // The size of the file, if it could be read
+	Origin   string   // The package manager and package that installed the library, if known
+	Status   string   // Whether the library is a top-level file, ignored, unresolved or weak
+	Class    string   // The CSS class of the library
+}
+
+// reportCount is the number of libraries with a given property.
+type reportCount struct {
+	Name  string
+	Count int
+}
+
+// reportSummary contains the totals shown at the top of the report.
+type reportSummary struct {
+	Libraries  int           // The number of unique libraries, excluding the top-level files
+	Unresolved int           // The number of libraries that could not be resolved
+	Pruned     int           // The number of ignored libraries
+	Weak       int           // The number of libraries that are only weakly loaded
+	Errors     int           // The number of error diagnostics
+	Warnings   int           // The number of warning diagnostics
+	Origins    []reportCount // The number of libraries from each origin, sorted by name
+}
+
+// reportData is the data rendered by the report template.
+type reportData struct {
+	Title       string
+	Generator   string
+	Generated   string
+	Summary     reportSummary
+	Trees       []*reportNode
+	Libraries   []*reportLibrary
+	Diagnostics []Diagnostic
+	CSS         template.CSS
+	JS          template.JS
+}
+
+// reportClass returns the CSS class of a library.
+func reportClass(dep *Dependency, topLevel bool) string {
+	switch {
+	case topLevel:
+		return "top-level"
+	case dep.NotResolved:
+		return "unresolved"
+	case dep.Pruned:
+		return "pruned"
+	case dep.IsWeakDep:
+		return "weak"
+	}
+	return ""
+}
+
+// reportNote returns why a library in the tree is shown differently, if it is.
+func reportNote(dep *Dependency) string {
+	switch {
+	case dep.NotResolved:
+		return "not resolved"
+	case dep.PrunedBy != "":
+		return "ignored by " + dep.PrunedBy
+	case dep.Pruned:
+		return "ignored"
+	case dep.IsWeakDep:
+		return "weak"
+	}
+	return ""
+}
+
+// formatSize formats a file size in bytes for people.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// getReportTrees returns the dependency tree of each top-level file. The
+// dependencies of each library are only listed the first time it is seen.
+func getReportTrees(graph *DependencyGraph, directDeps map[string][]*Dependency) []*reportNode {
+	expanded := make(map[string]bool)
+
+	var build func(dep *Dependency, topLevel bool, depth int) *reportNode
+	build = func(dep *Dependency, topLevel bool, depth int) *reportNode {
+		node := &reportNode{Dep: dep, Class: reportClass(dep, topLevel), Open: depth == 0}
+		if !topLevel {
+			node.Note = reportNote(dep)
+		}
+
+		subDeps := directDeps[dep.RealPath]
+		if len(subDeps) == 0 {
+			return node
+		} else if expanded[dep.RealPath] {
+			node.SeeAbove = true
+			return node
+		}
+		expanded[dep.RealPath] = true
+
+		for _, subDep := range subDeps {
+			node.Children = append(node.Children, build(subDep, false, depth+1))
+		}
+		return node
+	}
+
+	var ret []*reportNode
+	for _, topDep := range graph.TopDeps {
+		ret = append(ret, build(topDep, true, 0))
+	}
+	return ret
+}
+
+// getReportLibraries returns the rows of the library table, sorted by real path,
+// and fills in the library totals of the summary.
+func getReportLibraries(graph *DependencyGraph, directDeps map[string][]*Dependency, summary *reportSummary) []*reportLibrary {
+	libs := make(map[string]*reportLibrary)
+	deps := make(map[string]*Dependency)
+	paths := make(map[string]map[string]bool)
+	required := make(map[string]bool)
+	topLevels := make(map[string]bool)
+
+	var queue []*Dependency
+	add := func(dep *Dependency) {
+		if paths[dep.RealPath] == nil {
+			paths[dep.RealPath] = make(map[string]bool)
+		}
+		paths[dep.RealPath][dep.Path] = true
+		if !dep.IsWeakDep {
+			required[dep.RealPath] = true
+		}
+		if _, ok := deps[dep.RealPath]; !ok {
+			deps[dep.RealPath] = dep
+			queue = append(queue, dep)
+		}
+	}
+
+	for _, topDep := range graph.TopDeps {
+		topLevels[topDep.RealPath] = true
+		add(topDep)
+	}
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		for _, subDep := range directDeps[dep.RealPath] {
+			add(subDep)
+		}
+	}
+
+	origins := make(map[string]int)
+	for realPath, dep := range deps {
+		lib := &reportLibrary{
+			Name:     dep.Name,
+			RealPath: realPath,
+			Versions: dep.IDInfo,
+			Arches:   strings.Join(dep.Arches, ", "),
+		}
+		if lib.Versions == "" {
+			lib.Versions = dep.Info
+		}
+		for path := range paths[realPath] {
+			lib.Paths = append(lib.Paths, path)
+		}
+		sort.Strings(lib.Paths)
+		if info, err := os.Stat(realPath); err == nil && !dep.NotResolved {
+			lib.Size = formatSize(info.Size())
+		}
+		pkg, hasOrigin := getPackageRef(dep)
+		if hasOrigin {
+			lib.Origin = strings.TrimSpace(fmt.Sprintf("%s %s %s", pkg.Origin, pkg.Name, pkg.Version))
+		}
+
+		weakOnly := !required[realPath]
+		switch {
+		case topLevels[realPath]:
+			lib.Status, lib.Class = "Top-level file", "top-level"
+		case dep.NotResolved:
+			lib.Status, lib.Class = "Not resolved", "unresolved"
+			summary.Unresolved++
+		case dep.Pruned:
+			lib.Status, lib.Class = "Ignored", "pruned"
+			if dep.PrunedBy != "" {
+				lib.Status += " by " + dep.PrunedBy
+			}
+			summary.Pruned++
+		case weakOnly:
+			lib.Status, lib.Class = "Weak", "weak"
+		}
+		if weakOnly && !topLevels[realPath] {
+			summary.Weak++
+		}
+		if !topLevels[realPath] {
+			summary.Libraries++
+			if hasOrigin {
+				origins[string(pkg.Origin)]++
+			}
+		}
+		libs[realPath] = lib
+	}
+
+	for name, count := range origins {
+		summary.Origins = append(summary.Origins, reportCount{Name: name, Count: count})
+	}
+	sort.Slice(summary.Origins, func(i, j int) bool {
+		return summary.Origins[i].Name < summary.Origins[j].Name
+	})
+
+	ret := make([]*reportLibrary, 0, len(libs))
+	for _, lib := range libs {
+		ret = append(ret, lib)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].RealPath < ret[j].RealPath
+	})
+	return ret
+}
+
+// DepsWriteHTMLReport writes a self-contained HTML report of the dependency
+// graph, which can be viewed offline. It contains a summary, a collapsible
+// dependency tree of each top-level file, a searchable table of the unique
+// libraries and the diagnostics. The graph may also have been read from JSON.
+func DepsWriteHTMLReport(w io.Writer, graph *DependencyGraph, opts ReportOptions) error {
+	tmpl, err := template.ParseFS(reportAssets, "report/report.html.tmpl")
+	if err != nil {
+		return err
+	}
+	css, err := reportAssets.ReadFile("report/report.css")
+	if err != nil {
+		return err
+	}
+	js, err := reportAssets.ReadFile("report/report.js")
+	if err != nil {
+		return err
+	}
+
+	timestamp := opts.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	directDeps := graphDirectDeps(graph)
+	data := &reportData{
+		Title:       opts.Title,
+		Generator:   opts.Generator,
+		Generated:   timestamp.UTC().Format("2006-01-02 15:04:05 MST"),
+		Trees:       getReportTrees(graph, directDeps),
+		Diagnostics: graph.Diagnostics,
+		CSS:         template.CSS(css),
+		JS:          template.JS(js),
+	}
+	data.Libraries = getReportLibraries(graph, directDeps, &data.Summary)
+	for _, diag := range graph.Diagnostics {
+		switch diag.Severity {
+		case SeverityError:
+			data.Summary.Errors++
+		case SeverityWarning:
+			data.Summary.Warnings++
+		}
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return err
+	}
+	_, err = w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,36 @@
+(function () {
+	"use strict";
+
+	function setTreeOpen(open) {
+		document.querySelectorAll("ul.tree details").forEach(function (details) {
+			details.open = open;
+		});
+	}
+
+	document.getElementById("expand-all").addEventListener("click", function () {
+		setTreeOpen(true);
+	});
+	document.getElementById("collapse-all").addEventListener("click", function () {
+		setTreeOpen(false);
+	});
+
+	// Every word of the query must appear somewhere in the row
+	var search = document.getElementById("library-search");
+	var rows = document.querySelectorAll("#libraries tbody tr");
+	var shown = document.getElementById("libraries-shown");
+	search.addEventListener("input", function () {
+		var words = search.value.toLowerCase().split(/\s+/).filter(Boolean);
+		var count = 0;
+		rows.forEach(function (row) {
+			var text = row.textContent.toLowerCase();
+			var matches = words.every(function (word) {
+				return text.indexOf(word) >= 0;
+			});
+			row.classList.toggle("hidden", !matches);
+			if (matches) {
+				count++;
+			}
+		});
+		shown.textContent = count;
+	});
+})();
@@ -0,0 +1,73 @@
+package lddx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDepsWriteHTMLReport(t *testing.T) {
+	libz := &Dependency{Name: "libz.dylib", Path: "@rpath/libz.dylib", RealPath: "/opt/lib/libz.dylib", Deps: &[]*Dependency{}}
+	libc := &Dependency{Name: "libc.dylib", Path: "@rpath/libc.dylib", RealPath: "/opt/lib/libc.dylib", Arches: []string{"x86_64", "arm64"}, Deps: &[]*Dependency{libz}}
+	liba := &Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/opt/lib/liba.dylib", Deps: &[]*Dependency{libc}}
+	libb := &Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: "/opt/lib/libb.dylib", Deps: &[]*Dependency{libc}}
+	graph := newTestGraph(
+		&Dependency{Name: "main", Path: "main", RealPath: "/app/main"},
+		liba,
+		libb,
+		&Dependency{Name: "libweak.dylib", Path: "@rpath/libweak.dylib", RealPath: "/opt/lib/libweak.dylib", IsWeakDep: true, Deps: &[]*Dependency{}},
+		&Dependency{Name: "libSystem.B.dylib", Path: "/usr/lib/libSystem.B.dylib", RealPath: "/usr/lib/libSystem.B.dylib", Pruned: true, PrunedBy: "ignore-prefix:/usr/lib"},
+		&Dependency{Name: "libmissing.dylib", Path: "@rpath/libmissing.dylib", RealPath: "@rpath/libmissing.dylib", NotResolved: true},
+	)
+	graph.FlatDeps[libc.RealPath] = libc
+	graph.FlatDeps[libz.RealPath] = libz
+	graph.Diagnostics = []Diagnostic{{Code: DiagUnresolvedRPath, Severity: SeverityWarning, File: "main",
+		Dependency: "@rpath/libmissing.dylib", Message: "@rpath/libmissing.dylib not found in the rpaths: []"}}
+
+	var out bytes.Buffer
+	opts := ReportOptions{Title: "Report <main>", Generator: "lddx 1.0", Timestamp: time.Unix(1700000000, 0)}
+	if err := DepsWriteHTMLReport(&out, graph, opts); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+
+	expected := []string{
+		"<title>Report &lt;main&gt;</title>",
+		"Generated 2023-11-14 22:13:20 UTC by lddx 1.0",
+		`<span class="count">7</span> libraries`,
+		`<li class="unresolved"><span class="count">1</span> unresolved</li>`,
+		`<span class="count">1</span> ignored`,
+		`<span class="count">1</span> weak only`,
+		"Libraries by origin: system (1)",
+		`<span class="pruned">[ignored by ignore-prefix:/usr/lib]</span>`,
+		`<span class="see-above">(see above)</span>`,
+		"<td>x86_64, arm64</td>",
+		"<td>Ignored by ignore-prefix:/usr/lib</td>",
+		"<td>unresolved-rpath</td>",
+		`id="library-search"`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(html, s) {
+			t.Errorf("Expected %s in the report", s)
+		}
+	}
+
+	// libc is listed once in the table, and libz only under its first occurrence in the tree
+	if count := strings.Count(html, "<td>libc.dylib</td>"); count != 1 {
+		t.Errorf("Expected libc to be listed once, got %d", count)
+	}
+	if count := strings.Count(html, `title="/opt/lib/libz.dylib"`); count != 1 {
+		t.Errorf("Expected libz to be listed once in the tree, got %d", count)
+	}
+	if count := strings.Count(html, "(see above)"); count != 1 {
+		t.Errorf("Expected one (see above) marker, got %d", count)
+	}
+
+	// The report must be viewable offline
+	for _, s := range []string{"http://", "https://", "<link", "src="} {
+		if strings.Contains(html, s) {
+			t.Errorf("Unexpected external reference %s in the report", s)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package lddx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// SBOMOptions specifies how the dependency graph is written as a software bill of materials.
+type SBOMOptions struct {
+	ToolName    string    // The name of the tool that created the document
+	ToolVersion string    // The version of the tool that created the document
+	Timestamp   time.Time // When the document was created, or the current time if zero
+}
+
+// sbomComponent is a library in the bill of materials, with one per real path.
+type sbomComponent struct {
+	Dep       *Dependency // The library, as first seen
+	TopLevel  bool        // Indicates if the library is one of the files that was processed
+	Package   *packageRef // The package that installed the library, if known
+	Version   string      // The version of the library, if known
+	SHA256    string      // The hex encoded SHA-256 hash of the file, if it could be read
+	Optional  bool        // Indicates if the library is only loaded by weak load commands
+	DependsOn []string    // The real paths of the direct dependencies, sorted and unique
+}
+
+var currentVersionRegex = regexp.MustCompile(`current version (\S+)`)
+
+// sbomVersion returns the version of the library, from the package that
+// installed it, or else from the current version in its load commands.
+func sbomVersion(dep *Dependency, pkg *packageRef) string {
+	if pkg != nil && pkg.Version != "" {
+		return pkg.Version
+	}
+	for _, info := range []string{dep.IDInfo, dep.Info} {
+		if m := currentVersionRegex.FindStringSubmatch(info); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// fileSHA256 returns the hex encoded SHA-256 hash of the file.
+func fileSHA256(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getSBOMComponents returns every library in the graph, sorted by real path.
+func getSBOMComponents(graph *DependencyGraph) []*sbomComponent {
+	directDeps := graphDirectDeps(graph)
+	components := make(map[string]*sbomComponent)
+	required := make(map[string]bool)
+	var queue []*Dependency
+
+	add := func(dep *Dependency, topLevel bool) {
+		if _, ok := components[dep.RealPath]; ok {
+			return
+		}
+		comp := &sbomComponent{Dep: dep, TopLevel: topLevel}
+		comp.Package, _ = getPackageRef(dep)
+		if !dep.NotResolved {
+			if hash, err := fileSHA256(dep.RealPath); err == nil {
+				comp.SHA256 = hash
+			}
+		}
+		comp.Version = sbomVersion(dep, comp.Package)
+		components[dep.RealPath] = comp
+		queue = append(queue, dep)
+	}
+
+	for _, topDep := range graph.TopDeps {
+		required[topDep.RealPath] = true
+		add(topDep, true)
+	}
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		comp := components[dep.RealPath]
+
+		seen := make(map[string]bool)
+		for _, subDep := range directDeps[dep.RealPath] {
+			if !subDep.IsWeakDep {
+				required[subDep.RealPath] = true
+			}
+			if !seen[subDep.RealPath] {
+				seen[subDep.RealPath] = true
+				comp.DependsOn = append(comp.DependsOn, subDep.RealPath)
+			}
+			add(subDep, false)
+		}
+		sort.Strings(comp.DependsOn)
+	}
+
+	ret := make([]*sbomComponent, 0, len(components))
+	for realPath, comp := range components {
+		comp.Optional = !required[realPath]
+		ret = append(ret, comp)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Dep.RealPath < ret[j].Dep.RealPath
+	})
+	return ret
+}
+
+// sbomTimestamp returns the creation time of the document.
+func sbomTimestamp(opts SBOMOptions) string {
+	ts := opts.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return ts.UTC().Format(time.RFC3339)
+}
+
+// sbomUUID derives a version 4 style UUID from the content of the document,
+// so that the same graph written at the same time has the same identifier.
+func sbomUUID(components []*sbomComponent, timestamp string) string {
+	hash := sha256.New()
+	io.WriteString(hash, timestamp)
+	for _, comp := range components {
+		fmt.Fprintf(hash, "\x00%s\x00%s", comp.Dep.RealPath, comp.SHA256)
+	}
+	b := hash.Sum(nil)[:16]
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// writeJSON writes the value as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// CycloneDX 1.5 JSON schema (https://cyclonedx.org/docs/1.5/json/)
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []*cdxComponent `json:"components"`
+	Dependencies []*cdxDepends   `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     cdxTools      `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxTools struct {
+	Components []*cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Scope      string        `json:"scope,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDepends struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// DepsWriteCycloneDX writes the dependency graph as a CycloneDX 1.5 JSON bill
+// of materials, with one component per real path. If a single file was
+// processed, it is the subject of the document rather than a component.
+func DepsWriteCycloneDX(w io.Writer, graph *DependencyGraph, opts SBOMOptions) error {
+	components := getSBOMComponents(graph)
+	timestamp := sbomTimestamp(opts)
+	doc := &cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + sbomUUID(components, timestamp),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: timestamp,
+			Tools: cdxTools{Components: []*cdxComponent{
+				{Type: "application", Name: opts.ToolName, Version: opts.ToolVersion},
+			}},
+		},
+		Components:   []*cdxComponent{},
+		Dependencies: []*cdxDepends{},
+	}
+
+	for _, comp := range components {
+		dep := comp.Dep
+		ret := &cdxComponent{
+			Type:    "library",
+			BOMRef:  dep.RealPath,
+			Name:    dep.Name,
+			Version: comp.Version,
+			Properties: []cdxProperty{
+				{Name: "lddx:path", Value: dep.Path},
+				{Name: "lddx:realPath", Value: dep.RealPath},
+			},
+		}
+		if comp.TopLevel && dep.ID == "" {
+			ret.Type = "application"
+		}
+		if comp.SHA256 != "" {
+			ret.Hashes = []cdxHash{{Alg: "SHA-256", Content: comp.SHA256}}
+		}
+		if comp.Package != nil {
+			ret.PURL = comp.Package.PURL()
+			ret.Properties = append(ret.Properties, cdxProperty{Name: "lddx:origin", Value: string(comp.Package.Origin)})
+		}
+		if dep.Pruned && !dep.NotResolved {
+			ret.Scope = "excluded"
+		} else if comp.Optional {
+			ret.Scope = "optional"
+		}
+		if dep.PrunedBy != "" {
+			ret.Properties = append(ret.Properties, cdxProperty{Name: "lddx:prunedBy", Value: dep.PrunedBy})
+		}
+		if dep.NotResolved {
+			ret.Properties = append(ret.Properties, cdxProperty{Name: "lddx:notResolved", Value: "true"})
+		}
+
+		if comp.TopLevel && len(graph.TopDeps) == 1 {
+			doc.Metadata.Component = ret
+		} else {
+			doc.Components = append(doc.Components, ret)
+		}
+		doc.Dependencies = append(doc.Dependencies, &cdxDepends{
+			Ref:       dep.RealPath,
+			DependsOn: append([]string{}, comp.DependsOn...),
+		})
+	}
+
+	return writeJSON(w, doc)
+}
+
+// SPDX 2.3 JSON schema (https://spdx.github.io/spdx-spec/v2.3/)
+type spdxDocument struct {
+	SPDXVersion       string              `json:"spdxVersion"`
+	DataLicense       string              `json:"dataLicense"`
+	SPDXID            string              `json:"SPDXID"`
+	Name              string              `json:"name"`
+	DocumentNamespace string              `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo    `json:"creationInfo"`
+	Packages          []*spdxPackage      `json:"packages"`
+	Relationships     []*spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	PackageFileName       string            `json:"packageFileName"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose"`
+	Comment               string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// DepsWriteSPDX writes the dependency graph as an SPDX 2.3 JSON document,
+// with one package per real path. The document describes the files that
+// were processed, and each library depends on those it loads.
+func DepsWriteSPDX(w io.Writer, graph *DependencyGraph, opts SBOMOptions) error {
+	components := getSBOMComponents(graph)
+	timestamp := sbomTimestamp(opts)
+	name := opts.ToolName
+	if len(graph.TopDeps) == 1 {
+		name = graph.TopDeps[0].Name
+	}
+
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://github.com/jtanx/lddx/spdxdocs/%s-%s", purlEscape(name), sbomUUID(components, timestamp)),
+		CreationInfo: spdxCreationInfo{
+			Created:  timestamp,
+			Creators: []string{fmt.Sprintf("Tool: %s-%s", opts.ToolName, opts.ToolVersion)},
+		},
+		Packages:      []*spdxPackage{},
+		Relationships: []*spdxRelationship{},
+	}
+
+	ids := make(map[string]string)
+	for i, comp := range components {
+		ids[comp.Dep.RealPath] = fmt.Sprintf("SPDXRef-Package-%d", i+1)
+	}
+
+	for _, comp := range components {
+		dep := comp.Dep
+		pkg := &spdxPackage{
+			SPDXID:                ids[dep.RealPath],
+			Name:                  dep.Name,
+			VersionInfo:           comp.Version,
+			PackageFileName:       dep.RealPath,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "LIBRARY",
+		}
+		if comp.TopLevel && dep.ID == "" {
+			pkg.PrimaryPackagePurpose = "APPLICATION"
+		}
+		if comp.SHA256 != "" {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: comp.SHA256}}
+		}
+		if comp.Package != nil && comp.Package.PURL() != "" {
+			pkg.ExternalRefs = []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  comp.Package.PURL(),
+			}}
+		}
+		if dep.NotResolved {
+			pkg.Comment = "Not resolved"
+		} else if dep.PrunedBy != "" {
+			pkg.Comment = "Not analysed: ignored by " + dep.PrunedBy
+		}
+		doc.Packages = append(doc.Packages, pkg)
+
+		if comp.TopLevel {
+			doc.Relationships = append(doc.Relationships, &spdxRelationship{
+				SPDXElementID:      "SPDXRef-DOCUMENT",
+				RelationshipType:   "DESCRIBES",
+				RelatedSPDXElement: pkg.SPDXID,
+			})
+		}
+	}
+
+	for _, comp := range components {
+		for _, realPath := range comp.DependsOn {
+			doc.Relationships = append(doc.Relationships, &spdxRelationship{
+				SPDXElementID:      ids[comp.Dep.RealPath],
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: ids[realPath],
+			})
+		}
+	}
+
+	return writeJSON(w, doc)
+}
@@ -0,0 +1,161 @@
+package lddx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// newTestSBOMGraph returns a graph of files in dir, where main loads liba
+// (and weakly libweak), liba loads libb, and libSystem is pruned.
+func newTestSBOMGraph(t *testing.T, dir string) *DependencyGraph {
+	for _, name := range []string{"main", "liba.dylib", "libb.dylib", "libweak.dylib"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	libb := &Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: filepath.Join(dir, "libb.dylib"),
+		Info: "compatibility version 1.0.0, current version 1.2.3", Deps: &[]*Dependency{}}
+	liba := &Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: filepath.Join(dir, "liba.dylib"), Deps: &[]*Dependency{libb}}
+	graph := newTestGraph(
+		&Dependency{Name: "main", Path: filepath.Join(dir, "main"), RealPath: filepath.Join(dir, "main")},
+		liba,
+		&Dependency{Name: "libweak.dylib", Path: "@rpath/libweak.dylib", RealPath: filepath.Join(dir, "libweak.dylib"), IsWeakDep: true, Deps: &[]*Dependency{}},
+		&Dependency{Name: "libSystem.B.dylib", Path: "/usr/lib/libSystem.B.dylib", RealPath: "/usr/lib/libSystem.B.dylib", Pruned: true, PrunedBy: "/usr/lib"},
+		&Dependency{Name: "libmissing.dylib", Path: "@rpath/libmissing.dylib", RealPath: "@rpath/libmissing.dylib", NotResolved: true},
+	)
+	graph.FlatDeps[libb.RealPath] = libb
+	return graph
+}
+
+func testSHA256(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestDepsWriteCycloneDX(t *testing.T) {
+	dir := t.TempDir()
+	graph := newTestSBOMGraph(t, dir)
+	opts := SBOMOptions{ToolName: "lddx", ToolVersion: "1.0", Timestamp: time.Unix(1700000000, 0)}
+
+	var out bytes.Buffer
+	if err := DepsWriteCycloneDX(&out, graph, opts); err != nil {
+		t.Fatal(err)
+	}
+	var doc cdxDocument
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.BOMFormat != "CycloneDX" || doc.SpecVersion != "1.5" {
+		t.Errorf("Unexpected format %s %s", doc.BOMFormat, doc.SpecVersion)
+	}
+	if !regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(doc.SerialNumber) {
+		t.Errorf("Unexpected serial number %s", doc.SerialNumber)
+	}
+	if doc.Metadata.Timestamp != "2023-11-14T22:13:20Z" {
+		t.Errorf("Unexpected timestamp %s", doc.Metadata.Timestamp)
+	}
+	if main := doc.Metadata.Component; main == nil || main.Name != "main" || main.Type != "application" {
+		t.Errorf("Expected main to be the subject of the document, got %+v", main)
+	}
+
+	components := make(map[string]*cdxComponent)
+	for _, comp := range doc.Components {
+		components[comp.Name] = comp
+	}
+	if len(components) != 5 {
+		t.Fatalf("Expected 5 components, got %d", len(components))
+	}
+	if comp := components["libb.dylib"]; comp.Version != "1.2.3" || len(comp.Hashes) != 1 || comp.Hashes[0].Content != testSHA256("libb.dylib") {
+		t.Errorf("Unexpected libb component %+v", comp)
+	}
+	if comp := components["libweak.dylib"]; comp.Scope != "optional" {
+		t.Errorf("Expected libweak to be optional, got %s", comp.Scope)
+	}
+	if comp := components["libSystem.B.dylib"]; comp.Scope != "excluded" || len(comp.Hashes) != 0 {
+		t.Errorf("Unexpected libSystem component %+v", comp)
+	}
+	if comp := components["liba.dylib"]; comp.Scope != "" {
+		t.Errorf("Expected liba to be required, got %s", comp.Scope)
+	}
+
+	dependsOn := make(map[string][]string)
+	for _, dep := range doc.Dependencies {
+		dependsOn[dep.Ref] = dep.DependsOn
+	}
+	if deps := dependsOn[filepath.Join(dir, "main")]; len(deps) != 4 {
+		t.Errorf("Expected main to depend on 4 libraries, got %v", deps)
+	}
+	if deps := dependsOn[filepath.Join(dir, "liba.dylib")]; len(deps) != 1 || deps[0] != filepath.Join(dir, "libb.dylib") {
+		t.Errorf("Expected liba to depend on libb, got %v", deps)
+	}
+
+	var again bytes.Buffer
+	if err := DepsWriteCycloneDX(&again, graph, opts); err != nil {
+		t.Fatal(err)
+	} else if again.String() != out.String() {
+		t.Errorf("Expected the same document to be written twice")
+	}
+}
+
+func TestDepsWriteSPDX(t *testing.T) {
+	dir := t.TempDir()
+	graph := newTestSBOMGraph(t, dir)
+	graph.TopDeps[0].RealPath = filepath.Join(dir, "Cellar", "app", "2.0", "bin", "main")
+	if err := os.MkdirAll(filepath.Dir(graph.TopDeps[0].RealPath), 0755); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(graph.TopDeps[0].RealPath, []byte("main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := DepsWriteSPDX(&out, graph, SBOMOptions{ToolName: "lddx", ToolVersion: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	var doc spdxDocument
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.SPDXVersion != "SPDX-2.3" || doc.Name != "main" || doc.CreationInfo.Creators[0] != "Tool: lddx-1.0" {
+		t.Errorf("Unexpected document %+v", doc)
+	}
+
+	packages := make(map[string]*spdxPackage)
+	for _, pkg := range doc.Packages {
+		packages[pkg.SPDXID] = pkg
+	}
+	if len(packages) != 6 {
+		t.Fatalf("Expected 6 packages, got %d", len(packages))
+	}
+
+	var describes, dependsOn int
+	for _, rel := range doc.Relationships {
+		switch rel.RelationshipType {
+		case "DESCRIBES":
+			describes++
+			pkg := packages[rel.RelatedSPDXElement]
+			if pkg.Name != "main" || pkg.VersionInfo != "2.0" || pkg.PrimaryPackagePurpose != "APPLICATION" ||
+				len(pkg.ExternalRefs) != 1 || pkg.ExternalRefs[0].ReferenceLocator != "pkg:brew/app@2.0" ||
+				len(pkg.Checksums) != 1 || pkg.Checksums[0].ChecksumValue != testSHA256("main") {
+				t.Errorf("Unexpected main package %+v", pkg)
+			}
+		case "DEPENDS_ON":
+			dependsOn++
+			if packages[rel.SPDXElementID] == nil || packages[rel.RelatedSPDXElement] == nil {
+				t.Errorf("Unknown package in relationship %+v", rel)
+			}
+		}
+	}
+	if describes != 1 || dependsOn != 5 {
+		t.Errorf("Expected 1 DESCRIBES and 5 DEPENDS_ON relationships, got %d and %d", describes, dependsOn)
+	}
+}
@@ -0,0 +1,416 @@
+package lddx
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// SchemaVersion is the version of the JSON schema written by DepsWriteJSON.
+// Version 1 is the unversioned serialisation of DependencyGraph that was
+// written before the schema was versioned; it can still be read.
+const SchemaVersion = 2
+
+// JSONSchema is the JSON Schema (draft 2020-12) describing the documents
+// written by DepsWriteJSON.
+//
+//go:embed schema/graph.schema.json
+var JSONSchema []byte
+
+// JSONOptions specifies the tool recorded in the JSON document.
+type JSONOptions struct {
+	ToolName    string // The name of the tool that wrote the document
+	ToolVersion string // The version of the tool that wrote the document
+}
+
+// GraphDocument is the versioned JSON serialisation of a dependency graph.
+// Each library is a node, identified by its real path, and each load command
+// is an edge, so libraries are never repeated. The field names are part of
+// the published schema, and may only change with the schema version.
+type GraphDocument struct {
+	SchemaVersion int                `json:"schemaVersion"`       // The version of the schema, which is SchemaVersion when written
+	Generator     *GraphGenerator    `json:"generator,omitempty"` // The tool that wrote the document, if known
+	Roots         []int              `json:"roots"`               // The ids of the top-level files, in the order they were specified
+	Nodes         []*GraphNode       `json:"nodes"`               // The libraries, where the id of each is its index
+	Edges         []*GraphEdge       `json:"edges"`               // The load commands, grouped by library in the order they are listed
+	Diagnostics   []*GraphDiagnostic `json:"diagnostics"`         // Notable outcomes of calculating or collecting the dependencies
+}
+
+// GraphGenerator identifies the tool that wrote a document.
+type GraphGenerator struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// GraphVersions are the compatibility and current versions of a library (e.g. 1.2.3).
+type GraphVersions struct {
+	Compatibility string `json:"compatibility"`
+	Current       string `json:"current"`
+}
+
+// GraphFramework identifies the framework bundle that a library is the binary of.
+type GraphFramework struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// GraphPackage identifies the package that installed a library.
+type GraphPackage struct {
+	Origin  Origin `json:"origin"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+// GraphNode is a library or top-level file.
+type GraphNode struct {
+	ID          int             `json:"id"`                    // The index of the node in the document
+	Name        string          `json:"name"`                  // The name of the library
+	RealPath    string          `json:"realPath"`              // The real path, or the install name if it could not be resolved
+	Path        string          `json:"path,omitempty"`        // The path of a top-level file, as it was specified
+	TopLevel    bool            `json:"topLevel,omitempty"`    // Indicates if the node is one of the files that was processed
+	Unresolved  bool            `json:"unresolved,omitempty"`  // Indicates if the library could not be found or read
+	InstallName string          `json:"installName,omitempty"` // The install name of the library itself (LC_ID_DYLIB), if any
+	Version     *GraphVersions  `json:"version,omitempty"`     // The versions of the library itself (LC_ID_DYLIB), if any
+	Framework   *GraphFramework `json:"framework,omitempty"`   // The framework bundle, if the library is a framework binary
+	Package     *GraphPackage   `json:"package,omitempty"`     // The package that installed the library, if known
+	RPaths      []string        `json:"rpaths,omitempty"`      // The rpaths of the file
+	UUIDs       []string        `json:"uuids,omitempty"`       // The Mach-O UUIDs of the file, one per architecture
+	Arches      []string        `json:"arches,omitempty"`      // The architectures of the file
+}
+
+// GraphEdge is a load command of a library, referencing another library.
+type GraphEdge struct {
+	From        int            `json:"from"`                // The id of the node with the load command
+	To          int            `json:"to"`                  // The id of the node that is loaded
+	InstallName string         `json:"installName"`         // The path, as specified by the load command
+	Version     *GraphVersions `json:"version,omitempty"`   // The versions, as specified by the load command
+	Weak        bool           `json:"weak,omitempty"`      // Indicates if this is a weak load command
+	Ignored     bool           `json:"ignored,omitempty"`   // Indicates if the dependencies of the library were not read through this edge
+	IgnoredBy   string         `json:"ignoredBy,omitempty"` // The option or ignore rule that caused the library to be ignored, if any
+}
+
+// GraphDiagnostic is a notable outcome of calculating or collecting the dependencies.
+type GraphDiagnostic struct {
+	Code       DiagnosticCode `json:"code"`
+	Severity   Severity       `json:"severity"`
+	File       string         `json:"file,omitempty"`
+	Dependency string         `json:"dependency,omitempty"`
+	Message    string         `json:"message"`
+}
+
+// parseVersionInfo parses the versions formatted by formatVersionInfo.
+func parseVersionInfo(info string) *GraphVersions {
+	var compat, current [3]uint32
+	if _, err := fmt.Sscanf(info, "compatibility version %d.%d.%d, current version %d.%d.%d",
+		&compat[0], &compat[1], &compat[2], &current[0], &current[1], &current[2]); err != nil {
+		return nil
+	}
+	return &GraphVersions{
+		Compatibility: fmt.Sprintf("%d.%d.%d", compat[0], compat[1], compat[2]),
+		Current:       fmt.Sprintf("%d.%d.%d", current[0], current[1], current[2]),
+	}
+}
+
+// String formats the versions in the same way as formatVersionInfo.
+func (v *GraphVersions) String() string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("compatibility version %s, current version %s", v.Compatibility, v.Current)
+}
+
+// NewGraphDocument converts a dependency graph into its versioned JSON document.
+// The top-level files are the first nodes, followed by the other libraries
+// sorted by real path. The graph may also have been read from JSON.
+func NewGraphDocument(graph *DependencyGraph, opts JSONOptions) *GraphDocument {
+	doc := &GraphDocument{
+		SchemaVersion: SchemaVersion,
+		Roots:         []int{},
+		Nodes:         []*GraphNode{},
+		Edges:         []*GraphEdge{},
+		Diagnostics:   []*GraphDiagnostic{},
+	}
+	if opts.ToolName != "" {
+		doc.Generator = &GraphGenerator{Name: opts.ToolName, Version: opts.ToolVersion}
+	}
+
+	directDeps := graphDirectDeps(graph)
+	topLevels := make(map[string]*Dependency)
+	refs := make(map[string]*Dependency)
+	unresolved := make(map[string]bool)
+	var realPaths []string
+
+	// Prefer the entry in FlatDeps, which has the information read from the file
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		unresolved[dep.RealPath] = unresolved[dep.RealPath] || dep.NotResolved
+		if _, ok := refs[dep.RealPath]; ok {
+			return
+		}
+		refs[dep.RealPath] = dep
+		if flatDep, ok := graph.FlatDeps[dep.RealPath]; ok && topLevels[dep.RealPath] == nil {
+			refs[dep.RealPath] = flatDep
+		}
+		if topLevels[dep.RealPath] == nil {
+			realPaths = append(realPaths, dep.RealPath)
+		}
+		for _, subDep := range directDeps[dep.RealPath] {
+			walk(subDep)
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		if topLevels[topDep.RealPath] == nil {
+			topLevels[topDep.RealPath] = topDep
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		walk(topDep)
+	}
+	for _, dep := range graph.SortedFlatDeps() {
+		walk(dep)
+	}
+	sort.Strings(realPaths)
+
+	ids := make(map[string]int)
+	addNode := func(dep *Dependency, topLevel bool) {
+		node := &GraphNode{
+			ID:          len(doc.Nodes),
+			Name:        dep.Name,
+			RealPath:    dep.RealPath,
+			TopLevel:    topLevel,
+			Unresolved:  unresolved[dep.RealPath],
+			InstallName: dep.ID,
+			Version:     parseVersionInfo(dep.IDInfo),
+			RPaths:      dep.RPaths,
+			UUIDs:       dep.UUIDs,
+			Arches:      dep.Arches,
+		}
+		if topLevel {
+			node.Path = dep.Path
+			if node.Version == nil {
+				node.Version = parseVersionInfo(dep.Info)
+			}
+		}
+		if dep.Framework != "" {
+			node.Framework = &GraphFramework{Name: dep.Framework, Version: dep.FrameworkVersion}
+		}
+		if dep.Origin != "" {
+			pkg := &packageRef{Origin: dep.Origin, Name: dep.Package, Version: dep.PackageVersion}
+			node.Package = &GraphPackage{Origin: pkg.Origin, Name: pkg.Name, Version: pkg.Version, PURL: pkg.PURL()}
+		}
+		ids[dep.RealPath] = node.ID
+		doc.Nodes = append(doc.Nodes, node)
+	}
+	for _, topDep := range graph.TopDeps {
+		if _, ok := ids[topDep.RealPath]; !ok {
+			doc.Roots = append(doc.Roots, len(doc.Nodes))
+			addNode(topDep, true)
+		}
+	}
+	for _, realPath := range realPaths {
+		addNode(refs[realPath], false)
+	}
+
+	for _, node := range doc.Nodes {
+		for _, subDep := range directDeps[node.RealPath] {
+			doc.Edges = append(doc.Edges, &GraphEdge{
+				From:        node.ID,
+				To:          ids[subDep.RealPath],
+				InstallName: subDep.Path,
+				Version:     parseVersionInfo(subDep.Info),
+				Weak:        subDep.IsWeakDep,
+				Ignored:     subDep.Pruned,
+				IgnoredBy:   subDep.PrunedBy,
+			})
+		}
+	}
+
+	for _, diag := range graph.Diagnostics {
+		doc.Diagnostics = append(doc.Diagnostics, &GraphDiagnostic{
+			Code:       diag.Code,
+			Severity:   diag.Severity,
+			File:       diag.File,
+			Dependency: diag.Dependency,
+			Message:    diag.Message,
+		})
+	}
+	return doc
+}
+
+// DepsWriteJSON writes the dependency graph as a versioned JSON document.
+func DepsWriteJSON(w io.Writer, graph *DependencyGraph, opts JSONOptions) error {
+	out, err := json.MarshalIndent(NewGraphDocument(graph, opts), "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
+
+// dependency recreates the dependency of a node, as referenced by an edge,
+// or by its path if it is a top-level file.
+func (node *GraphNode) dependency(edge *GraphEdge) *Dependency {
+	dep := &Dependency{
+		Name:        filepath.Base(node.RealPath),
+		Path:        node.RealPath,
+		RealPath:    node.RealPath,
+		NotResolved: node.Unresolved,
+	}
+	if edge != nil {
+		dep.Name = filepath.Base(edge.InstallName)
+		dep.Path = edge.InstallName
+		dep.Info = edge.Version.String()
+		dep.IsWeakDep = edge.Weak
+		dep.Pruned = edge.Ignored
+		dep.PrunedBy = edge.IgnoredBy
+	} else {
+		dep.Name = node.Name
+		dep.Info = node.Version.String()
+		if node.Path != "" {
+			// Otherwise, the library is the root of a subgraph
+			dep.Path = node.Path
+		}
+	}
+	if node.Framework != nil {
+		dep.Framework = node.Framework.Name
+		dep.FrameworkVersion = node.Framework.Version
+	}
+	if node.Package != nil {
+		dep.Origin = node.Package.Origin
+		dep.Package = node.Package.Name
+		dep.PackageVersion = node.Package.Version
+	}
+	return dep
+}
+
+// Graph recreates the dependency graph from the document. As in the graph
+// calculated by DepsRead, every reference to a library that was read shares
+// its list of dependencies, and the references by the same path are the same.
+func (doc *GraphDocument) Graph() (*DependencyGraph, error) {
+	graph := &DependencyGraph{FlatDeps: make(map[string]*Dependency)}
+	for i, node := range doc.Nodes {
+		if node.ID != i {
+			return nil, fmt.Errorf("node %d has id %d", i, node.ID)
+		}
+	}
+
+	// The libraries that were read are those referenced by an edge that was not ignored
+	read := make([]bool, len(doc.Nodes))
+	for _, id := range doc.Roots {
+		if id < 0 || id >= len(doc.Nodes) {
+			return nil, fmt.Errorf("root %d does not exist", id)
+		}
+		read[id] = true
+	}
+	for _, edge := range doc.Edges {
+		if edge.From < 0 || edge.From >= len(doc.Nodes) || edge.To < 0 || edge.To >= len(doc.Nodes) {
+			return nil, fmt.Errorf("edge from %d to %d references a node that does not exist", edge.From, edge.To)
+		}
+		read[edge.To] = read[edge.To] || !edge.Ignored
+	}
+
+	deps := make([]*[]*Dependency, len(doc.Nodes))
+	for i, node := range doc.Nodes {
+		if read[i] && !node.Unresolved || node.TopLevel {
+			deps[i] = new([]*Dependency)
+		}
+	}
+
+	shared := make(map[int]*Dependency)
+	for _, edge := range doc.Edges {
+		node := doc.Nodes[edge.To]
+		dep := node.dependency(edge)
+		if deps[edge.To] != nil && !edge.Ignored && !node.TopLevel {
+			if sharedDep, ok := shared[edge.To]; ok && sharedDep.Path == dep.Path {
+				*deps[edge.From] = append(*deps[edge.From], sharedDep)
+				continue
+			} else if !ok {
+				shared[edge.To] = dep
+			}
+			dep.Deps = deps[edge.To]
+			dep.RPaths = node.RPaths
+			dep.ID = node.InstallName
+			dep.IDInfo = node.Version.String()
+			dep.UUIDs = node.UUIDs
+			dep.Arches = node.Arches
+			if _, ok := graph.FlatDeps[node.RealPath]; !ok {
+				graph.FlatDeps[node.RealPath] = dep
+			}
+		}
+		if deps[edge.From] != nil {
+			*deps[edge.From] = append(*deps[edge.From], dep)
+		}
+	}
+
+	for _, id := range doc.Roots {
+		node := doc.Nodes[id]
+		dep := node.dependency(nil)
+		dep.Deps = deps[id]
+		dep.RPaths = node.RPaths
+		dep.ID = node.InstallName
+		dep.IDInfo = node.Version.String()
+		dep.UUIDs = node.UUIDs
+		dep.Arches = node.Arches
+		graph.TopDeps = append(graph.TopDeps, dep)
+	}
+
+	for _, diag := range doc.Diagnostics {
+		graph.Diagnostics = append(graph.Diagnostics, Diagnostic{
+			Code:       diag.Code,
+			Severity:   diag.Severity,
+			File:       diag.File,
+			Dependency: diag.Dependency,
+			Message:    diag.Message,
+		})
+	}
+
+	normaliseGraph(graph)
+	return graph, nil
+}
+
+// DepsLoadJSON reads a dependency graph from JSON of any schema version, as
+// written by DepsWriteJSON or by earlier versions of lddx. The graph is the
+// same as the one calculated by DepsRead, with the repeated subtrees shared.
+// Documents without a schema version are the serialisation of DependencyGraph
+// from before the schema was versioned (version 1), in which each repeated
+// subtree is only listed once; those subtrees are shared again, as by DepsRead.
+func DepsLoadJSON(r io.Reader) (*DependencyGraph, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		SchemaVersion *int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case header.SchemaVersion == nil:
+		var graph *DependencyGraph
+		if err := json.Unmarshal(data, &graph); err != nil {
+			return nil, err
+		} else if graph == nil || graph.TopDeps == nil {
+			return nil, fmt.Errorf("not a dependency graph")
+		}
+		if graph.FlatDeps == nil {
+			graph.FlatDeps = make(map[string]*Dependency)
+		}
+		rehydrateGraph(graph)
+		return graph, nil
+	case *header.SchemaVersion == SchemaVersion:
+		var doc GraphDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		return doc.Graph()
+	}
+	return nil, fmt.Errorf("unsupported schema version %d (the latest supported version is %d)", *header.SchemaVersion, SchemaVersion)
+}
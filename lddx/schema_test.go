@@ -0,0 +1,307 @@
+package lddx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTestSchemaGraph reads a graph with shared, weak, ignored and unresolved libraries.
+func readTestSchemaGraph(t *testing.T) *DependencyGraph {
+	dir := t.TempDir()
+	writeTestMachO(t, filepath.Join(dir, "libc.dylib"), testMachO{ID: "@rpath/libc.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "libw.dylib"), testMachO{ID: "@rpath/libw.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{
+		ID:     "@rpath/liba.dylib",
+		Dylibs: []string{"@rpath/libc.dylib", "/usr/lib/libSystem.B.dylib"},
+		RPaths: []string{"@loader_path"},
+		UUID:   [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	})
+	writeTestMachO(t, filepath.Join(dir, "libb.dylib"), testMachO{
+		ID:     "@rpath/libb.dylib",
+		Dylibs: []string{"@loader_path/libc.dylib", "@rpath/libmissing.dylib"},
+		Weak:   []string{"@loader_path/libw.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib", "@loader_path/libb.dylib", "@loader_path/libc.dylib"},
+	})
+
+	opts := DependencyOptions{
+		Recursive:    true,
+		IgnoredFiles: []string{"libSystem.B.dylib"},
+		Logger:       NewColorLogger(io.Discard, true, true),
+	}
+	graph, err := DepsRead(opts, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+func writeTestDocument(t *testing.T, graph *DependencyGraph) string {
+	var out bytes.Buffer
+	if err := DepsWriteJSON(&out, graph, JSONOptions{ToolName: "lddx", ToolVersion: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func writeTestTree(t *testing.T, graph *DependencyGraph) string {
+	var out strings.Builder
+	if err := DepsWriteTree(&out, graph, TreeOptions{NoColor: true}); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestGraphDocument(t *testing.T) {
+	graph := readTestSchemaGraph(t)
+	doc := NewGraphDocument(graph, JSONOptions{})
+
+	if doc.SchemaVersion != SchemaVersion || doc.Generator != nil {
+		t.Errorf("Unexpected schema version %d or generator %+v", doc.SchemaVersion, doc.Generator)
+	}
+	if !reflect.DeepEqual(doc.Roots, []int{0}) || !doc.Nodes[0].TopLevel || doc.Nodes[0].Name != "main" {
+		t.Errorf("Expected the top-level file to be the first node, but got %v and %+v", doc.Roots, doc.Nodes[0])
+	}
+
+	nodes := make(map[string]*GraphNode)
+	for i, node := range doc.Nodes {
+		if node.ID != i {
+			t.Errorf("Expected node %d to have its index as its id, but got %d", i, node.ID)
+		}
+		nodes[node.Name] = node
+	}
+	if len(doc.Nodes) != 7 {
+		t.Errorf("Expected 7 nodes, but got %d", len(doc.Nodes))
+	}
+	if liba := nodes["liba.dylib"]; liba.InstallName != "@rpath/liba.dylib" || len(liba.UUIDs) != 1 ||
+		!reflect.DeepEqual(liba.Version, &GraphVersions{Compatibility: "1.0.0", Current: "1.2.3"}) {
+		t.Errorf("Unexpected node %+v", liba)
+	}
+	if missing := nodes["libmissing.dylib"]; !missing.Unresolved || missing.RealPath != "@rpath/libmissing.dylib" {
+		t.Errorf("Expected libmissing.dylib to be unresolved, but got %+v", missing)
+	}
+
+	var weak, ignored, libc int
+	for _, edge := range doc.Edges {
+		if edge.Weak {
+			weak++
+		}
+		if edge.Ignored && edge.IgnoredBy == "ignore-file:libSystem.B.dylib" {
+			ignored++
+		}
+		if edge.To == nodes["libc.dylib"].ID {
+			libc++
+		}
+	}
+	if len(doc.Edges) != 8 || weak != 1 || ignored != 1 || libc != 3 {
+		t.Errorf("Expected 8 edges, 1 weak, 1 ignored and 3 to libc, but got %d, %d, %d and %d", len(doc.Edges), weak, ignored, libc)
+	}
+}
+
+func TestDepsLoadJSONVersions(t *testing.T) {
+	graph := readTestSchemaGraph(t)
+	expectedDoc := writeTestDocument(t, graph)
+	expectedTree := writeTestTree(t, graph)
+
+	legacy, err := json.Marshal(DepsGetJSONSerialisableVersion(graph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{"version 1": string(legacy), "version 2": expectedDoc} {
+		readGraph, err := DepsLoadJSON(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if doc := writeTestDocument(t, readGraph); doc != expectedDoc {
+			t.Errorf("%s: Expected the document:\n%s\nBut got:\n%s", name, expectedDoc, doc)
+		}
+		if tree := writeTestTree(t, readGraph); tree != expectedTree {
+			t.Errorf("%s: Expected the tree:\n%s\nBut got:\n%s", name, expectedTree, tree)
+		}
+	}
+}
+
+// countShared returns the number of distinct dependencies and lists of
+// dependencies in the graph, which are shared between references.
+func countShared(graph *DependencyGraph) (int, int) {
+	deps := make(map[*Dependency]bool)
+	lists := make(map[*[]*Dependency]bool)
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		if deps[dep] {
+			return
+		}
+		deps[dep] = true
+		if dep.Deps != nil {
+			lists[dep.Deps] = true
+			for _, subDep := range *dep.Deps {
+				walk(subDep)
+			}
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		walk(topDep)
+	}
+	return len(deps), len(lists)
+}
+
+// writeTestOutputs writes the graph with every printer and analysis.
+func writeTestOutputs(t *testing.T, graph *DependencyGraph) map[string]string {
+	outputs := map[string]string{"tree": writeTestTree(t, graph)}
+	var out bytes.Buffer
+	write := func(name string, err error) {
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		outputs[name] = out.String()
+		out.Reset()
+	}
+
+	write("dot", DepsWriteDot(&out, graph, DotOptions{}))
+	write("report", DepsWriteHTMLReport(&out, graph, ReportOptions{Timestamp: time.Unix(1, 0)}))
+	write("cyclonedx", DepsWriteCycloneDX(&out, graph, SBOMOptions{Timestamp: time.Unix(1, 0)}))
+	write("spdx", DepsWriteSPDX(&out, graph, SBOMOptions{Timestamp: time.Unix(1, 0)}))
+	write("otool", DepsWriteOtool(&out, graph, OtoolOptions{}))
+	write("json", DepsWriteJSON(&out, graph, JSONOptions{}))
+	for name, value := range map[string]interface{}{
+		"why":        DepsWhy(graph, "libc.dylib", WhyOptions{}),
+		"duplicates": DepsDuplicates(graph),
+		"groups":     groupByPackage(graph.TopDeps[0]),
+	} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[name] = string(data)
+	}
+	return outputs
+}
+
+func TestDepsLoadJSON(t *testing.T) {
+	graph := readTestSchemaGraph(t)
+	expectedOutputs := writeTestOutputs(t, graph)
+	expectedDeps, expectedLists := countShared(graph)
+
+	legacy, err := json.Marshal(DepsGetJSONSerialisableVersion(graph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bytes.Buffer
+	if err := DepsWriteJSON(&doc, graph, JSONOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"version 1": legacy, "version 2": doc.Bytes()} {
+		loaded, err := DepsLoadJSON(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(loaded.TopDeps, graph.TopDeps) || !reflect.DeepEqual(loaded.FlatDeps, graph.FlatDeps) ||
+			!reflect.DeepEqual(loaded.Diagnostics, graph.Diagnostics) {
+			t.Errorf("%s: Expected the loaded graph to be the same as the one read", name)
+		}
+		if deps, lists := countShared(loaded); deps != expectedDeps || lists != expectedLists {
+			t.Errorf("%s: Expected %d dependencies sharing %d lists, but got %d sharing %d",
+				name, expectedDeps, expectedLists, deps, lists)
+		}
+		for output, expected := range writeTestOutputs(t, loaded) {
+			if expected != expectedOutputs[output] {
+				t.Errorf("%s: Expected the %s output:\n%s\nBut got:\n%s", name, output, expectedOutputs[output], expected)
+			}
+		}
+		if diff := DepsDiff(graph, loaded); !diff.Empty() {
+			t.Errorf("%s: Expected no differences, but got %+v", name, diff)
+		}
+	}
+}
+
+type unmarshalJSONErrorTest struct {
+	data     string
+	expected string
+}
+
+func TestDepsLoadJSONErrors(t *testing.T) {
+	testcases := []unmarshalJSONErrorTest{
+		{`{"schemaVersion": 3}`, "unsupported schema version 3"},
+		{`{}`, "not a dependency graph"},
+		{`[]`, "cannot unmarshal"},
+		{`{"schemaVersion": 2, "roots": [1], "nodes": [{"id": 0}]}`, "root 1 does not exist"},
+		{`{"schemaVersion": 2, "roots": [0], "nodes": [{"id": 1}]}`, "node 0 has id 1"},
+		{`{"schemaVersion": 2, "nodes": [{"id": 0}], "edges": [{"from": 0, "to": 2}]}`, "does not exist"},
+	}
+
+	for _, testcase := range testcases {
+		if _, err := DepsLoadJSON(strings.NewReader(testcase.data)); err == nil || !strings.Contains(err.Error(), testcase.expected) {
+			t.Errorf("Expected an error containing %q for %s, but got %v", testcase.expected, testcase.data, err)
+		}
+	}
+}
+
+// schemaProperties returns the properties of an object in the JSON Schema.
+func schemaProperties(t *testing.T, schema map[string]interface{}, def string) map[string]interface{} {
+	if def != "" {
+		schema = schema["$defs"].(map[string]interface{})[def].(map[string]interface{})
+	}
+	return schema["properties"].(map[string]interface{})
+}
+
+func TestJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(JSONSchema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	version := schemaProperties(t, schema, "")["schemaVersion"].(map[string]interface{})["const"]
+	if version != float64(SchemaVersion) {
+		t.Errorf("Expected the schema to be for version %d, but got %v", SchemaVersion, version)
+	}
+
+	// Every field that may be written must be described by the schema
+	types := map[string]reflect.Type{
+		"":           reflect.TypeOf(GraphDocument{}),
+		"node":       reflect.TypeOf(GraphNode{}),
+		"edge":       reflect.TypeOf(GraphEdge{}),
+		"diagnostic": reflect.TypeOf(GraphDiagnostic{}),
+		"versions":   reflect.TypeOf(GraphVersions{}),
+	}
+	for def, typ := range types {
+		properties := schemaProperties(t, schema, def)
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			if _, ok := properties[name]; !ok {
+				t.Errorf("Expected the schema to describe %s.%s", typ.Name(), name)
+			}
+		}
+	}
+}
+
+type parseVersionInfoTest struct {
+	info     string
+	expected *GraphVersions
+}
+
+func TestParseVersionInfo(t *testing.T) {
+	testcases := []parseVersionInfoTest{
+		{"compatibility version 1.0.0, current version 1.2.3", &GraphVersions{Compatibility: "1.0.0", Current: "1.2.3"}},
+		{"compatibility version 0.0.0, current version 1238.60.2", &GraphVersions{Compatibility: "0.0.0", Current: "1238.60.2"}},
+		{"1.0", nil},
+		{"", nil},
+	}
+
+	for _, testcase := range testcases {
+		actual := parseVersionInfo(testcase.info)
+		if !reflect.DeepEqual(actual, testcase.expected) {
+			t.Errorf("Expected %+v for %q, but got %+v", testcase.expected, testcase.info, actual)
+		} else if actual != nil && actual.String() != testcase.info {
+			t.Errorf("Expected %q to be formatted as itself, but got %q", testcase.info, actual.String())
+		}
+	}
+}
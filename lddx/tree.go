@@ -0,0 +1,149 @@
+package lddx
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// TreeOptions specifies how the dependency graph is rendered as a tree.
+type TreeOptions struct {
+	ASCII      bool // Use ASCII connectors instead of Unicode box-drawing characters
+	MaxDepth   int  // The maximum depth of the dependencies to render, or 0 for unlimited
+	HidePruned bool // Hide the pruned (ignored) libraries, such as the system libraries
+	NoColor    bool // Do not colour the weak, unresolved and ignored libraries
+}
+
+// treeConnectors are the strings used to draw the branches of a tree.
+type treeConnectors struct {
+	branch string // Connects a library that has further siblings below it
+	last   string // Connects the last library of its parent
+	pipe   string // Continues the branch of an ancestor that has further siblings
+	space  string // Indents below an ancestor that was the last of its parent
+}
+
+var (
+	unicodeConnectors = treeConnectors{branch: "├── ", last: "└── ", pipe: "│   ", space: "    "}
+	asciiConnectors   = treeConnectors{branch: "|-- ", last: "`-- ", pipe: "|   ", space: "    "}
+)
+
+// treeColors are the colours used to render the different kinds of libraries.
+type treeColors struct {
+	topLevel   *color.Color
+	weak       *color.Color
+	unresolved *color.Color
+	pruned     *color.Color
+	seeAbove   *color.Color
+}
+
+func newTreeColors(noColor bool) *treeColors {
+	ret := &treeColors{
+		topLevel:   color.New(color.Bold),
+		weak:       color.New(color.FgCyan),
+		unresolved: color.New(color.FgRed),
+		pruned:     color.New(color.FgHiBlack),
+		seeAbove:   color.New(color.Faint),
+	}
+	if noColor {
+		for _, c := range []*color.Color{ret.topLevel, ret.weak, ret.unresolved, ret.pruned, ret.seeAbove} {
+			c.DisableColor()
+		}
+	}
+	return ret
+}
+
+// forDep returns the colour of a library that is not a top-level file.
+func (c *treeColors) forDep(dep *Dependency) *color.Color {
+	switch {
+	case dep.NotResolved:
+		return c.unresolved
+	case dep.Pruned:
+		return c.pruned
+	case dep.IsWeakDep:
+		return c.weak
+	}
+	return nil
+}
+
+// treeLabel returns how a library is shown in the tree, like DepsPrettyPrint.
+func treeLabel(dep *Dependency) string {
+	if dep.Path != dep.RealPath {
+		return fmt.Sprintf("%s => %s (%s)", dep.Name, dep.Path, dep.RealPath)
+	}
+	return fmt.Sprintf("%s => %s", dep.Name, dep.Path)
+}
+
+// DepsWriteTree writes the dependency graph as a tree drawn with connectors.
+// Weak, unresolved and ignored libraries are marked, and coloured unless
+// disabled. The dependencies of a library are only listed the first time it
+// is shown, and its later occurrences are marked with (see above).
+// This also works for graphs read from JSON.
+func DepsWriteTree(w io.Writer, graph *DependencyGraph, opts TreeOptions) error {
+	connectors := unicodeConnectors
+	if opts.ASCII {
+		connectors = asciiConnectors
+	}
+	colors := newTreeColors(opts.NoColor)
+	directDeps := graphDirectDeps(graph)
+	expanded := make(map[string]bool)
+	var out strings.Builder
+
+	visible := func(deps []*Dependency) []*Dependency {
+		if !opts.HidePruned {
+			return deps
+		}
+		var ret []*Dependency
+		for _, dep := range deps {
+			if !dep.Pruned || dep.NotResolved {
+				ret = append(ret, dep)
+			}
+		}
+		return ret
+	}
+
+	var write func(dep *Dependency, prefix string, depth int)
+	write = func(dep *Dependency, prefix string, depth int) {
+		subDeps := visible(directDeps[dep.RealPath])
+		for i, subDep := range subDeps {
+			connector, indent := connectors.branch, connectors.pipe
+			if i == len(subDeps)-1 {
+				connector, indent = connectors.last, connectors.space
+			}
+
+			label := treeLabel(subDep)
+			if note := reportNote(subDep); note != "" {
+				label += " [" + note + "]"
+			}
+			if c := colors.forDep(subDep); c != nil {
+				label = c.Sprint(label)
+			}
+			out.WriteString(prefix + connector + label)
+
+			children := visible(directDeps[subDep.RealPath])
+			switch {
+			case len(children) == 0:
+			case expanded[subDep.RealPath]:
+				out.WriteString(" " + colors.seeAbove.Sprint("(see above)"))
+			case opts.MaxDepth > 0 && depth+1 >= opts.MaxDepth:
+				out.WriteString(" " + colors.seeAbove.Sprintf("(%d more)", len(children)))
+			default:
+				expanded[subDep.RealPath] = true
+				out.WriteString("\n")
+				write(subDep, prefix+indent, depth+1)
+				continue
+			}
+			out.WriteString("\n")
+		}
+	}
+
+	for _, topDep := range graph.TopDeps {
+		out.WriteString(colors.topLevel.Sprint(topDep.Path) + "\n")
+		expanded[topDep.RealPath] = true
+		write(topDep, "", 0)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,101 @@
+package lddx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+type depsWriteTreeTest struct {
+	opts     TreeOptions
+	expected string
+}
+
+func newTestTreeGraph() *DependencyGraph {
+	libz := &Dependency{Name: "libz.dylib", Path: "@rpath/libz.dylib", RealPath: "/opt/lib/libz.dylib", Deps: &[]*Dependency{}}
+	libc := &Dependency{Name: "libc.dylib", Path: "@rpath/libc.dylib", RealPath: "/opt/lib/libc.dylib", Deps: &[]*Dependency{libz}}
+	liba := &Dependency{Name: "liba.dylib", Path: "@rpath/liba.dylib", RealPath: "/opt/lib/liba.dylib", Deps: &[]*Dependency{libc}}
+	libb := &Dependency{Name: "libb.dylib", Path: "@rpath/libb.dylib", RealPath: "/opt/lib/libb.dylib", Deps: &[]*Dependency{libc}}
+	graph := newTestGraph(
+		&Dependency{Name: "main", Path: "main", RealPath: "/app/main"},
+		liba,
+		libb,
+		&Dependency{Name: "libweak.dylib", Path: "/opt/lib/libweak.dylib", RealPath: "/opt/lib/libweak.dylib", IsWeakDep: true, Deps: &[]*Dependency{}},
+		&Dependency{Name: "libSystem.B.dylib", Path: "/usr/lib/libSystem.B.dylib", RealPath: "/usr/lib/libSystem.B.dylib", Pruned: true, PrunedBy: "ignore-prefix:/usr/lib"},
+		&Dependency{Name: "libmissing.dylib", Path: "@rpath/libmissing.dylib", RealPath: "@rpath/libmissing.dylib", NotResolved: true},
+	)
+	graph.FlatDeps[libc.RealPath] = libc
+	graph.FlatDeps[libz.RealPath] = libz
+	return graph
+}
+
+func TestDepsWriteTree(t *testing.T) {
+	testcases := []depsWriteTreeTest{
+		{
+			opts: TreeOptions{NoColor: true},
+			expected: `main
+├── liba.dylib => @rpath/liba.dylib (/opt/lib/liba.dylib)
+│   └── libc.dylib => @rpath/libc.dylib (/opt/lib/libc.dylib)
+│       └── libz.dylib => @rpath/libz.dylib (/opt/lib/libz.dylib)
+├── libb.dylib => @rpath/libb.dylib (/opt/lib/libb.dylib)
+│   └── libc.dylib => @rpath/libc.dylib (/opt/lib/libc.dylib) (see above)
+├── libweak.dylib => /opt/lib/libweak.dylib [weak]
+├── libSystem.B.dylib => /usr/lib/libSystem.B.dylib [ignored by ignore-prefix:/usr/lib]
+└── libmissing.dylib => @rpath/libmissing.dylib [not resolved]
+`,
+		},
+		{
+			opts: TreeOptions{ASCII: true, MaxDepth: 1, HidePruned: true, NoColor: true},
+			expected: `main
+|-- liba.dylib => @rpath/liba.dylib (/opt/lib/liba.dylib) (1 more)
+|-- libb.dylib => @rpath/libb.dylib (/opt/lib/libb.dylib) (1 more)
+|-- libweak.dylib => /opt/lib/libweak.dylib [weak]
+` + "`-- " + `libmissing.dylib => @rpath/libmissing.dylib [not resolved]
+`,
+		},
+		{
+			opts: TreeOptions{ASCII: true, MaxDepth: 2, NoColor: true},
+			expected: `main
+|-- liba.dylib => @rpath/liba.dylib (/opt/lib/liba.dylib)
+|   ` + "`-- " + `libc.dylib => @rpath/libc.dylib (/opt/lib/libc.dylib) (1 more)
+|-- libb.dylib => @rpath/libb.dylib (/opt/lib/libb.dylib)
+|   ` + "`-- " + `libc.dylib => @rpath/libc.dylib (/opt/lib/libc.dylib) (1 more)
+|-- libweak.dylib => /opt/lib/libweak.dylib [weak]
+|-- libSystem.B.dylib => /usr/lib/libSystem.B.dylib [ignored by ignore-prefix:/usr/lib]
+` + "`-- " + `libmissing.dylib => @rpath/libmissing.dylib [not resolved]
+`,
+		},
+	}
+
+	for i, test := range testcases {
+		var out strings.Builder
+		if err := DepsWriteTree(&out, newTestTreeGraph(), test.opts); err != nil {
+			t.Fatal(err)
+		} else if out.String() != test.expected {
+			t.Errorf("Test %d: Expected:\n%s\nGot:\n%s", i, test.expected, out.String())
+		}
+	}
+}
+
+func TestDepsWriteTreeColors(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+
+	var out strings.Builder
+	if err := DepsWriteTree(&out, newTestTreeGraph(), TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"\x1b[31mlibmissing.dylib => @rpath/libmissing.dylib [not resolved]\x1b[0m",
+		"\x1b[36mlibweak.dylib => /opt/lib/libweak.dylib [weak]\x1b[0m",
+		"\x1b[90mlibSystem.B.dylib => /usr/lib/libSystem.B.dylib [ignored by ignore-prefix:/usr/lib]\x1b[0m",
+	}
+	for _, s := range expected {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q in:\n%s", s, out.String())
+		}
+	}
+}
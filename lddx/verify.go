@@ -0,0 +1,381 @@
+package lddx
+
+import (
+	"context"
+	"debug/macho"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VerifyIssueKind indicates why a load command prevents a bundle from being relocated.
+type VerifyIssueKind string
+
+// The kinds of issues found by VerifyBundle.
+const (
+	VerifyAbsolutePath  VerifyIssueKind = "absolute-path"  // The load command refers to an absolute path that is not a system library
+	VerifyAbsoluteRPath VerifyIssueKind = "absolute-rpath" // The LC_RPATH entry is an absolute path that is not a system folder
+	VerifyEscapingRPath VerifyIssueKind = "escaping-rpath" // The @rpath reference resolves to a library outside the bundle
+	VerifyEscapingPath  VerifyIssueKind = "escaping-path"  // The @loader_path or @executable_path reference resolves to a library outside the bundle
+	VerifyUnresolved    VerifyIssueKind = "unresolved"     // The library could not be found
+)
+
+// VerifyOptions specifies how the libraries of a bundle are resolved.
+type VerifyOptions struct {
+	// SystemLibraries are the install names of the system libraries that may
+	// be loaded, or the prefixes of their paths if they end with a slash. If
+	// nil, any library in the system paths (e.g. /usr/lib/) may be loaded.
+	SystemLibraries []string
+	ExecutablePath  string // The folder to use for @executable_path, if the file is not loaded by an executable in the bundle, instead of that of the main executable
+	Logger          Logger // The logger to use, or the default logger if nil
+}
+
+// VerifyIssue describes a load command that prevents a bundle from being
+// relocated, as it loads a library from outside the bundle or not at all.
+type VerifyIssue struct {
+	Kind     VerifyIssueKind // Why the load command is an issue
+	File     string          // The file with the load command, relative to the bundle
+	Path     string          // The path to the library (or the rpath), as specified by the load command
+	RealPath string          // The real path that the library (or the rpath) resolved to, if it was found
+	Weak     bool            // Indicates if this is a weak load command
+	Message  string          // A description of the issue
+}
+
+// String formats the issue for printing.
+func (i VerifyIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Kind, i.File, i.Message)
+}
+
+// bundleVerifier simulates how dyld resolves the libraries of a bundle.
+type bundleVerifier struct {
+	ctx     context.Context         // The context, which stops the checks once cancelled
+	bundle  string                  // The real path to the bundle
+	opts    *VerifyOptions          // The options to use
+	infos   map[string]*LoadInfo    // The load information of each file that has been read
+	types   map[string]macho.Type   // The file type of each file that has been read
+	visited map[string]bool         // The combinations of file, executable path and rpaths that were checked
+	issues  map[string]*VerifyIssue // The issues found, by kind, file and path
+	loaded  map[string]bool         // The files in the bundle that were loaded by another file
+}
+
+// isSystemLibrary checks if the absolute path may be loaded from the system.
+// The system libraries need not exist, as they may be in the dyld shared cache.
+func (v *bundleVerifier) isSystemLibrary(path string) bool {
+	prefixes := systemPrefixes
+	if v.opts.SystemLibraries != nil {
+		prefixes = v.opts.SystemLibraries
+	}
+	for _, prefix := range prefixes {
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// inBundle checks if the real path is inside the bundle.
+func (v *bundleVerifier) inBundle(realPath string) bool {
+	return strings.HasPrefix(realPath, v.bundle+string(filepath.Separator))
+}
+
+// relPath returns the path relative to the bundle, if it is inside it.
+func (v *bundleVerifier) relPath(path string) string {
+	if rel, err := filepath.Rel(v.bundle, path); err == nil && v.inBundle(path) {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+func (v *bundleVerifier) addIssue(kind VerifyIssueKind, file string, lib *Dylib, realPath, format string, args ...interface{}) {
+	issue := &VerifyIssue{
+		Kind:     kind,
+		File:     v.relPath(file),
+		Path:     lib.Path,
+		RealPath: realPath,
+		Weak:     lib.Weak,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	key := string(kind) + "\x00" + issue.File + "\x00" + issue.Path
+	if _, ok := v.issues[key]; !ok {
+		v.opts.Logger.Note("%s", issue)
+		v.issues[key] = issue
+	}
+}
+
+// loadInfo reads the load information and the file type of the file.
+func (v *bundleVerifier) loadInfo(file string) (*LoadInfo, error) {
+	if info, ok := v.infos[file]; ok {
+		return info, nil
+	}
+	arches, _, err := readFileLoadCommands(file)
+	if err != nil {
+		return nil, err
+	}
+	info := &LoadInfo{}
+	for _, arch := range arches {
+		if err := arch.readLoadInfo(info); err != nil {
+			return nil, err
+		}
+	}
+	v.infos[file] = info
+	v.types[file] = arches[0].FileType
+	return info, nil
+}
+
+// expandPath replaces the @loader_path or @executable_path prefix of the path.
+// It returns false if the path has any other prefix, or if there is no executable path.
+func expandPath(path, loaderDir, executableDir string) (string, bool) {
+	if path == "@loader_path" || strings.HasPrefix(path, "@loader_path/") {
+		return loaderDir + path[len("@loader_path"):], true
+	} else if (path == "@executable_path" || strings.HasPrefix(path, "@executable_path/")) && executableDir != "" {
+		return executableDir + path[len("@executable_path"):], true
+	}
+	return path, !IsSpecialPath(path)
+}
+
+// resolve returns the real path of the library, or false if it does not exist.
+func resolve(path string) (string, bool) {
+	realPath, err := ResolveAbsPath(path)
+	if err != nil {
+		return path, false
+	}
+	return realPath, true
+}
+
+// check checks the load commands of the file, and then those of the libraries
+// in the bundle that it loads. The rpaths are those of the files that loaded it,
+// with @loader_path and @executable_path already expanded, nearest first.
+func (v *bundleVerifier) check(file, executableDir string, rpaths []string) {
+	key := file + "\x00" + executableDir + "\x00" + strings.Join(rpaths, "\x00")
+	if v.visited[key] || v.ctx.Err() != nil {
+		return
+	}
+	v.visited[key] = true
+
+	info, err := v.loadInfo(file)
+	if err != nil {
+		v.opts.Logger.Warn("Could not get libs for %s: %s", file, err)
+		return
+	}
+
+	// As in dyld, the rpaths of the file itself are searched first
+	var fileRPaths []string
+	for _, rpath := range info.RPaths {
+		if filepath.IsAbs(rpath) && !v.isSystemLibrary(filepath.Clean(rpath)+"/") {
+			realPath, ok := resolve(rpath)
+			if !ok {
+				realPath = ""
+			}
+			v.addIssue(VerifyAbsoluteRPath, file, &Dylib{Path: rpath}, realPath, "The rpath %s is an absolute path outside the system libraries", rpath)
+		}
+		if expanded, ok := expandPath(rpath, filepath.Dir(file), executableDir); ok {
+			fileRPaths = append(fileRPaths, expanded)
+		} else {
+			v.opts.Logger.Warn("%s: Could not expand the rpath %s", file, rpath)
+		}
+	}
+	rpaths = append(fileRPaths, rpaths...)
+
+	seen := make(map[string]bool)
+	for _, lib := range info.Dylibs {
+		// A fat file lists the libraries once per architecture
+		if seen[lib.Path] {
+			continue
+		}
+		seen[lib.Path] = true
+
+		if realPath, ok := v.resolveLib(file, &lib, executableDir, rpaths); ok {
+			v.loaded[realPath] = true
+			v.check(realPath, executableDir, rpaths)
+		}
+	}
+}
+
+// resolveLib resolves the library loaded by the file, reporting any issue.
+// It returns the real path of the library if it is inside the bundle.
+func (v *bundleVerifier) resolveLib(file string, lib *Dylib, executableDir string, rpaths []string) (string, bool) {
+	if filepath.IsAbs(lib.Path) {
+		if !v.isSystemLibrary(lib.Path) {
+			realPath, ok := resolve(lib.Path)
+			if !ok {
+				realPath = ""
+			}
+			v.addIssue(VerifyAbsolutePath, file, lib, realPath, "%s is an absolute path outside the system libraries", lib.Path)
+		}
+		return "", false
+	}
+
+	kind := VerifyEscapingPath
+	var candidates []string
+	if strings.HasPrefix(lib.Path, "@rpath/") {
+		kind = VerifyEscapingRPath
+		for _, rpath := range rpaths {
+			candidates = append(candidates, rpath+lib.Path[len("@rpath"):])
+		}
+	} else if path, ok := expandPath(lib.Path, filepath.Dir(file), executableDir); ok {
+		candidates = append(candidates, path)
+	} else if strings.HasPrefix(lib.Path, "@executable_path/") {
+		if !lib.Weak {
+			v.addIssue(VerifyUnresolved, file, lib, "", "%s: No executable path set", lib.Path)
+		}
+		return "", false
+	}
+
+	// The first candidate that exists is loaded, as by dyld
+	for _, candidate := range candidates {
+		candidate = filepath.Clean(candidate)
+		if filepath.IsAbs(candidate) && v.isSystemLibrary(candidate) {
+			return "", false
+		} else if realPath, ok := resolve(candidate); !ok {
+			continue
+		} else if !v.inBundle(realPath) {
+			v.addIssue(kind, file, lib, realPath, "%s resolves to %s, outside the bundle", lib.Path, realPath)
+			return "", false
+		} else {
+			return realPath, true
+		}
+	}
+
+	// dyld ignores the weak libraries that are missing
+	if !lib.Weak {
+		if kind == VerifyEscapingRPath {
+			v.addIssue(VerifyUnresolved, file, lib, "", "%s not found in the rpaths: %v", lib.Path, rpaths)
+		} else {
+			v.addIssue(VerifyUnresolved, file, lib, "", "%s not found", lib.Path)
+		}
+	}
+	return "", false
+}
+
+// mainExecutable returns the executable in Contents/MacOS of an app bundle, or
+// otherwise the first executable, whose folder is used for @executable_path by
+// the files that are not loaded by any executable.
+func (v *bundleVerifier) mainExecutable(executables []string) string {
+	for _, file := range executables {
+		if filepath.Dir(file) == filepath.Join(v.bundle, "Contents", "MacOS") {
+			return file
+		}
+	}
+	if len(executables) > 0 {
+		return executables[0]
+	}
+	return ""
+}
+
+// VerifyBundle checks that the bundle is self-contained, so that it can be
+// relocated. It simulates how dyld resolves the libraries loaded by each
+// executable in the bundle, and then those of the other Mach-O files that are
+// not loaded by any executable (e.g. plugins), which are loaded by the main
+// executable. Each load command that refers to an absolute path outside the
+// system libraries, that resolves to a library outside the bundle or that
+// cannot be resolved at all is returned as an issue, as is each absolute rpath.
+func VerifyBundle(bundle string, opts VerifyOptions) ([]VerifyIssue, error) {
+	return VerifyBundleContext(context.Background(), bundle, opts)
+}
+
+// VerifyBundleContext checks that the bundle is self-contained, as VerifyBundle
+// does, stopping once the context is cancelled.
+func VerifyBundleContext(ctx context.Context, bundle string, opts VerifyOptions) ([]VerifyIssue, error) {
+	opts.Logger = orDefaultLogger(opts.Logger)
+	realBundle, err := ResolveAbsPath(bundle)
+	if err != nil {
+		return nil, err
+	}
+	files, err := FindFatMachOFiles(realBundle)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &bundleVerifier{
+		ctx:     ctx,
+		bundle:  realBundle,
+		opts:    &opts,
+		infos:   make(map[string]*LoadInfo),
+		types:   make(map[string]macho.Type),
+		visited: make(map[string]bool),
+		issues:  make(map[string]*VerifyIssue),
+		loaded:  make(map[string]bool),
+	}
+
+	var executables, others []string
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		} else if realPath, ok := resolve(file); !ok {
+			continue
+		} else if _, err := v.loadInfo(realPath); err != nil {
+			v.opts.Logger.Warn("Could not get libs for %s: %s", file, err)
+		} else if v.types[realPath] == macho.TypeExec {
+			executables = append(executables, realPath)
+		} else {
+			others = append(others, realPath)
+		}
+	}
+
+	// An executable is always its own @executable_path
+	for _, file := range executables {
+		v.check(file, filepath.Dir(file), nil)
+	}
+
+	executableDir := opts.ExecutablePath
+	if main := v.mainExecutable(executables); executableDir == "" && main != "" {
+		executableDir = filepath.Dir(main)
+	}
+	for _, file := range others {
+		if !v.loaded[file] {
+			v.check(file, executableDir, nil)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]VerifyIssue, 0, len(v.issues))
+	for _, issue := range v.issues {
+		ret = append(ret, *issue)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].File != ret[j].File {
+			return ret[i].File < ret[j].File
+		} else if ret[i].Path != ret[j].Path {
+			return ret[i].Path < ret[j].Path
+		}
+		return ret[i].Kind < ret[j].Kind
+	})
+	return ret, nil
+}
+
+// VerifyPrettyPrint writes the results of VerifyBundle, grouped by file.
+func VerifyPrettyPrint(w io.Writer, issues []VerifyIssue) {
+	var file string
+	for _, issue := range issues {
+		if issue.File != file {
+			file = issue.File
+			fmt.Fprintf(w, "%s:\n", file)
+		}
+		if issue.Weak {
+			fmt.Fprintf(w, "    [%s] %s (weak)\n", issue.Kind, issue.Message)
+		} else {
+			fmt.Fprintf(w, "    [%s] %s\n", issue.Kind, issue.Message)
+		}
+	}
+}
+
+// ReadSystemLibraries reads a list of system libraries for VerifyOptions, with
+// one install name or prefix per line. Blank lines and comments (#) are skipped.
+func ReadSystemLibraries(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			ret = append(ret, line)
+		}
+	}
+	return ret, nil
+}
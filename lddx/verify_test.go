@@ -0,0 +1,149 @@
+package lddx
+
+import (
+	"context"
+	"debug/macho"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type verifyTest struct {
+	name     string
+	opts     VerifyOptions
+	expected []string
+}
+
+func TestVerifyBundle(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "MyApp.app")
+	frameworks := filepath.Join(bundle, "Contents", "Frameworks")
+
+	writeTestMachO(t, filepath.Join(bundle, "Contents", "MacOS", "app"), testMachO{
+		Dylibs: []string{"@rpath/liba.dylib", "@executable_path/../Frameworks/libb.dylib",
+			"/usr/lib/libSystem.B.dylib", "/opt/homebrew/lib/libz.1.dylib"},
+		Weak:   []string{"@rpath/liboptional.dylib"},
+		RPaths: []string{"@executable_path/../Frameworks"},
+	})
+	// libc is only found through the rpath of the executable that loads liba
+	writeTestMachO(t, filepath.Join(frameworks, "liba.dylib"), testMachO{
+		ID:     "@rpath/liba.dylib",
+		Dylibs: []string{"@rpath/libout.dylib", "@rpath/libc.dylib"},
+		RPaths: []string{filepath.Join(dir, "outside")},
+	})
+	writeTestMachO(t, filepath.Join(frameworks, "libb.dylib"), testMachO{
+		ID:     "@rpath/libb.dylib",
+		Dylibs: []string{"@loader_path/../../../outside/libout.dylib", "@loader_path/libc.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(frameworks, "libc.dylib"), testMachO{
+		ID:     "@rpath/libc.dylib",
+		Dylibs: []string{"@rpath/libd.dylib"},
+		RPaths: []string{"@loader_path"},
+	})
+	writeTestMachO(t, filepath.Join(frameworks, "libd.dylib"), testMachO{ID: "@rpath/libd.dylib"})
+	writeTestMachO(t, filepath.Join(frameworks, "libout.dylib"), testMachO{ID: "@rpath/libout.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "outside", "libout.dylib"), testMachO{ID: "@rpath/libout.dylib"})
+	// The plugin is not loaded by any executable in the bundle
+	writeTestMachO(t, filepath.Join(bundle, "Contents", "PlugIns", "plugin.dylib"), testMachO{
+		ID:     "@rpath/plugin.dylib",
+		Dylibs: []string{"@executable_path/../Frameworks/libc.dylib", "@rpath/libc.dylib"},
+	})
+	// The loadable bundle is loaded by the main executable, with its @executable_path
+	writeTestMachO(t, filepath.Join(bundle, "Contents", "PlugIns", "Filter.bundle", "Contents", "MacOS", "Filter"), testMachO{
+		Dylibs:   []string{"@executable_path/../Frameworks/libd.dylib"},
+		RPaths:   []string{"/opt/homebrew/lib"},
+		FileType: macho.TypeBundle,
+	})
+	if err := os.WriteFile(filepath.Join(bundle, "Contents", "Info.plist"), []byte("<plist/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := "Contents/PlugIns/Filter.bundle/Contents/MacOS/Filter"
+	common := []string{
+		"absolute-rpath Contents/Frameworks/liba.dylib " + filepath.Join(dir, "outside"),
+		"escaping-rpath Contents/Frameworks/liba.dylib @rpath/libout.dylib",
+		"escaping-path Contents/Frameworks/libb.dylib @loader_path/../../../outside/libout.dylib",
+	}
+	testcases := []verifyTest{
+		{"system paths", VerifyOptions{}, append(common,
+			"absolute-path Contents/MacOS/app /opt/homebrew/lib/libz.1.dylib",
+			"absolute-rpath "+filter+" /opt/homebrew/lib",
+			"unresolved Contents/PlugIns/plugin.dylib @rpath/libc.dylib",
+		)},
+		{"system libraries", VerifyOptions{SystemLibraries: []string{"/usr/lib/libc++.1.dylib", "/opt/homebrew/"}}, append(common,
+			"absolute-path Contents/MacOS/app /usr/lib/libSystem.B.dylib",
+			"unresolved Contents/PlugIns/plugin.dylib @rpath/libc.dylib",
+		)},
+		{"executable path", VerifyOptions{ExecutablePath: filepath.Join(dir, "elsewhere")}, append(common,
+			"absolute-path Contents/MacOS/app /opt/homebrew/lib/libz.1.dylib",
+			"absolute-rpath "+filter+" /opt/homebrew/lib",
+			"unresolved "+filter+" @executable_path/../Frameworks/libd.dylib",
+			"unresolved Contents/PlugIns/plugin.dylib @executable_path/../Frameworks/libc.dylib",
+			"unresolved Contents/PlugIns/plugin.dylib @rpath/libc.dylib",
+		)},
+	}
+
+	for _, testcase := range testcases {
+		issues, err := VerifyBundle(bundle, testcase.opts)
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		var actual []string
+		for _, issue := range issues {
+			actual = append(actual, strings.Join([]string{string(issue.Kind), issue.File, issue.Path}, " "))
+		}
+		if !reflect.DeepEqual(actual, testcase.expected) {
+			t.Errorf("%s: Expected the issues:\n%s\nBut got:\n%s", testcase.name,
+				strings.Join(testcase.expected, "\n"), strings.Join(actual, "\n"))
+		}
+	}
+
+	// Without the executable, liba is checked on its own and libc is not found
+	issues, err := VerifyBundle(frameworks, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unresolved []string
+	for _, issue := range issues {
+		if issue.Kind == VerifyUnresolved {
+			unresolved = append(unresolved, issue.Path)
+			if issue.RealPath != "" {
+				t.Errorf("Expected no real path for %s, but got %s", issue.Path, issue.RealPath)
+			}
+		} else if issue.Kind == VerifyAbsoluteRPath && issue.RealPath != filepath.Join(dir, "outside") {
+			t.Errorf("Expected the rpath %s to resolve to itself, but got %s", issue.Path, issue.RealPath)
+		} else if issue.Kind != VerifyAbsoluteRPath && issue.RealPath != filepath.Join(dir, "outside", "libout.dylib") {
+			t.Errorf("Expected %s to resolve outside the bundle, but got %s", issue.Path, issue.RealPath)
+		}
+	}
+	if len(issues) != 4 || !reflect.DeepEqual(unresolved, []string{"@rpath/libc.dylib"}) {
+		t.Errorf("Expected 4 issues, including the unresolved libc, but got %v", issues)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := VerifyBundleContext(ctx, bundle, VerifyOptions{}); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
+
+func TestReadSystemLibraries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "system.txt")
+	data := "# The libraries that ship with macOS\n/usr/lib/libSystem.B.dylib\n\n  /System/Library/Frameworks/  \n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	libs, err := ReadSystemLibraries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"/usr/lib/libSystem.B.dylib", "/System/Library/Frameworks/"}; !reflect.DeepEqual(libs, expected) {
+		t.Errorf("Expected %v, but got %v", expected, libs)
+	}
+}
@@ -0,0 +1,246 @@
+package lddx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchOptions specifies the options to be used while watching for changes.
+type WatchOptions struct {
+	Delay time.Duration // How long to wait for further changes before recalculating the graph
+}
+
+// WatchUpdate describes the dependency graph after a change.
+type WatchUpdate struct {
+	Graph   *DependencyGraph // The recalculated dependency graph
+	Diff    *GraphDiff       // The differences from the previous graph, or nil for the initial graph
+	Changed []string         // The files that changed, sorted by path
+}
+
+// watchSet contains the files and folders that are watched for a graph.
+type watchSet struct {
+	files   map[string]bool        // The real paths of the files that were read
+	readers map[string][]string    // The real paths of the files whose libraries may be found at each path
+	folders map[string]bool        // The folders that contain the files and paths
+	states  map[string]os.FileInfo // The state of each file and path when last recorded, or nil if it did not exist
+}
+
+// fileWatcher watches folders for changes, as fsnotify.Watcher does.
+type fileWatcher interface {
+	Add(name string) error
+	Remove(name string) error
+}
+
+// getWatchSet returns the files in the graph to be watched, along with the
+// paths at which their libraries were looked for, so that libraries that
+// could not be resolved before, or that resolve elsewhere (e.g. through an
+// earlier rpath), are noticed. The folders that contain them are watched
+// instead of the files themselves, so that files that are replaced (e.g. by a
+// linker) rather than modified are also noticed.
+func getWatchSet(graph *DependencyGraph) *watchSet {
+	ret := &watchSet{
+		files:   make(map[string]bool),
+		readers: make(map[string][]string),
+		folders: make(map[string]bool),
+	}
+
+	for realPath, read := range graph.reads {
+		ret.files[realPath] = true
+		ret.folders[filepath.Dir(realPath)] = true
+		for _, path := range read.paths {
+			ret.readers[path] = append(ret.readers[path], realPath)
+			ret.folders[filepath.Dir(path)] = true
+		}
+	}
+	return ret
+}
+
+// matches checks if a change to the path may affect the graph, i.e. if it is
+// a file that was read, or a path at which a library was looked for.
+func (w *watchSet) matches(path string) bool {
+	return w.files[path] || len(w.readers[path]) > 0
+}
+
+// record records the state of the files and paths, so that the changes
+// made until now are ignored, even if they are only reported later.
+func (w *watchSet) record() {
+	w.states = make(map[string]os.FileInfo)
+	add := func(path string) {
+		info, _ := os.Stat(path)
+		w.states[path] = info
+	}
+	for path := range w.files {
+		add(path)
+	}
+	for path := range w.readers {
+		add(path)
+	}
+}
+
+// changed checks if the path is no longer in the state that was recorded,
+// comparing its inode, size and modification time.
+func (w *watchSet) changed(path string) bool {
+	old, ok := w.states[path]
+	if !ok {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil || old == nil {
+		return (err != nil) != (old == nil)
+	}
+	return !os.SameFile(old, info) || old.Size() != info.Size() || !old.ModTime().Equal(info.ModTime())
+}
+
+// invalidated returns the real paths of the files whose reads are out of date
+// after the changes: the files that changed, and the files whose libraries
+// may now resolve differently, as a file was created, removed or renamed.
+func (w *watchSet) invalidated(changes map[string]fsnotify.Op) map[string]bool {
+	ret := make(map[string]bool)
+	for path, op := range changes {
+		if w.files[path] {
+			ret[path] = true
+		}
+		if op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+			for _, realPath := range w.readers[path] {
+				ret[realPath] = true
+			}
+		}
+	}
+	return ret
+}
+
+// update changes the watched folders to those of the new watch set.
+// Folders that do not exist are not watched.
+func (w *watchSet) update(watcher fileWatcher, old *watchSet, logger Logger) {
+	for folder := range w.folders {
+		if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+			delete(w.folders, folder)
+		} else if old == nil || !old.folders[folder] {
+			if err := watcher.Add(folder); err != nil {
+				logger.Warn("Could not watch %s: %s", folder, err)
+				delete(w.folders, folder)
+			}
+		}
+	}
+	if old != nil {
+		for folder := range old.folders {
+			if !w.folders[folder] {
+				watcher.Remove(folder)
+			}
+		}
+	}
+}
+
+// DepsWatch calculates the dependency graph for the list of files provided,
+// and recalculates it whenever the files or their dependencies change.
+// The callback is called with the initial graph, and then with each
+// recalculated graph and its differences from the previous one.
+//
+// Only the files that changed, and those whose libraries may now resolve
+// differently, are read again, along with any newly added dependencies.
+// What was read from the other files is reused, and OnRead is not called for
+// them. The information read from each file is also cached, and the cache
+// entries of the changed files are invalidated. If no cache is specified in
+// the options, an in-memory cache is used.
+//
+// Changes made while the callback is running (e.g. by collecting the
+// dependencies) are ignored, even if they are only reported after it
+// returns, as are those to files that are as they were then. Watching stops without error when the context
+// is cancelled, or with the error returned by the callback.
+func DepsWatch(ctx context.Context, opts DependencyOptions, watchOpts WatchOptions, files []string, callback func(*WatchUpdate) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	return depsWatch(ctx, opts, watchOpts, files, watcher, watcher.Events, watcher.Errors, callback)
+}
+
+// depsWatch implements DepsWatch, with the changes to the watched folders
+// received from the given channels.
+func depsWatch(ctx context.Context, opts DependencyOptions, watchOpts WatchOptions, files []string,
+	watcher fileWatcher, events <-chan fsnotify.Event, errors <-chan error, callback func(*WatchUpdate) error) error {
+	opts.Logger = orDefaultLogger(opts.Logger)
+	if opts.Cache == nil {
+		opts.Cache = NewMemoryCache()
+	}
+
+	graph, err := depsReadReusing(ctx, opts, map[string]*fileRead{}, files...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	watched := getWatchSet(graph)
+	watched.update(watcher, nil, opts.Logger)
+	if err := callback(&WatchUpdate{Graph: graph}); err != nil {
+		return err
+	}
+	watched.record()
+
+	changes := make(map[string]fsnotify.Op)
+	stale := make(map[string]bool) // The files to read again, until the graph is recalculated
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errors:
+			opts.Logger.Warn("Error while watching for changes: %s", err)
+		case event := <-events:
+			if watched.matches(event.Name) && watched.changed(event.Name) {
+				changes[event.Name] |= event.Op
+				timer = time.After(watchOpts.Delay)
+			}
+		case <-timer:
+			update := &WatchUpdate{}
+			for file := range changes {
+				opts.Cache.Invalidate(file)
+				update.Changed = append(update.Changed, file)
+			}
+			sort.Strings(update.Changed)
+
+			for realPath := range watched.invalidated(changes) {
+				stale[realPath] = true
+			}
+			reuse := make(map[string]*fileRead)
+			for realPath, read := range graph.reads {
+				if !stale[realPath] {
+					reuse[realPath] = read
+				}
+			}
+			changes = make(map[string]fsnotify.Op)
+			timer = nil
+
+			newGraph, err := depsReadReusing(ctx, opts, reuse, files...)
+			if ctx.Err() != nil {
+				return nil
+			} else if err != nil {
+				// The files may be in the middle of being rebuilt, so wait for the next change.
+				opts.Logger.Error("Could not process dependencies: %s", err)
+				continue
+			}
+
+			update.Graph = newGraph
+			update.Diff = DepsDiff(graph, newGraph)
+			graph = newGraph
+			stale = make(map[string]bool)
+
+			newWatched := getWatchSet(graph)
+			newWatched.update(watcher, watched, opts.Logger)
+			watched = newWatched
+
+			if err := callback(update); err != nil {
+				return err
+			}
+			watched.record()
+		}
+	}
+}
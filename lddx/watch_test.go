@@ -0,0 +1,228 @@
+package lddx
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// testWatcher records the folders being watched.
+type testWatcher struct {
+	folders map[string]bool
+}
+
+func (w *testWatcher) Add(name string) error {
+	w.folders[name] = true
+	return nil
+}
+
+func (w *testWatcher) Remove(name string) error {
+	delete(w.folders, name)
+	return nil
+}
+
+// testWatchUpdate is an update from DepsWatch, with the names of the files that were read for it.
+type testWatchUpdate struct {
+	*WatchUpdate
+	read []string
+}
+
+func TestDepsWatch(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main")
+	writeTestMachO(t, main, testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib", "@rpath/libc.dylib"},
+		RPaths: []string{"@loader_path/lib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{ID: "@rpath/liba.dylib"})
+	writeTestMachO(t, filepath.Join(dir, "lib", "libother.dylib"), testMachO{ID: "@rpath/libother.dylib"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var read []string
+	opts := DependencyOptions{Recursive: true, Jobs: 2, OnRead: func(dep *Dependency, topLevel bool) {
+		read = append(read, dep.Name)
+	}}
+	watcher := &testWatcher{folders: make(map[string]bool)}
+	events := make(chan fsnotify.Event)
+	updates := make(chan testWatchUpdate)
+	done := make(chan error)
+	go func() {
+		done <- depsWatch(ctx, opts, WatchOptions{}, []string{main}, watcher, events, nil, func(update *WatchUpdate) error {
+			sort.Strings(read)
+			updates <- testWatchUpdate{update, read}
+			read = nil
+			return nil
+		})
+	}()
+
+	nextUpdate := func(changes ...fsnotify.Event) testWatchUpdate {
+		t.Helper()
+		for _, event := range changes {
+			events <- event
+		}
+		select {
+		case update := <-updates:
+			return update
+		case err := <-done:
+			t.Fatalf("Watch stopped unexpectedly: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an update")
+		}
+		return testWatchUpdate{}
+	}
+
+	update := nextUpdate()
+	if update.Diff != nil {
+		t.Fatalf("Expected the initial graph but got a diff: %+v", update.Diff)
+	} else if !reflect.DeepEqual(update.read, []string{"liba.dylib", "main"}) {
+		t.Errorf("Expected main and liba.dylib to be read, but got %v", update.read)
+	}
+	// The rpath folder is watched for the library that could not be found there
+	if expected := map[string]bool{dir: true, filepath.Join(dir, "lib"): true}; !reflect.DeepEqual(watcher.folders, expected) {
+		t.Errorf("Expected the folders %v to be watched, but got %v", expected, watcher.folders)
+	}
+
+	testcases := []struct {
+		name    string
+		write   string
+		m       testMachO
+		event   fsnotify.Event
+		read    []string
+		diff    *GraphDiff
+		changed []string
+	}{
+		{
+			// Adding a dependency that does not exist yet is reported as unresolved
+			name:    "modified",
+			write:   "liba.dylib",
+			m:       testMachO{ID: "@rpath/liba.dylib", Dylibs: []string{"@loader_path/libb.dylib"}},
+			event:   fsnotify.Event{Name: filepath.Join(dir, "liba.dylib"), Op: fsnotify.Write},
+			read:    []string{"liba.dylib"},
+			diff:    newTestDiff(GraphDiff{Added: []string{"@loader_path/libb.dylib"}, NewlyUnresolved: []string{"@loader_path/libb.dylib"}}),
+			changed: []string{filepath.Join(dir, "liba.dylib")},
+		},
+		{
+			// Creating a library in the rpath folder only reads the file that loads it again
+			name:    "created in the rpath",
+			write:   filepath.Join("lib", "libc.dylib"),
+			m:       testMachO{ID: "@rpath/libc.dylib"},
+			event:   fsnotify.Event{Name: filepath.Join(dir, "lib", "libc.dylib"), Op: fsnotify.Create},
+			read:    []string{"libc.dylib", "main"},
+			diff:    newTestDiff(GraphDiff{}),
+			changed: []string{filepath.Join(dir, "lib", "libc.dylib")},
+		},
+		{
+			name:    "created next to the loader",
+			write:   "libb.dylib",
+			m:       testMachO{ID: "@rpath/libb.dylib"},
+			event:   fsnotify.Event{Name: filepath.Join(dir, "libb.dylib"), Op: fsnotify.Create},
+			read:    []string{"liba.dylib", "libb.dylib"},
+			diff:    newTestDiff(GraphDiff{}),
+			changed: []string{filepath.Join(dir, "libb.dylib")},
+		},
+	}
+
+	for _, testcase := range testcases {
+		writeTestMachO(t, filepath.Join(dir, testcase.write), testcase.m)
+		// Changes to files that are neither read nor looked for are ignored
+		unrelated := fsnotify.Event{Name: filepath.Join(dir, "lib", "libother.dylib"), Op: fsnotify.Write}
+		update := nextUpdate(unrelated, testcase.event)
+
+		if !reflect.DeepEqual(update.read, testcase.read) {
+			t.Errorf("%s: Expected %v to be read, but got %v", testcase.name, testcase.read, update.read)
+		}
+		if !reflect.DeepEqual(update.Changed, testcase.changed) {
+			t.Errorf("%s: Expected %v to have changed, but got %v", testcase.name, testcase.changed, update.Changed)
+		}
+		if !reflect.DeepEqual(update.Diff, testcase.diff) {
+			t.Errorf("%s: Expected diff %+v but got %+v", testcase.name, testcase.diff, update.Diff)
+		}
+		if _, ok := update.Graph.FlatDeps[filepath.Join(dir, testcase.write)]; !ok {
+			t.Errorf("%s: Expected %s to be resolved", testcase.name, testcase.write)
+		}
+
+		// The graph is the same as one that is read from scratch
+		graph, err := DepsRead(DependencyOptions{Recursive: true}, main)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := json.Marshal(DepsGetJSONSerialisableVersion(graph))
+		actual, _ := json.Marshal(DepsGetJSONSerialisableVersion(update.Graph))
+		if string(actual) != string(expected) {
+			t.Errorf("%s: Expected the graph\n%s\nbut got\n%s", testcase.name, expected, actual)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error after cancellation but got %v", err)
+	}
+}
+
+func TestDepsWatchIgnoresCallbackChanges(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main")
+	liba := filepath.Join(dir, "liba.dylib")
+	writeTestMachO(t, main, testMachO{Dylibs: []string{"@loader_path/liba.dylib"}})
+	writeTestMachO(t, liba, testMachO{ID: "@rpath/liba.dylib"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := &testWatcher{folders: make(map[string]bool)}
+	events := make(chan fsnotify.Event)
+	updates := make(chan *WatchUpdate, 10) // Buffered, so that any extra update is received
+	done := make(chan error)
+	go func() {
+		done <- depsWatch(ctx, DependencyOptions{Recursive: true}, WatchOptions{}, []string{main}, watcher, events, nil, func(update *WatchUpdate) error {
+			// Modify a watched file, as collecting the dependencies would
+			writeTestMachO(t, liba, testMachO{ID: "@rpath/liba.dylib"})
+			updates <- update
+			return nil
+		})
+	}()
+
+	nextUpdate := func() *WatchUpdate {
+		t.Helper()
+		select {
+		case update := <-updates:
+			return update
+		case err := <-done:
+			t.Fatalf("Watch stopped unexpectedly: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an update")
+		}
+		return nil
+	}
+
+	nextUpdate()
+	for i := 0; i < 3; i++ {
+		// The change made by the callback is only reported after it returns
+		events <- fsnotify.Event{Name: liba, Op: fsnotify.Write}
+		writeTestMachO(t, main, testMachO{Dylibs: []string{"@loader_path/liba.dylib"}})
+		events <- fsnotify.Event{Name: main, Op: fsnotify.Write}
+
+		if update := nextUpdate(); !reflect.DeepEqual(update.Changed, []string{main}) {
+			t.Errorf("Run %d: Expected only %s to have changed, but got %v", i, main, update.Changed)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error after cancellation but got %v", err)
+	}
+}
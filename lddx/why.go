@@ -0,0 +1,209 @@
+package lddx
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WhyMatch specifies which fields of a dependency are matched
+// against when searching for a library.
+type WhyMatch string
+
+// The fields that may be matched against.
+const (
+	WhyMatchAny         WhyMatch = "any"          // Match any of the fields below
+	WhyMatchName        WhyMatch = "name"         // Match the library name (e.g. libz.1.dylib)
+	WhyMatchInstallName WhyMatch = "install-name" // Match the path in the load command (e.g. @rpath/libz.1.dylib)
+	WhyMatchRealPath    WhyMatch = "real-path"    // Match the resolved path (e.g. /usr/local/lib/libz.1.dylib)
+)
+
+// WhyOptions specifies the options used when searching for a library.
+type WhyOptions struct {
+	Match    WhyMatch // The fields to match against
+	MaxPaths int      // The maximum number of paths to report per library, or unlimited if <= 0
+}
+
+// WhyResult describes why a library is part of a dependency graph.
+type WhyResult struct {
+	Dependency *Dependency     // The matching library
+	Paths      [][]*Dependency // Every path from a top-level dependency to the library
+	Truncated  bool            // Indicates if there were more paths than the maximum
+	Dependents []*Dependency   // The libraries that directly depend on the library
+}
+
+// matchesPattern checks if the value equals the pattern, or matches it as a glob.
+func matchesPattern(pattern, value string) bool {
+	if pattern == value {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// whyMatches checks if the dependency matches the query.
+func whyMatches(dep *Dependency, query string, match WhyMatch) bool {
+	switch match {
+	case WhyMatchName:
+		return matchesPattern(query, dep.Name)
+	case WhyMatchInstallName:
+		return matchesPattern(query, dep.Path)
+	case WhyMatchRealPath:
+		return matchesPattern(query, dep.RealPath)
+	default:
+		return matchesPattern(query, dep.Name) || matchesPattern(query, dep.Path) || matchesPattern(query, dep.RealPath)
+	}
+}
+
+// DepsWhy finds every library in the graph that matches the query, and for
+// each one, determines every path from the top-level dependencies to it,
+// along with the libraries that directly depend on it. The query may either
+// be an exact value or a glob pattern (e.g. libicu*).
+func DepsWhy(graph *DependencyGraph, query string, opts WhyOptions) []*WhyResult {
+	results := make(map[string]*WhyResult)
+	dependents := make(map[string]map[string]*Dependency)
+	parents := make(map[string]map[string]*Dependency)
+	visited := make(map[string]bool)
+
+	// Find the matching libraries and the direct parents of every library.
+	var walk func(dep *Dependency)
+	walk = func(dep *Dependency) {
+		if visited[dep.RealPath] || dep.Deps == nil {
+			return
+		}
+		visited[dep.RealPath] = true
+
+		for _, subDep := range *dep.Deps {
+			if whyMatches(subDep, query, opts.Match) {
+				if _, ok := results[subDep.RealPath]; !ok {
+					results[subDep.RealPath] = &WhyResult{Dependency: subDep}
+					dependents[subDep.RealPath] = make(map[string]*Dependency)
+				}
+				dependents[subDep.RealPath][dep.RealPath] = dep
+			}
+			if parents[subDep.RealPath] == nil {
+				parents[subDep.RealPath] = make(map[string]*Dependency)
+			}
+			parents[subDep.RealPath][dep.RealPath] = dep
+			walk(subDep)
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		walk(topDep)
+	}
+
+	// Determine which libraries lead to each match, by walking the parents
+	// from its direct dependents, so that only the relevant subtrees are
+	// searched when enumerating paths.
+	ancestors := make(map[string]map[string]bool)
+	for realPath := range results {
+		found := make(map[string]bool)
+		var queue []string
+		for dependent := range dependents[realPath] {
+			found[dependent] = true
+			queue = append(queue, dependent)
+		}
+		for len(queue) > 0 {
+			for parent := range parents[queue[0]] {
+				if !found[parent] {
+					found[parent] = true
+					queue = append(queue, parent)
+				}
+			}
+			queue = queue[1:]
+		}
+		ancestors[realPath] = found
+	}
+
+	// pending checks if the library leads to a match that may have more paths.
+	// Once a match has the maximum number of paths, and is marked as truncated,
+	// there is no need to search for more paths to it.
+	pending := func(dep *Dependency) bool {
+		for realPath, found := range ancestors {
+			if found[dep.RealPath] && !(opts.MaxPaths > 0 && results[realPath].Truncated) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Enumerate the paths from each top-level dependency to the matches.
+	onPath := make(map[string]bool)
+	var stack []*Dependency
+	var findPaths func(dep *Dependency)
+	findPaths = func(dep *Dependency) {
+		if dep.Deps == nil || onPath[dep.RealPath] {
+			return
+		}
+		onPath[dep.RealPath] = true
+		defer delete(onPath, dep.RealPath)
+
+		for _, subDep := range *dep.Deps {
+			stack = append(stack, subDep)
+			if whyMatches(subDep, query, opts.Match) {
+				result := results[subDep.RealPath]
+				if opts.MaxPaths > 0 && len(result.Paths) >= opts.MaxPaths {
+					result.Truncated = true
+				} else {
+					result.Paths = append(result.Paths, append([]*Dependency(nil), stack...))
+				}
+			}
+			if pending(subDep) {
+				findPaths(subDep)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	for _, topDep := range graph.TopDeps {
+		if pending(topDep) {
+			stack = []*Dependency{topDep}
+			findPaths(topDep)
+		}
+	}
+
+	ret := make([]*WhyResult, 0, len(results))
+	for realPath, result := range results {
+		for _, dep := range dependents[realPath] {
+			result.Dependents = append(result.Dependents, dep)
+		}
+		sort.Slice(result.Dependents, func(i, j int) bool {
+			return result.Dependents[i].RealPath < result.Dependents[j].RealPath
+		})
+		ret = append(ret, result)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Dependency.RealPath < ret[j].Dependency.RealPath
+	})
+
+	return ret
+}
+
+// WhyPrettyPrint prints the results of DepsWhy.
+func WhyPrettyPrint(results []*WhyResult) {
+	for _, result := range results {
+		dep := result.Dependency
+		if dep.Path != dep.RealPath {
+			fmt.Printf("%s => %s (%s)\n", dep.Name, dep.Path, dep.RealPath)
+		} else {
+			fmt.Printf("%s => %s\n", dep.Name, dep.Path)
+		}
+
+		fmt.Printf("    Dependents:\n")
+		for _, parent := range result.Dependents {
+			fmt.Printf("        %s\n", parent.RealPath)
+		}
+
+		fmt.Printf("    Paths:\n")
+		for _, depPath := range result.Paths {
+			var names []string
+			for _, pathDep := range depPath {
+				names = append(names, pathDep.Path)
+			}
+			fmt.Printf("        %s\n", strings.Join(names, " -> "))
+		}
+		if result.Truncated {
+			fmt.Printf("        ...\n")
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package lddx
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDepsWhy(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib", "@loader_path/libb.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{
+		ID:     "@rpath/liba.dylib",
+		Dylibs: []string{"@rpath/libicuuc.70.dylib"},
+		RPaths: []string{"@loader_path"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "libb.dylib"), testMachO{
+		ID:     "@rpath/libb.dylib",
+		Dylibs: []string{"@loader_path/liba.dylib", "@loader_path/libicuuc.70.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "libicuuc.70.dylib"), testMachO{ID: "@rpath/libicuuc.70.dylib"})
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type whyTest struct {
+		query         string
+		match         WhyMatch
+		expectedPaths []string
+		expectedDeps  int
+	}
+	testcases := []whyTest{
+		{query: "libicu*", match: WhyMatchAny, expectedPaths: []string{
+			"main -> @loader_path/liba.dylib -> @rpath/libicuuc.70.dylib",
+			"main -> @loader_path/libb.dylib -> @loader_path/liba.dylib -> @rpath/libicuuc.70.dylib",
+			"main -> @loader_path/libb.dylib -> @loader_path/libicuuc.70.dylib",
+		}, expectedDeps: 2},
+		{query: "@rpath/libicuuc.70.dylib", match: WhyMatchInstallName, expectedPaths: []string{
+			"main -> @loader_path/liba.dylib -> @rpath/libicuuc.70.dylib",
+			"main -> @loader_path/libb.dylib -> @loader_path/liba.dylib -> @rpath/libicuuc.70.dylib",
+		}, expectedDeps: 1},
+		{query: filepath.Join(dir, "libicuuc.70.dylib"), match: WhyMatchRealPath, expectedPaths: []string{
+			"main -> @loader_path/liba.dylib -> @rpath/libicuuc.70.dylib",
+			"main -> @loader_path/libb.dylib -> @loader_path/liba.dylib -> @rpath/libicuuc.70.dylib",
+			"main -> @loader_path/libb.dylib -> @loader_path/libicuuc.70.dylib",
+		}, expectedDeps: 2},
+		{query: "libicuuc.70.dylib", match: WhyMatchInstallName},
+	}
+
+	for _, test := range testcases {
+		results := DepsWhy(graph, test.query, WhyOptions{Match: test.match})
+		if test.expectedPaths == nil {
+			if len(results) != 0 {
+				t.Errorf("Query %s: Expected no results but got %d", test.query, len(results))
+			}
+			continue
+		} else if len(results) != 1 {
+			t.Errorf("Query %s: Expected 1 result but got %d", test.query, len(results))
+			continue
+		}
+
+		var paths []string
+		for _, depPath := range results[0].Paths {
+			var names []string
+			for _, dep := range depPath {
+				names = append(names, dep.Path)
+			}
+			paths = append(paths, strings.TrimPrefix(strings.Join(names, " -> "), dir+"/"))
+		}
+
+		if strings.Join(paths, "\n") != strings.Join(test.expectedPaths, "\n") {
+			t.Errorf("Query %s: Expected paths\n%s\nbut got\n%s", test.query,
+				strings.Join(test.expectedPaths, "\n"), strings.Join(paths, "\n"))
+		}
+		if len(results[0].Dependents) != test.expectedDeps {
+			t.Errorf("Query %s: Expected %d dependents but got %d", test.query, test.expectedDeps, len(results[0].Dependents))
+		}
+	}
+}
+
+// whyPaths formats the paths of a result, relative to the folder.
+func whyPaths(result *WhyResult, dir string) []string {
+	var paths []string
+	for _, depPath := range result.Paths {
+		var names []string
+		for _, dep := range depPath {
+			names = append(names, dep.Path)
+		}
+		paths = append(paths, strings.TrimPrefix(strings.Join(names, " -> "), dir+"/"))
+	}
+	return paths
+}
+
+func TestDepsWhyCycle(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// libc only reaches libm through liba, which is on a cycle with it
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{
+		Dylibs: []string{"@loader_path/liba.dylib", "@loader_path/libc.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "liba.dylib"), testMachO{
+		ID:     "@rpath/liba.dylib",
+		Dylibs: []string{"@loader_path/libb.dylib", "@loader_path/libm.dylib"},
+	})
+	writeTestMachO(t, filepath.Join(dir, "libb.dylib"), testMachO{ID: "@rpath/libb.dylib", Dylibs: []string{"@loader_path/libc.dylib"}})
+	writeTestMachO(t, filepath.Join(dir, "libc.dylib"), testMachO{ID: "@rpath/libc.dylib", Dylibs: []string{"@loader_path/liba.dylib"}})
+	writeTestMachO(t, filepath.Join(dir, "libm.dylib"), testMachO{ID: "@rpath/libm.dylib"})
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := DepsWhy(graph, "libm.dylib", WhyOptions{})
+	expected := []string{
+		"main -> @loader_path/liba.dylib -> @loader_path/libm.dylib",
+		"main -> @loader_path/libc.dylib -> @loader_path/liba.dylib -> @loader_path/libm.dylib",
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result but got %d", len(results))
+	} else if paths := whyPaths(results[0], dir); strings.Join(paths, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected paths\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(paths, "\n"))
+	}
+}
+
+func TestDepsWhyMaxPaths(t *testing.T) {
+	dir, err := ResolveAbsPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A chain of diamonds, with 2^30 paths from main to the last library
+	const numLevels = 30
+	writeTestMachO(t, filepath.Join(dir, "main"), testMachO{Dylibs: []string{"@loader_path/lib0.dylib"}})
+	for i := 0; i < numLevels; i++ {
+		next := fmt.Sprintf("@loader_path/lib%d.dylib", i+1)
+		writeTestMachO(t, filepath.Join(dir, fmt.Sprintf("lib%d.dylib", i)), testMachO{
+			ID:     fmt.Sprintf("@rpath/lib%d.dylib", i),
+			Dylibs: []string{fmt.Sprintf("@loader_path/lib%dx.dylib", i), fmt.Sprintf("@loader_path/lib%dy.dylib", i)},
+		})
+		for _, side := range []string{"x", "y"} {
+			writeTestMachO(t, filepath.Join(dir, fmt.Sprintf("lib%d%s.dylib", i, side)), testMachO{
+				ID:     fmt.Sprintf("@rpath/lib%d%s.dylib", i, side),
+				Dylibs: []string{next},
+			})
+		}
+	}
+	writeTestMachO(t, filepath.Join(dir, fmt.Sprintf("lib%d.dylib", numLevels)), testMachO{ID: "@rpath/liblast.dylib"})
+
+	graph, err := DepsRead(DependencyOptions{Recursive: true}, filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := DepsWhy(graph, fmt.Sprintf("lib%d.dylib", numLevels), WhyOptions{MaxPaths: 3})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result but got %d", len(results))
+	} else if len(results[0].Paths) != 3 || !results[0].Truncated {
+		t.Errorf("Expected 3 paths and to be truncated, but got %d (truncated: %v)", len(results[0].Paths), results[0].Truncated)
+	}
+}
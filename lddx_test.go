@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+// writeTestGraph saves a graph of main, which loads two copies of libz
+// with the same install name, as JSON.
+func writeTestGraph(t *testing.T, path string) {
+	t.Helper()
+	deps := []*Dependency{
+		{Name: "libz.dylib", Path: "@rpath/libz.dylib", RealPath: "/build/lib/libz.dylib", ID: "@rpath/libz.dylib", Deps: new([]*Dependency)},
+		{Name: "libz.dylib", Path: "/usr/local/lib/libz.dylib", RealPath: "/usr/local/lib/libz.dylib", ID: "@rpath/libz.dylib", Deps: new([]*Dependency)},
+	}
+	graph := &DependencyGraph{
+		TopDeps:  []*Dependency{{Name: "main", Path: "/build/main", RealPath: "/build/main", Deps: &deps}},
+		FlatDeps: map[string]*Dependency{deps[0].RealPath: deps[0], deps[1].RealPath: deps[1]},
+	}
+
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	if err := DepsWriteJSON(fp, graph, JSONOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandsLoadSavedGraph(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.json")
+	writeTestGraph(t, path)
+
+	why := &whyCommand{Match: "any"}
+	why.Args.Library = "libz.dylib"
+	why.Args.Files = []string{path}
+	missing := &whyCommand{Match: "any"}
+	missing.Args.Library = "libpng.dylib"
+	missing.Args.Files = []string{path}
+	duplicates := &duplicatesCommand{}
+	duplicates.Args.Files = []string{path}
+
+	tests := []struct {
+		name string
+		cmd  command
+		err  string
+	}{
+		{name: "why", cmd: why},
+		{name: "why without a match", cmd: missing, err: "No libraries matching libpng.dylib were found"},
+		{name: "duplicates", cmd: duplicates, err: "Found 1 duplicate libraries"},
+	}
+
+	for _, test := range tests {
+		err := test.cmd.run(context.Background(), &options{}, nil)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: Expected error %q but got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -1,34 +1,132 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 
 	"github.com/jtanx/lddx/lddx"
 )
 
 func main() {
-	var graph *lddx.DependencyGraph
-	if len(os.Args) < 2 {
-		fmt.Printf("Usage %s lddxdata.json\n", os.Args[0])
+	format := flag.String("format", "text", "The format in which to print the dependencies (text, tree or dot)")
+	maxDepth := flag.Int("max-depth", 0, "The maximum depth of the dependencies to print, for the tree and dot formats (0 for unlimited)")
+	collapseIgnored := flag.Bool("collapse-ignored", false, "Groups the ignored libraries into a single cluster, for the dot format")
+	ascii := flag.Bool("ascii", false, "Draws the tree with ASCII instead of Unicode box-drawing characters, for the tree format")
+	hidePruned := flag.Bool("hide-pruned", false, "Hides the ignored libraries, for the tree format")
+	noColor := flag.Bool("no-color", false, "Does not colour the weak, unresolved and ignored libraries, for the tree format")
+	groupByPackage := flag.Bool("group-by-package", false, "Groups the libraries by the package that installed them, for the text format")
+	where := flag.String("where", "", "Selects the libraries matching the expression (e.g. unresolved, weak, path~/opt/homebrew or \"depth<3 and not ignored\")")
+	fields := flag.String("fields", "name,path,depth", "The comma separated fields of the selected libraries to print as a table (see -list-fields)")
+	count := flag.Bool("count", false, "Prints the number of selected libraries")
+	groupBy := flag.String("group-by", "", "Prints the number of selected libraries with each value of the field (e.g. origin)")
+	export := flag.String("export", "", "Writes the selected libraries and the load commands between them to the file as JSON (- for standard output)")
+	listFields := flag.Bool("list-fields", false, "Lists the fields that can be used in expressions and tables")
+	flag.Usage = func() {
+		fmt.Printf("Usage %s [options] lddxdata.json\n", os.Args[0])
+		fmt.Printf("       %s -where expression [-fields list | -count | -group-by field | -export file] lddxdata.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *listFields {
+		listQueryFields()
+		return
+	}
+
+	// The libraries are queried instead of printed if any query option is specified
+	var query *queryOptions
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "where", "fields", "count", "group-by", "export":
+			query = &queryOptions{}
+		}
+	})
+	if query != nil {
+		var err error
+		if *where != "" {
+			if query.Where, err = lddx.ParseQuery(*where); err != nil {
+				fmt.Printf("Invalid expression: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		if query.Fields, err = lddx.ParseQueryFields(*fields); err != nil {
+			fmt.Printf("Invalid fields: %s\n", err)
+			os.Exit(1)
+		}
+		if *groupBy != "" {
+			if fields, err := lddx.ParseQueryFields(*groupBy); err != nil || len(fields) != 1 {
+				fmt.Printf("Invalid field to group by: %s\n", *groupBy)
+				os.Exit(1)
+			} else {
+				query.GroupBy = fields[0]
+			}
+		}
+		query.Count = *count
+		query.Export = *export
+		// The table is printed unless only the other outputs were requested
+		query.Table = !query.Count && query.GroupBy == nil && query.Export == ""
+		flag.Visit(func(f *flag.Flag) {
+			query.Table = query.Table || f.Name == "fields"
+		})
+		if query.Export != "" && query.Export != "-" && flag.NArg() > 1 {
+			fmt.Printf("Only one graph may be exported to a file\n")
+			os.Exit(1)
+		}
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	} else if *format != "text" && *format != "tree" && *format != "dot" {
+		fmt.Printf("Unknown format: %s\n", *format)
 		os.Exit(1)
 	}
 
-	for i := 1; i < len(os.Args); i++ {
-		if fd, err := ioutil.ReadFile(os.Args[i]); err != nil {
+	for _, file := range flag.Args() {
+		fd, err := os.Open(file)
+		if err != nil {
 			fmt.Printf("Cannot read: %s\n", err)
 			os.Exit(1)
-		} else if err := json.Unmarshal(fd, &graph); err != nil {
+		}
+		// Every schema version is accepted, including the unversioned graphs
+		graph, err := lddx.DepsLoadJSON(fd)
+		fd.Close()
+		if err != nil {
 			fmt.Printf("Cannot unmarshal: %s\n", err)
 			os.Exit(1)
+		}
+
+		if query != nil {
+			if flag.NArg() > 1 && query.Export != "-" {
+				fmt.Printf("%s:\n", file)
+			}
+			if err := runQuery(graph, query); err != nil {
+				fmt.Printf("Cannot write: %s\n", err)
+				os.Exit(1)
+			}
+		} else if *format == "dot" {
+			opts := lddx.DotOptions{CollapseIgnored: *collapseIgnored, MaxDepth: *maxDepth}
+			if err := lddx.DepsWriteDot(os.Stdout, graph, opts); err != nil {
+				fmt.Printf("Cannot write: %s\n", err)
+				os.Exit(1)
+			}
+		} else if *format == "tree" {
+			opts := lddx.TreeOptions{ASCII: *ascii, MaxDepth: *maxDepth, HidePruned: *hidePruned, NoColor: *noColor}
+			if err := lddx.DepsWriteTree(os.Stdout, graph, opts); err != nil {
+				fmt.Printf("Cannot write: %s\n", err)
+				os.Exit(1)
+			}
 		} else {
 			for _, dep := range graph.TopDeps {
 				if len(graph.TopDeps) > 1 {
 					fmt.Printf("%s:\n", dep.Path)
 				}
-				lddx.DepsPrettyPrint(dep)
+				if *groupByPackage {
+					lddx.DepsPrettyPrintByPackage(dep)
+				} else {
+					lddx.DepsPrettyPrint(dep)
+				}
 			}
 		}
 	}
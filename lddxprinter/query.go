@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jtanx/lddx/lddx"
+)
+
+// queryOptions specifies how the libraries of a graph are filtered and printed.
+type queryOptions struct {
+	Where   *lddx.Query        // The filter expression, or nil to select every library
+	Fields  []*lddx.QueryField // The fields to print as a table, if a table is printed
+	Table   bool               // Print the selected libraries as a table
+	Count   bool               // Print the number of selected libraries
+	GroupBy *lddx.QueryField   // The field to count the selected libraries by, if any
+	Export  string             // The file to write the selected subgraph to as JSON (- for standard output), if any
+}
+
+// listQueryFields prints the fields that can be queried.
+func listQueryFields() {
+	kinds := map[lddx.QueryFieldKind]string{
+		lddx.QueryBool:    "bool",
+		lddx.QueryInt:     "int",
+		lddx.QueryString:  "string",
+		lddx.QueryVersion: "version",
+		lddx.QueryList:    "list",
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tTYPE\tDESCRIPTION")
+	for _, field := range lddx.QueryFields {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", field.Name, kinds[field.Kind], field.Description)
+	}
+	tw.Flush()
+}
+
+// runQuery filters the libraries of the graph and prints them as requested.
+func runQuery(graph *lddx.DependencyGraph, opts *queryOptions) error {
+	doc := lddx.NewGraphDocument(graph, lddx.JSONOptions{ToolName: "lddxprinter"})
+	rows := lddx.NewQueryRows(doc)
+	selected := lddx.FilterQueryRows(rows, opts.Where)
+
+	if opts.Table {
+		if err := lddx.WriteQueryTable(os.Stdout, selected, opts.Fields); err != nil {
+			return err
+		}
+	}
+	if opts.Count {
+		fmt.Println(len(selected))
+	}
+	if opts.GroupBy != nil {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tCOUNT\n", strings.ToUpper(opts.GroupBy.Name))
+		for _, count := range lddx.AggregateQueryRows(selected, opts.GroupBy) {
+			fmt.Fprintf(tw, "%s\t%d\n", count.Value, count.Count)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if opts.Export != "" {
+		out, err := json.MarshalIndent(lddx.FilterGraphDocument(doc, rows, opts.Where), "", "\t")
+		if err != nil {
+			return err
+		}
+		out = append(out, '\n')
+		if opts.Export == "-" {
+			_, err = os.Stdout.Write(out)
+			return err
+		}
+		return ioutil.WriteFile(opts.Export, out, 0644)
+	}
+	return nil
+}
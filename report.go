@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type reportCommand struct {
+	HTML  string `long:"html" required:"yes" description:"The HTML file to write the report to (- for standard output)"`
+	Title string `long:"title" description:"The title of the report (default: the name of the top-level file)"`
+
+	Args struct {
+		Files []string `positional-arg-name:"files" description:"The saved JSON graph, or the files or folders to process"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *reportCommand) run(ctx context.Context, opts *options, args []string) error {
+	files := append(c.Args.Files, args...)
+
+	graph, err := loadGraphFiles(ctx, opts, files)
+	if err != nil {
+		return fmt.Errorf("Could not process dependencies: %s", err)
+	}
+
+	reportOpts := ReportOptions{
+		Title:     c.Title,
+		Generator: "lddx " + version,
+		Timestamp: creationTime(),
+	}
+	if reportOpts.Title == "" {
+		reportOpts.Title = "Dependencies of " + filepath.Base(files[0])
+		if len(files) > 1 {
+			reportOpts.Title += fmt.Sprintf(" and %d more", len(files)-1)
+		}
+	}
+
+	if c.HTML == "-" {
+		return DepsWriteHTMLReport(os.Stdout, graph, reportOpts)
+	}
+
+	fp, err := os.Create(c.HTML)
+	if err != nil {
+		return err
+	}
+	if err := DepsWriteHTMLReport(fp, graph, reportOpts); err != nil {
+		fp.Close()
+		return fmt.Errorf("Could not write %s: %s", c.HTML, err)
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	LogInfo("Wrote the report to %s", c.HTML)
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type schemaCommand struct {
+	Output string `short:"o" long:"output" description:"The file to write the JSON Schema to (default: standard output)"`
+}
+
+func (c *schemaCommand) run(ctx context.Context, opts *options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("Unexpected arguments: %v", args)
+	} else if c.Output == "" {
+		_, err := os.Stdout.Write(JSONSchema)
+		return err
+	}
+
+	if err := ioutil.WriteFile(c.Output, JSONSchema, 0644); err != nil {
+		return err
+	}
+	LogInfo("Wrote the JSON Schema (version %d) to %s", SchemaVersion, c.Output)
+	return nil
+}
+
+// jsonOptions returns the tool recorded in the JSON output.
+func jsonOptions() JSONOptions {
+	return JSONOptions{ToolName: "lddx", ToolVersion: version}
+}
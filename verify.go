@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type verifyCommand struct {
+	SystemLibraries string `long:"system-libraries" config:"path" description:"A file listing the system libraries that may be loaded, one install name (or prefix ending with /) per line, instead of any library in the system paths"`
+	Args            struct {
+		Bundle string `positional-arg-name:"bundle-dir" description:"The collected bundle to verify"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *verifyCommand) run(ctx context.Context, opts *options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("Unexpected arguments: %v", args)
+	}
+
+	verifyOpts := VerifyOptions{ExecutablePath: opts.ExecutablePath}
+	if c.SystemLibraries != "" {
+		libs, err := ReadSystemLibraries(c.SystemLibraries)
+		if err != nil {
+			return fmt.Errorf("Could not read the system libraries: %s", err)
+		}
+		verifyOpts.SystemLibraries = libs
+	}
+
+	issues, err := VerifyBundleContext(ctx, c.Args.Bundle, verifyOpts)
+	if err != nil {
+		return fmt.Errorf("Could not verify %s: %s", c.Args.Bundle, err)
+	}
+
+	if opts.JSON {
+		out, err := json.MarshalIndent(issues, "", "\t")
+		if err != nil {
+			return fmt.Errorf("Could not serialise as JSON: %s", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		VerifyPrettyPrint(os.Stdout, issues)
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("Found %d load commands that prevent %s from being relocated", len(issues), c.Args.Bundle)
+	}
+	LogInfo("%s is self-contained", c.Args.Bundle)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type watchCommand struct {
+	Delay time.Duration `long:"delay" default:"500ms" description:"How long to wait for further changes before recalculating the dependencies"`
+
+	Args struct {
+		Files []string `positional-arg-name:"files" description:"The files or folders to watch"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *watchCommand) run(ctx context.Context, opts *options, args []string) error {
+	depOpts, err := getDependencyOptions(opts)
+	if err != nil {
+		return err
+	}
+	depOpts.Recursive = true
+
+	files := expandFileList(append(c.Args.Files, args...))
+	return DepsWatch(ctx, depOpts, WatchOptions{Delay: c.Delay}, files, func(update *WatchUpdate) error {
+		if update.Diff == nil {
+			for _, dep := range update.Graph.TopDeps {
+				if len(update.Graph.TopDeps) > 1 {
+					fmt.Printf("%s:\n", dep.Path)
+				}
+				DepsPrettyPrint(dep)
+			}
+		} else {
+			for _, file := range update.Changed {
+				LogInfo("Changed: %s", file)
+			}
+			DiffPrettyPrint(update.Diff)
+		}
+
+		if opts.Collect != "" {
+			collectGraph(ctx, opts, update.Graph)
+		}
+		LogInfo("Watching for changes...")
+		return nil
+	})
+}
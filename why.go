@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/jtanx/lddx/lddx"
+)
+
+type whyCommand struct {
+	Match    string `long:"match" choice:"any" choice:"name" choice:"install-name" choice:"real-path" default:"any" description:"The fields of each library to match the query against"`
+	MaxPaths int    `long:"max-paths" default:"100" description:"The maximum number of paths to print per library (0 for unlimited)"`
+
+	Args struct {
+		Library string   `positional-arg-name:"library" description:"The library to search for"`
+		Files   []string `positional-arg-name:"files" description:"The saved JSON graph, or the files or folders to process"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *whyCommand) run(ctx context.Context, opts *options, args []string) error {
+	graph, err := loadGraphFiles(ctx, opts, append(c.Args.Files, args...))
+	if err != nil {
+		return fmt.Errorf("Could not process dependencies: %s", err)
+	}
+
+	results := DepsWhy(graph, c.Args.Library, WhyOptions{
+		Match:    WhyMatch(c.Match),
+		MaxPaths: c.MaxPaths,
+	})
+	if len(results) == 0 {
+		return fmt.Errorf("No libraries matching %s were found", c.Args.Library)
+	}
+
+	WhyPrettyPrint(results)
+	return nil
+}